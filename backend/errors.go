@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error is a handler error carrying the gRPC code it should be
+// reported with. It wraps the underlying error, so errors.Is and
+// errors.As see through it.
+type Error struct {
+	Code codes.Code
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// GRPCStatus lets the gRPC server, and status.Code in in-process
+// clients, find the code even when the error is wrapped further.
+func (e *Error) GRPCStatus() *status.Status {
+	return status.New(e.Code, e.Error())
+}
+
+// newError returns a formatted error with the code.
+func newError(code codes.Code, format string, args ...any) error {
+	return &Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// withCode gives the error a code.
+func withCode(code codes.Code, err error) error {
+	return &Error{Code: code, Err: err}
+}
+
+// wrapError comments on the error, keeping its code if it has one.
+func wrapError(comment string, err error) error {
+	return &Error{Code: codeOf(err), Err: fmt.Errorf("%s: %w", comment, err)}
+}
+
+// codeOf returns the code of the first Error in the chain, or else
+// guesses one from the database or context error it wraps.
+func codeOf(err error) codes.Code {
+	var herr *Error
+	var nerr net.Error
+	switch {
+	case errors.As(err, &herr):
+		return herr.Code
+	case errors.Is(err, sql.ErrNoRows):
+		return codes.NotFound
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone), errors.As(err, &nerr):
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorCodes(t *testing.T) {
+	cases := []struct {
+		desc string
+		err  error
+		want codes.Code
+	}{
+		{
+			desc: "Typed",
+			err:  newError(codes.InvalidArgument, "bad ID %d", -1),
+			want: codes.InvalidArgument,
+		},
+		{
+			desc: "Wrapped typed",
+			err:  fmt.Errorf("outer: %w", wrapError("inner", withCode(codes.FailedPrecondition, errors.New("ironman")))),
+			want: codes.FailedPrecondition,
+		},
+		{
+			desc: "Missing row",
+			err:  wrapError("GetStory error", fmt.Errorf("could not find story 3: %w", sql.ErrNoRows)),
+			want: codes.NotFound,
+		},
+		{
+			desc: "Bad connection",
+			err:  wrapError("ListGames error", fmt.Errorf("could not begin transaction: %w", driver.ErrBadConn)),
+			want: codes.Unavailable,
+		},
+		{
+			desc: "Deadline",
+			err:  wrapError("GameState error", context.DeadlineExceeded),
+			want: codes.DeadlineExceeded,
+		},
+		{
+			desc: "Unknown",
+			err:  wrapError("GameState error", errors.New("oops")),
+			want: codes.Internal,
+		},
+	}
+
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			if got := status.Code(cc.err); got != cc.want {
+				t.Errorf("%s: status.Code(%v) => %v, want %v", cc.desc, cc.err, got, cc.want)
+			}
+		})
+	}
+
+	inner := fmt.Errorf("could not find game 7: %w", sql.ErrNoRows)
+	if err := wrapError("GameState error", inner); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("wrapError(%v) lost the wrapped error", inner)
+	}
+}
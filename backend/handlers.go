@@ -3,10 +3,14 @@ package handlers
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
+	"github.com/kingofmen/cyoa-exploratory/story"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/protobuf/proto"
 
 	spb "github.com/kingofmen/cyoa-exploratory/backend/proto"
@@ -14,50 +18,44 @@ import (
 )
 
 // txnError attempts to roll back the transaction and returns a commented error.
-func txnError(comment string, txn *sql.Tx, err error) error {
+func txnError(comment string, txn Txn, err error) error {
 	if rerr := txn.Rollback(); rerr != nil {
-		return fmt.Errorf("%s: %w; rollback failed: %w", comment, err, rerr)
+		return &Error{Code: codeOf(err), Err: fmt.Errorf("%s: %w; rollback failed: %w", comment, err, rerr)}
 	}
-	return fmt.Errorf("%s: %w", comment, err)
+	return wrapError(comment, err)
 }
 
-func createLocationImpl(ctx context.Context, db *sql.DB, loc *storypb.Location) (*spb.CreateLocationResponse, error) {
-	lid := loc.GetId()
-	if len(lid) < 1 {
-		lid = uuid.New().String()
+func createLocationImpl(ctx context.Context, st Store, loc *storypb.Location) (*spb.CreateLocationResponse, error) {
+	if len(loc.GetId()) < 1 {
+		loc.Id = proto.String(uuid.New().String())
 	}
-	blob, err := proto.Marshal(loc)
-	if err != nil {
-		return nil, fmt.Errorf("could not marshal Location: %w", err)
-	}
-	txn, err := db.BeginTx(ctx, nil)
+	txn, err := st.Begin(ctx, false)
 	if err != nil {
 		return nil, fmt.Errorf("could not begin transaction: %w", err)
 	}
-	if _, err := txn.ExecContext(ctx, `INSERT INTO Locations (id, title, proto) VALUES (?, ?, ?)`, lid, loc.GetTitle(), blob); err != nil {
-		return nil, txnError("could not insert into Locations", txn, err)
+	if err := txn.CreateLocation(ctx, loc); err != nil {
+		return nil, txnError("could not create location", txn, err)
 	}
 
 	if err := txn.Commit(); err != nil {
 		return nil, txnError("could not write to database", txn, err)
 	}
 
-	loc.Id = proto.String(lid)
 	return &spb.CreateLocationResponse{
 		Location: loc,
 	}, nil
 }
 
-func updateLocationImpl(ctx context.Context, db *sql.DB, lid string, loc *storypb.Location) (*spb.UpdateLocationResponse, error) {
-	blob, err := proto.Marshal(loc)
-	if err != nil {
-		return nil, fmt.Errorf("could not marshal Location: %w", err)
-	}
-	txn, err := db.BeginTx(ctx, nil)
+func updateLocationImpl(ctx context.Context, st Store, lid string, loc *storypb.Location) (*spb.UpdateLocationResponse, error) {
+	txn, err := st.Begin(ctx, false)
 	if err != nil {
 		return nil, fmt.Errorf("could not begin transaction: %w", err)
 	}
-	if _, err := txn.ExecContext(ctx, `UPDATE Locations SET title = ?, proto = ? WHERE id = ?`, loc.GetTitle(), blob, lid); err != nil {
+	if _, err := txn.LoadLocation(ctx, lid); err != nil {
+		return nil, txnError(fmt.Sprintf("could not find location %s", lid), txn, err)
+	}
+	loc.Id = proto.String(lid)
+	if err := txn.WriteLocation(ctx, loc); err != nil {
 		return nil, txnError(fmt.Sprintf("could not update Location %s", lid), txn, err)
 	}
 
@@ -74,12 +72,12 @@ func updateLocationImpl(ctx context.Context, db *sql.DB, lid string, loc *storyp
 	}, nil
 }
 
-func deleteLocationImpl(ctx context.Context, db *sql.DB, lid string) (*spb.DeleteLocationResponse, error) {
-	txn, err := db.BeginTx(ctx, nil)
+func deleteLocationImpl(ctx context.Context, st Store, lid string) (*spb.DeleteLocationResponse, error) {
+	txn, err := st.Begin(ctx, false)
 	if err != nil {
 		return nil, fmt.Errorf("could not begin transaction: %w", err)
 	}
-	if _, err := txn.ExecContext(ctx, `DELETE FROM Locations WHERE id = ?`, lid); err != nil {
+	if err := txn.DeleteLocation(ctx, lid); err != nil {
 		return nil, txnError(fmt.Sprintf("could not delete Location %s", lid), txn, err)
 	}
 
@@ -90,12 +88,12 @@ func deleteLocationImpl(ctx context.Context, db *sql.DB, lid string) (*spb.Delet
 	return &spb.DeleteLocationResponse{}, nil
 }
 
-func getLocationImpl(ctx context.Context, db *sql.DB, lid string) (*spb.GetLocationResponse, error) {
-	txn, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+func getLocationImpl(ctx context.Context, st Store, lid string) (*spb.GetLocationResponse, error) {
+	txn, err := st.Begin(ctx, true)
 	if err != nil {
 		return nil, fmt.Errorf("could not begin transaction: %w", err)
 	}
-	loc, err := loadLocation(ctx, txn, lid)
+	loc, err := txn.LoadLocation(ctx, lid)
 	if err != nil {
 		return nil, txnError(fmt.Sprintf("could not find location %s", lid), txn, err)
 	}
@@ -109,43 +107,31 @@ func getLocationImpl(ctx context.Context, db *sql.DB, lid string) (*spb.GetLocat
 	}, nil
 }
 
-func listLocationsImpl(ctx context.Context, db *sql.DB, req *spb.ListLocationsRequest) (*spb.ListLocationsResponse, error) {
+func listLocationsImpl(ctx context.Context, st Store, req *spb.ListLocationsRequest) (*spb.ListLocationsResponse, error) {
 	resp := &spb.ListLocationsResponse{
 		Locations: make([]*storypb.Location, 0, 10),
 	}
-	txn, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	txn, err := st.Begin(ctx, true)
 	if err != nil {
 		return nil, fmt.Errorf("could not begin transaction: %w", err)
 	}
-	rows, err := txn.QueryContext(ctx, `SELECT l.id, l.proto FROM Locations AS l ORDER BY l.id ASC`)
+	locs, err := txn.LoadLocations(ctx)
 	if err != nil {
 		return nil, txnError("could not list locations", txn, err)
 	}
-	for rows.Next() {
-		var lid string
-		blob := []byte{}
-		if err := rows.Scan(&lid, &blob); err != nil {
-			return nil, txnError("error scanning location", txn, err)
-		}
-		loc := &storypb.Location{}
-		if err := proto.Unmarshal(blob, loc); err != nil {
-			return nil, txnError(fmt.Sprintf("could not unmarshal location %s", lid), txn, err)
-		}
-		loc.Id = proto.String(lid)
-		resp.Locations = append(resp.Locations, loc)
-	}
+	resp.Locations = append(resp.Locations, locs...)
 	if err := txn.Commit(); err != nil {
 		return nil, txnError("could not commit query", txn, err)
 	}
 	return resp, nil
 }
 
-func getStoryImpl(ctx context.Context, db *sql.DB, sid int64, view spb.StoryView) (*spb.GetStoryResponse, error) {
-	txn, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+func getStoryImpl(ctx context.Context, st Store, sid int64, view spb.StoryView) (*spb.GetStoryResponse, error) {
+	txn, err := st.Begin(ctx, true)
 	if err != nil {
 		return nil, fmt.Errorf("could not begin transaction: %w", err)
 	}
-	str, err := loadStory(ctx, txn, sid)
+	str, err := txn.LoadStory(ctx, sid)
 	if err != nil {
 		return nil, txnError(fmt.Sprintf("could not find story %d", sid), txn, err)
 	}
@@ -154,17 +140,22 @@ func getStoryImpl(ctx context.Context, db *sql.DB, sid int64, view spb.StoryView
 	}
 
 	if view == spb.StoryView_VIEW_CONTENT {
-		locs, err := loadStoryLocations(ctx, txn, sid)
+		locs, err := txn.StoryLocations(ctx, sid)
 		if err != nil {
 			return nil, txnError(fmt.Sprintf("could not load story %d locations", sid), txn, err)
 		}
-		acts, err := loadStoryActions(ctx, txn, sid)
+		acts, err := txn.StoryActions(ctx, sid)
 		if err != nil {
 			return nil, txnError(fmt.Sprintf("could not load story %d actions", sid), txn, err)
 		}
+		items, err := txn.StoryItems(ctx, sid)
+		if err != nil {
+			return nil, txnError(fmt.Sprintf("could not load story %d items", sid), txn, err)
+		}
 		resp.Content = &spb.StoryContent{
 			Locations: locs,
 			Actions:   acts,
+			Items:     items,
 		}
 	}
 
@@ -175,12 +166,12 @@ func getStoryImpl(ctx context.Context, db *sql.DB, sid int64, view spb.StoryView
 	return resp, nil
 }
 
-func deleteStoryImpl(ctx context.Context, db *sql.DB, id int64) (*spb.DeleteStoryResponse, error) {
-	txn, err := db.BeginTx(ctx, nil)
+func deleteStoryImpl(ctx context.Context, st Store, id int64) (*spb.DeleteStoryResponse, error) {
+	txn, err := st.Begin(ctx, false)
 	if err != nil {
 		return nil, fmt.Errorf("could not begin transaction: %w", err)
 	}
-	if _, err := txn.ExecContext(ctx, `DELETE FROM Stories WHERE id = ?`, id); err != nil {
+	if err := txn.DeleteStory(ctx, id); err != nil {
 		return nil, txnError(fmt.Sprintf("could not delete Story %d", id), txn, err)
 	}
 
@@ -191,31 +182,47 @@ func deleteStoryImpl(ctx context.Context, db *sql.DB, id int64) (*spb.DeleteStor
 }
 
 // updateStoryImpl writes the provided story to the transaction, creating it if needed.
-func updateStoryImpl(ctx context.Context, txn *sql.Tx, upd *storypb.Story) (*spb.UpdateStoryResponse, error) {
+func updateStoryImpl(ctx context.Context, txn Txn, upd *storypb.Story) (*spb.UpdateStoryResponse, error) {
 	sid := upd.GetId()
 	var wrt *storypb.Story
 	var err error
 	if sid == 0 {
-		if wrt, err = createStory(ctx, txn, upd); err != nil {
+		if sid, err = txn.CreateStory(ctx, upd.GetTitle()); err != nil {
 			return nil, fmt.Errorf("could not create new story: %w", err)
 		}
-	} else if wrt, err = loadStory(ctx, txn, sid); err != nil {
+		wrt = &storypb.Story{Id: proto.Int64(sid)}
+	} else if wrt, err = txn.LoadStory(ctx, sid); err != nil {
 		return nil, fmt.Errorf("could not read story %d: %w", sid, err)
 	}
 
-	// Merge everything except events, which are overwritten.
+	// Merge everything except events, variables, characters, character
+	// rules, start triggers, global actions and regions, which are
+	// overwritten when set.
 	proto.Merge(wrt, upd)
 	if upd.GetEvents() != nil {
 		wrt.Events = upd.GetEvents()
 	}
-
-	blob, err := proto.Marshal(wrt)
-	if err != nil {
-		return nil, fmt.Errorf("could not marshal updated story %d: %w", sid, err)
+	if upd.GetVariables() != nil {
+		wrt.Variables = upd.GetVariables()
+	}
+	if upd.GetCharacters() != nil {
+		wrt.Characters = upd.GetCharacters()
+	}
+	if upd.GetCharacterRules() != nil {
+		wrt.CharacterRules = upd.GetCharacterRules()
+	}
+	if upd.GetOnStart() != nil {
+		wrt.OnStart = upd.GetOnStart()
+	}
+	if upd.GetGlobalActions() != nil {
+		wrt.GlobalActions = upd.GetGlobalActions()
+	}
+	if upd.GetRegions() != nil {
+		wrt.Regions = upd.GetRegions()
 	}
 
-	if _, err = txn.ExecContext(ctx, `UPDATE Stories SET title = ?, proto = ? WHERE id = ?`, wrt.GetTitle(), blob, wrt.GetId()); err != nil {
-		return nil, fmt.Errorf("could not update stories table: %w", err)
+	if err := txn.WriteStory(ctx, wrt); err != nil {
+		return nil, fmt.Errorf("could not write story %d: %w", sid, err)
 	}
 
 	return &spb.UpdateStoryResponse{
@@ -223,31 +230,22 @@ func updateStoryImpl(ctx context.Context, txn *sql.Tx, upd *storypb.Story) (*spb
 	}, nil
 }
 
-func listStoriesImpl(ctx context.Context, db *sql.DB, req *spb.ListStoriesRequest) (*spb.ListStoriesResponse, error) {
+func listStoriesImpl(ctx context.Context, st Store, req *spb.ListStoriesRequest) (*spb.ListStoriesResponse, error) {
 	resp := &spb.ListStoriesResponse{
 		Stories: make([]*storypb.Story, 0, 10),
 	}
-	txn, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	txn, err := st.Begin(ctx, true)
 	if err != nil {
 		return nil, fmt.Errorf("could not begin transaction: %w", err)
 	}
-	rows, err := txn.QueryContext(ctx, `SELECT l.id, l.proto FROM Stories AS l ORDER BY l.id ASC`)
+	strs, err := txn.LoadStories(ctx)
 	if err != nil {
 		return nil, txnError("could not list stories", txn, err)
 	}
-	for rows.Next() {
-		var id int64
-		blob := []byte{}
-		if err := rows.Scan(&id, &blob); err != nil {
-			return nil, txnError("error scanning story", txn, err)
-		}
-		str := &storypb.Story{}
-		if err := proto.Unmarshal(blob, str); err != nil {
-			return nil, txnError(fmt.Sprintf("could not unmarshal story %d", id), txn, err)
-		}
+	for _, str := range strs {
 		// Clone the limited view.
 		resp.Stories = append(resp.Stories, &storypb.Story{
-			Id:          proto.Int64(id),
+			Id:          proto.Int64(str.GetId()),
 			Title:       proto.String(str.GetTitle()),
 			Description: proto.String(str.GetDescription()),
 		})
@@ -258,70 +256,228 @@ func listStoriesImpl(ctx context.Context, db *sql.DB, req *spb.ListStoriesReques
 	return resp, nil
 }
 
-func createActionImpl(ctx context.Context, db *sql.DB, act *storypb.Action) (*spb.CreateActionResponse, error) {
-	aid := act.GetId()
-	if len(aid) < 1 {
-		aid = uuid.New().String()
+func createActionImpl(ctx context.Context, st Store, act *storypb.Action) (*spb.CreateActionResponse, error) {
+	if len(act.GetId()) < 1 {
+		act.Id = proto.String(uuid.New().String())
 	}
-	blob, err := proto.Marshal(act)
-	if err != nil {
-		return nil, fmt.Errorf("could not marshal Action: %v", err)
-	}
-	txn, err := db.BeginTx(ctx, nil)
+	txn, err := st.Begin(ctx, false)
 	if err != nil {
 		return nil, fmt.Errorf("could not begin transaction: %w", err)
 	}
 
-	if _, err := txn.ExecContext(ctx, `INSERT INTO Actions (id, proto) VALUES (?, ?)`, aid, blob); err != nil {
-		return nil, txnError("could not insert into Actions", txn, err)
+	if err := txn.CreateAction(ctx, act); err != nil {
+		return nil, txnError("could not create action", txn, err)
 	}
 	if err := txn.Commit(); err != nil {
 		return nil, txnError("could not write to database", txn, err)
 	}
 
-	act.Id = proto.String(aid)
 	return &spb.CreateActionResponse{
 		Action: act,
 	}, nil
 }
 
-func updateActionImpl(ctx context.Context, db *sql.DB, act *storypb.Action) (*spb.UpdateActionResponse, error) {
-	// TODO: Implement me.
+func updateActionImpl(ctx context.Context, st Store, act *storypb.Action) (*spb.UpdateActionResponse, error) {
+	aid := act.GetId()
+	txn, err := st.Begin(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	if _, err := txn.LoadAction(ctx, aid); err != nil {
+		return nil, txnError(fmt.Sprintf("could not find action %s", aid), txn, err)
+	}
+	if err := txn.WriteAction(ctx, act); err != nil {
+		return nil, txnError(fmt.Sprintf("could not update Action %s", aid), txn, err)
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, txnError("could not write to database", txn, err)
+	}
+
 	return &spb.UpdateActionResponse{
 		Action: act,
 	}, nil
 }
 
-func createGameImpl(ctx context.Context, db *sql.DB, sid int64) (*spb.CreateGameResponse, error) {
-	txn, err := db.BeginTx(ctx, nil)
+// dropAction returns the conditions without those for the action,
+// and whether there were any.
+func dropAction(conds []*storypb.ActionCondition, aid string) ([]*storypb.ActionCondition, bool) {
+	kept := make([]*storypb.ActionCondition, 0, len(conds))
+	for _, cond := range conds {
+		if cond.GetActionId() != aid {
+			kept = append(kept, cond)
+		}
+	}
+	return kept, len(kept) < len(conds)
+}
+
+// deleteActionImpl deletes the action. If prune is set, locations,
+// regions and global actions which offer it stop doing so; otherwise
+// the deletion is refused while any of them offer it.
+func deleteActionImpl(ctx context.Context, st Store, aid string, prune bool) (*spb.DeleteActionResponse, error) {
+	txn, err := st.Begin(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	locs, err := txn.ActionLocations(ctx, aid)
+	if err != nil {
+		return nil, txnError(fmt.Sprintf("could not load locations offering Action %s", aid), txn, err)
+	}
+	strs, err := txn.ActionStories(ctx, aid)
+	if err != nil {
+		return nil, txnError(fmt.Sprintf("could not load stories using Action %s", aid), txn, err)
+	}
+
+	var users []string
+	var changedLocs []*storypb.Location
+	var changedStrs []*storypb.Story
+	for _, loc := range locs {
+		conds, found := dropAction(loc.GetPossibleActions(), aid)
+		if !found {
+			continue
+		}
+		users = append(users, fmt.Sprintf("location %s (%s)", loc.GetId(), loc.GetTitle()))
+		loc.PossibleActions = conds
+		changedLocs = append(changedLocs, loc)
+	}
+	for _, str := range strs {
+		conds, found := dropAction(str.GetGlobalActions(), aid)
+		if found {
+			users = append(users, fmt.Sprintf("story %d (%s)", str.GetId(), str.GetTitle()))
+			str.GlobalActions = conds
+		}
+		for _, reg := range str.GetRegions() {
+			conds, rfound := dropAction(reg.GetPossibleActions(), aid)
+			if rfound {
+				users = append(users, fmt.Sprintf("region %s of story %d", reg.GetId(), str.GetId()))
+				reg.PossibleActions = conds
+				found = true
+			}
+		}
+		if found {
+			changedStrs = append(changedStrs, str)
+		}
+	}
+	if len(users) > 0 && !prune {
+		return nil, txnError(fmt.Sprintf("cannot delete Action %s", aid), txn, newError(codes.FailedPrecondition, "still offered by %s", strings.Join(users, ", ")))
+	}
+
+	for _, loc := range changedLocs {
+		if err := txn.WriteLocation(ctx, loc); err != nil {
+			return nil, txnError(fmt.Sprintf("could not remove Action %s from location %s", aid, loc.GetId()), txn, err)
+		}
+	}
+	for _, str := range changedStrs {
+		if err := txn.WriteStory(ctx, str); err != nil {
+			return nil, txnError(fmt.Sprintf("could not remove Action %s from story %d", aid, str.GetId()), txn, err)
+		}
+	}
+	if err := txn.DeleteAction(ctx, aid); err != nil {
+		return nil, txnError(fmt.Sprintf("could not delete Action %s", aid), txn, err)
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, txnError("could not write deletion to database", txn, err)
+	}
+	return &spb.DeleteActionResponse{}, nil
+}
+
+func getActionImpl(ctx context.Context, st Store, aid string) (*spb.GetActionResponse, error) {
+	txn, err := st.Begin(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	act, err := txn.LoadAction(ctx, aid)
+	if err != nil {
+		return nil, txnError(fmt.Sprintf("could not find action %s", aid), txn, err)
+	}
+
+	if err := txn.Commit(); err != nil {
+		return nil, txnError("could not commit query", txn, err)
+	}
+	return &spb.GetActionResponse{
+		Action: act,
+	}, nil
+}
+
+func listActionsImpl(ctx context.Context, st Store, req *spb.ListActionsRequest) (*spb.ListActionsResponse, error) {
+	txn, err := st.Begin(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	var acts []*storypb.Action
+	if sid := req.GetStoryId(); sid > 0 {
+		acts, err = txn.StoryActions(ctx, sid)
+	} else {
+		acts, err = txn.LoadAllActions(ctx)
+	}
+	if err != nil {
+		return nil, txnError("could not list actions", txn, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return nil, txnError("could not commit query", txn, err)
+	}
+	return &spb.ListActionsResponse{
+		Actions: acts,
+	}, nil
+}
+
+func createGameImpl(ctx context.Context, st Store, sid int64, cid string, custom *storypb.Character) (*spb.CreateGameResponse, error) {
+	txn, err := st.Begin(ctx, false)
 	if err != nil {
 		return nil, fmt.Errorf("could not begin transaction: %w", err)
 	}
 
-	str, err := loadStory(ctx, txn, sid)
+	str, err := txn.LoadStory(ctx, sid)
 	if err != nil {
 		return nil, txnError(fmt.Sprintf("could not find story %d", sid), txn, err)
 	}
 
-	ngame := &storypb.Playthrough{
-		StoryId: proto.Int64(str.GetId()),
+	char, err := story.ChooseCharacter(str, cid, custom)
+	if err != nil {
+		return nil, txnError("could not choose character", txn, withCode(codes.InvalidArgument, err))
+	}
+	items, err := txn.StoryItems(ctx, sid)
+	if err != nil {
+		return nil, txnError(fmt.Sprintf("could not load items for story %d", sid), txn, err)
+	}
+	start, err := story.StartGame(&storypb.GameEvent{
+		Story:     str,
+		Location:  &storypb.Location{Id: proto.String(str.GetStartLocationId())},
+		State:     storypb.RunState_RS_ACTIVE.Enum(),
+		Seed:      proto.Int64(rand.Int63()),
+		Items:     items,
+		Character: char,
+	}, &dbResolver{ctx: ctx, txn: txn})
+	if err != nil {
+		return nil, txnError("could not start game", txn, err)
 	}
-	if lid := str.GetStartLocationId(); len(lid) > 0 {
+	ngame := &storypb.Playthrough{
+		StoryId:   proto.Int64(str.GetId()),
+		Values:    start.GetValues(),
+		State:     start.GetState().Enum(),
+		Seed:      proto.Int64(start.GetSeed()),
+		Strings:   start.GetStrings(),
+		Lists:     start.GetLists(),
+		Inventory: start.GetInventory(),
+		Character: start.GetCharacter(),
+		Turn:      proto.Int64(start.GetTurn()),
+		Minutes:   proto.Int64(start.GetMinutes()),
+	}
+	if lid := start.GetLocation().GetId(); len(lid) > 0 {
 		ngame.LocationId = proto.String(lid)
 	}
-	// TODO: Set starting values from Story object.
-	ngame.State = storypb.RunState_RS_ACTIVE.Enum()
-	blob, err := proto.Marshal(ngame)
+	// The descriptions of start effects open the narration.
+	narration := strings.Join(start.GetEffects(), "\n")
+	gid, err := txn.CreateGame(ctx, ngame, narration)
 	if err != nil {
-		return nil, txnError("could not marshal new game", txn, err)
-	}
-	if _, err := txn.ExecContext(ctx, `INSERT INTO Playthroughs (proto) VALUES (?)`, blob); err != nil {
-		return nil, txnError("could not insert into Playthroughs", txn, err)
+		return nil, txnError("could not create game", txn, err)
 	}
-	var gid int64
-	row := txn.QueryRowContext(ctx, `SELECT LAST_INSERT_ID()`)
-	if err := row.Scan(&gid); err != nil {
-		return nil, txnError("could not read back created ID", txn, err)
+	rec := story.RecordTurn(&storypb.GameEvent{}, start)
+	rec.Narration = proto.String(narration)
+	rec.State = ngame
+	if err := txn.CreateTurn(ctx, gid, rec); err != nil {
+		return nil, txnError("could not record game start", txn, err)
 	}
 	if err := txn.Commit(); err != nil {
 		return nil, txnError("could not write to database", txn, err)
@@ -332,33 +488,28 @@ func createGameImpl(ctx context.Context, db *sql.DB, sid int64) (*spb.CreateGame
 	}, nil
 }
 
-func listGamesImpl(ctx context.Context, db *sql.DB, req *spb.ListGamesRequest) (*spb.ListGamesResponse, error) {
+func listGamesImpl(ctx context.Context, st Store, req *spb.ListGamesRequest) (*spb.ListGamesResponse, error) {
 	resp := &spb.ListGamesResponse{
 		Games: make([]*storypb.Playthrough, 0, 10),
 	}
-	txn, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	txn, err := st.Begin(ctx, true)
 	if err != nil {
 		return nil, fmt.Errorf("could not begin transaction: %w", err)
 	}
-	rows, err := txn.QueryContext(ctx, `SELECT l.id, l.proto FROM Playthroughs AS l ORDER BY l.id ASC`)
+	games, err := txn.LoadGames(ctx)
 	if err != nil {
 		return nil, txnError("could not list playthroughs", txn, err)
 	}
-	for rows.Next() {
-		var id int64
-		blob := []byte{}
-		if err := rows.Scan(&id, &blob); err != nil {
-			return nil, txnError("error scanning playthrough", txn, err)
-		}
-		gam := &storypb.Playthrough{}
-		if err := proto.Unmarshal(blob, gam); err != nil {
-			return nil, txnError(fmt.Sprintf("could not unmarshal playthrough %d", id), txn, err)
-		}
+	for _, gam := range games {
 		// Clone a limited view.
 		resp.Games = append(resp.Games, &storypb.Playthrough{
-			Id:      proto.Int64(id),
-			StoryId: proto.Int64(gam.GetStoryId()),
-			State:   gam.GetState().Enum(),
+			Id:         proto.Int64(gam.GetId()),
+			StoryId:    proto.Int64(gam.GetStoryId()),
+			State:      gam.GetState().Enum(),
+			Turn:       proto.Int64(gam.GetTurn()),
+			ParentId:   gam.ParentId,
+			ParentTurn: gam.ParentTurn,
+			Slot:       gam.Slot,
 		})
 	}
 	if err := txn.Commit(); err != nil {
@@ -367,43 +518,194 @@ func listGamesImpl(ctx context.Context, db *sql.DB, req *spb.ListGamesRequest) (
 	return resp, nil
 }
 
-func loadPossibleActions(ctx context.Context, txn *sql.Tx, loc *storypb.Location) ([]*storypb.Action, error) {
-	aids := make([]string, 0, len(loc.GetPossibleActions()))
-	for _, pact := range loc.GetPossibleActions() {
+const (
+	defaultHistoryPage = 20
+	maxHistoryPage     = 100
+)
+
+func getGameHistoryImpl(ctx context.Context, st Store, req *spb.GetGameHistoryRequest) (*spb.GetGameHistoryResponse, error) {
+	gid := req.GetGameId()
+	size := int64(req.GetPageSize())
+	if size < 1 {
+		size = defaultHistoryPage
+	}
+	size = min(size, maxHistoryPage)
+	var from int64
+	if tok := req.GetPageToken(); len(tok) > 0 {
+		var err error
+		if from, err = strconv.ParseInt(tok, 10, 64); err != nil || from < 0 {
+			return nil, newError(codes.InvalidArgument, "bad page token %q", tok)
+		}
+	}
+
+	txn, err := st.Begin(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	if _, _, err := txn.LoadGame(ctx, gid); err != nil {
+		return nil, txnError(fmt.Sprintf("could not find playthrough %d", gid), txn, err)
+	}
+	// Ask for one extra turn to learn whether there is another page.
+	turns, err := txn.LoadTurns(ctx, gid, from, size+1)
+	if err != nil {
+		return nil, txnError(fmt.Sprintf("could not load history of playthrough %d", gid), txn, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return nil, txnError("could not commit query", txn, err)
+	}
+
+	// The snapshots are for rewinding, not for players.
+	for _, turn := range turns {
+		turn.State = nil
+	}
+	resp := &spb.GetGameHistoryResponse{Turns: turns}
+	if int64(len(turns)) > size {
+		resp.Turns = turns[:size]
+		resp.NextPageToken = proto.String(strconv.FormatInt(turns[size].GetTurn(), 10))
+	}
+	return resp, nil
+}
+
+// rewindGameImpl restores the playthrough to the state in which the
+// given turn left it, forgetting the turns after.
+func rewindGameImpl(ctx context.Context, st Store, gid int64, turn *int64) error {
+	txn, err := st.Begin(ctx, false)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	game, _, err := txn.LoadGame(ctx, gid)
+	if err != nil {
+		return txnError(fmt.Sprintf("could not find playthrough %d", gid), txn, err)
+	}
+	str, err := txn.LoadStory(ctx, game.GetStoryId())
+	if err != nil {
+		return txnError(fmt.Sprintf("could not find story %d", game.GetStoryId()), txn, err)
+	}
+	if str.GetIronman() {
+		return txnError(fmt.Sprintf("cannot rewind playthrough %d", gid), txn, newError(codes.FailedPrecondition, "story %d is played ironman", str.GetId()))
+	}
+	target := game.GetTurn() - 1
+	if turn != nil {
+		target = *turn
+	}
+	if target < 0 || target > game.GetTurn() {
+		return txnError(fmt.Sprintf("cannot rewind playthrough %d", gid), txn, newError(codes.OutOfRange, "turn %d is not between 0 and %d", target, game.GetTurn()))
+	}
+
+	turns, err := txn.LoadTurns(ctx, gid, 0, target+1)
+	if err != nil {
+		return txnError(fmt.Sprintf("could not load history of playthrough %d", gid), txn, err)
+	}
+	if int64(len(turns)) != target+1 || turns[target].GetState() == nil {
+		return txnError(fmt.Sprintf("cannot rewind playthrough %d", gid), txn, newError(codes.FailedPrecondition, "no record of turn %d", target))
+	}
+	// Rebuild the narration as GameState accumulated it.
+	narration := ""
+	for _, rec := range turns {
+		if len(narration) > 0 {
+			narration = strings.Join([]string{narration, rec.GetNarration()}, "\n")
+		} else {
+			narration = rec.GetNarration()
+		}
+	}
+	state := turns[target].GetState()
+	state.Id = proto.Int64(gid)
+	if err := txn.WriteGame(ctx, state, narration); err != nil {
+		return txnError(fmt.Sprintf("could not update playthrough %d", gid), txn, err)
+	}
+	if err := txn.DeleteTurns(ctx, gid, target); err != nil {
+		return txnError(fmt.Sprintf("could not truncate history of playthrough %d", gid), txn, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return txnError("could not commit rewind", txn, err)
+	}
+	return nil
+}
+
+// forkGameImpl copies the playthrough, with its narration and
+// history, into a new game.
+func forkGameImpl(ctx context.Context, st Store, gid int64, slot string) (*spb.ForkGameResponse, error) {
+	txn, err := st.Begin(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	game, narration, err := txn.LoadGame(ctx, gid)
+	if err != nil {
+		return nil, txnError(fmt.Sprintf("could not find playthrough %d", gid), txn, err)
+	}
+	if len(slot) > 0 {
+		used, err := txn.SlotUsed(ctx, gid, slot)
+		if err != nil {
+			return nil, txnError(fmt.Sprintf("could not check save slots of playthrough %d", gid), txn, err)
+		}
+		if used {
+			return nil, txnError(fmt.Sprintf("cannot fork playthrough %d", gid), txn, newError(codes.AlreadyExists, "save slot %q already used", slot))
+		}
+		game.Slot = proto.String(slot)
+	} else {
+		game.Slot = nil
+	}
+
+	game.ParentId = proto.Int64(gid)
+	game.ParentTurn = proto.Int64(game.GetTurn())
+	fid, err := txn.CreateGame(ctx, game, narration)
+	if err != nil {
+		return nil, txnError(fmt.Sprintf("could not create fork of playthrough %d", gid), txn, err)
+	}
+	if err := txn.CopyTurns(ctx, gid, fid); err != nil {
+		return nil, txnError(fmt.Sprintf("could not copy history of playthrough %d", gid), txn, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return nil, txnError("could not write to database", txn, err)
+	}
+
+	return &spb.ForkGameResponse{
+		GameId: proto.Int64(fid),
+	}, nil
+}
+
+func loadPossibleActions(ctx context.Context, txn Txn, str *storypb.Story, loc *storypb.Location) ([]*storypb.Action, error) {
+	pacts := story.ActionConditions(str, loc)
+	aids := make([]string, 0, len(pacts))
+	for _, pact := range pacts {
 		aids = append(aids, pact.GetActionId())
 	}
-	return loadActions(ctx, txn, aids...)
+	return txn.LoadActions(ctx, aids...)
 }
 
 // loadStoryState loads the player action, location, state, and story for a game.
 // It is read-only.
-func loadStoryState(ctx context.Context, txn *sql.Tx, gid int64, aid string) (*storypb.GameEvent, error) {
-	game, narration, err := loadGame(ctx, txn, gid)
+func loadStoryState(ctx context.Context, txn Txn, gid int64, aid string) (*storypb.GameEvent, error) {
+	game, narration, err := txn.LoadGame(ctx, gid)
 	if err != nil {
 		return nil, fmt.Errorf("could not find game %d: %w", gid, err)
 	}
 	sid := game.GetStoryId()
-	str, err := loadStory(ctx, txn, sid)
+	str, err := txn.LoadStory(ctx, sid)
 	if err != nil {
 		return nil, fmt.Errorf("could not find story %d for playthrough %d: %w", sid, gid, err)
 	}
 	var act *storypb.Action
 	if len(aid) > 0 {
-		act, err = loadAction(ctx, txn, aid)
+		act, err = txn.LoadAction(ctx, aid)
 		if err != nil {
 			return nil, fmt.Errorf("could not find action %s for playthrough %d of story %d: %w", aid, gid, sid, err)
 		}
 	}
 	lid := game.GetLocationId()
-	loc, err := loadLocation(ctx, txn, lid)
+	loc, err := txn.LoadLocation(ctx, lid)
 	if err != nil {
 		return nil, fmt.Errorf("could not find location %s for playthrough %d of story %d: %w", lid, gid, sid, err)
 	}
 
-	candActs, err := loadPossibleActions(ctx, txn, loc)
+	candActs, err := loadPossibleActions(ctx, txn, str, loc)
 	if err != nil {
 		return nil, fmt.Errorf("could not load candidate actions for location %s (%s): %w", loc.GetId(), loc.GetTitle(), err)
 	}
+	items, err := txn.StoryItems(ctx, sid)
+	if err != nil {
+		return nil, fmt.Errorf("could not load items for story %d: %w", sid, err)
+	}
 
 	return &storypb.GameEvent{
 		PlayerAction:     act,
@@ -413,23 +715,70 @@ func loadStoryState(ctx context.Context, txn *sql.Tx, gid int64, aid string) (*s
 		Narration:        proto.String(narration),
 		CandidateActions: candActs,
 		State:            game.GetState().Enum(),
+		Seed:             proto.Int64(game.GetSeed()),
+		Strings:          game.GetStrings(),
+		Lists:            game.GetLists(),
+		Inventory:        describeInventory(game.GetInventory(), items),
+		Items:            items,
+		Character:        game.GetCharacter(),
+		Turn:             proto.Int64(game.GetTurn()),
+		Minutes:          proto.Int64(game.GetMinutes()),
 	}, nil
 }
 
-func writeAction(ctx context.Context, txn *sql.Tx, gid int64, gstate *storypb.GameEvent, narration string) error {
-	game := &storypb.Playthrough{
+// describeInventory returns the inventory with titles and
+// descriptions from the current item definitions, so that edits
+// to a story show up in existing playthroughs.
+func describeInventory(inv, items []*storypb.Item) []*storypb.Item {
+	defs := make(map[string]*storypb.Item, len(items))
+	for _, item := range items {
+		defs[item.GetId()] = item
+	}
+	ret := make([]*storypb.Item, 0, len(inv))
+	for _, held := range inv {
+		desc := proto.Clone(held).(*storypb.Item)
+		if def, ok := defs[held.GetId()]; ok {
+			desc.Title = proto.String(def.GetTitle())
+			desc.Description = proto.String(def.GetDescription())
+		}
+		ret = append(ret, desc)
+	}
+	return ret
+}
+
+// snapshot returns the playthrough state stored for the game event.
+func snapshot(gid int64, gstate *storypb.GameEvent) *storypb.Playthrough {
+	return &storypb.Playthrough{
 		Id:         proto.Int64(gid),
 		StoryId:    proto.Int64(gstate.GetStory().GetId()),
 		LocationId: proto.String(gstate.GetLocation().GetId()),
 		Values:     gstate.GetValues(),
 		State:      gstate.GetState().Enum(),
+		Seed:       proto.Int64(gstate.GetSeed()),
+		Strings:    gstate.GetStrings(),
+		Lists:      gstate.GetLists(),
+		Inventory:  gstate.GetInventory(),
+		Character:  gstate.GetCharacter(),
+		Turn:       proto.Int64(gstate.GetTurn()),
+		Minutes:    proto.Int64(gstate.GetMinutes()),
 	}
-	blob, err := proto.Marshal(game)
-	if err != nil {
-		return fmt.Errorf("could not marshal updated playthrough %d of story %d: %w", gid, game.GetStoryId(), err)
-	}
-	if _, err := txn.ExecContext(ctx, `UPDATE Playthroughs SET proto = ?, narration = ? WHERE id = ?`, blob, narration, gid); err != nil {
-		return fmt.Errorf("could not update playthrough %d: %w", gid, err)
-	}
-	return nil
+}
+
+func writeAction(ctx context.Context, txn Txn, gid int64, gstate *storypb.GameEvent, narration string) error {
+	return txn.WriteGame(ctx, snapshot(gid, gstate), narration)
+}
+
+// dbResolver implements story.Resolver by loading content within
+// the transaction.
+type dbResolver struct {
+	ctx context.Context
+	txn Txn
+}
+
+func (r *dbResolver) Location(lid string) (*storypb.Location, error) {
+	return r.txn.LoadLocation(r.ctx, lid)
+}
+
+func (r *dbResolver) Actions(aids ...string) ([]*storypb.Action, error) {
+	return r.txn.LoadActions(r.ctx, aids...)
 }
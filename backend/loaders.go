@@ -26,10 +26,18 @@ func loadStory(ctx context.Context, txn *sql.Tx, sid int64) (*storypb.Story, err
 }
 
 func loadGame(ctx context.Context, txn *sql.Tx, gid int64) (*storypb.Playthrough, string, error) {
-	row := txn.QueryRowContext(ctx, `SELECT * FROM Playthroughs AS p WHERE p.id = ?`, gid)
+	row := txn.QueryRowContext(ctx, `SELECT p.id, p.proto, p.narration, p.parent_id, p.parent_turn, p.slot FROM Playthroughs AS p WHERE p.id = ?`, gid)
+	return scanGame(row)
+}
+
+// scanGame reads a playthrough from a row of id, proto, narration,
+// parent_id, parent_turn and slot.
+func scanGame(row interface{ Scan(...any) error }) (*storypb.Playthrough, string, error) {
+	var gid int64
 	blob := []byte{}
-	var text sql.NullString
-	if err := row.Scan(&gid, &blob, &text); err != nil {
+	var text, slot sql.NullString
+	var pid, pturn sql.NullInt64
+	if err := row.Scan(&gid, &blob, &text, &pid, &pturn, &slot); err != nil {
 		return nil, "", err
 	}
 	game := &storypb.Playthrough{}
@@ -37,9 +45,81 @@ func loadGame(ctx context.Context, txn *sql.Tx, gid int64) (*storypb.Playthrough
 		return nil, "", fmt.Errorf("could not unmarshal game %d: %w", gid, err)
 	}
 	game.Id = proto.Int64(gid)
+	if pid.Valid {
+		game.ParentId = proto.Int64(pid.Int64)
+		game.ParentTurn = proto.Int64(pturn.Int64)
+	}
+	if slot.Valid {
+		game.Slot = proto.String(slot.String)
+	}
 	return game, text.String, nil
 }
 
+// loadAllGames returns every playthrough, in order of ID.
+func loadAllGames(ctx context.Context, txn *sql.Tx) ([]*storypb.Playthrough, error) {
+	rows, err := txn.QueryContext(ctx, `SELECT p.id, p.proto, p.narration, p.parent_id, p.parent_turn, p.slot FROM Playthroughs AS p ORDER BY p.id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("playthroughs query failed: %w", err)
+	}
+	defer rows.Close()
+	ret := make([]*storypb.Playthrough, 0, 10)
+	for rows.Next() {
+		game, _, err := scanGame(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning playthrough: %w", err)
+		}
+		ret = append(ret, game)
+	}
+	return ret, rows.Err()
+}
+
+// slotUsed returns true if a fork of the game has the slot name.
+func slotUsed(ctx context.Context, txn *sql.Tx, gid int64, slot string) (bool, error) {
+	var used int64
+	row := txn.QueryRowContext(ctx, `SELECT COUNT(*) FROM Playthroughs WHERE parent_id = ? AND slot = ?`, gid, slot)
+	if err := row.Scan(&used); err != nil {
+		return false, fmt.Errorf("could not check save slots of playthrough %d: %w", gid, err)
+	}
+	return used > 0, nil
+}
+
+// loadTurns returns up to limit turns of the playthrough's history,
+// starting from the given turn.
+func loadTurns(ctx context.Context, txn *sql.Tx, gid, from, limit int64) ([]*storypb.TurnRecord, error) {
+	rows, err := txn.QueryContext(ctx, `SELECT e.turn, e.action_id, e.narrator, e.narration, e.proto
+                                      FROM PlaythroughEvents AS e
+                                      WHERE e.game_id = ? AND e.turn >= ?
+                                      ORDER BY e.turn ASC LIMIT ?`, gid, from, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not query history of playthrough %d: %w", gid, err)
+	}
+	defer rows.Close()
+	turns := make([]*storypb.TurnRecord, 0, limit)
+	for rows.Next() {
+		var turn int64
+		var aid, narrator, narration sql.NullString
+		blob := []byte{}
+		if err := rows.Scan(&turn, &aid, &narrator, &narration, &blob); err != nil {
+			return nil, fmt.Errorf("error scanning turn of playthrough %d: %w", gid, err)
+		}
+		rec := &storypb.TurnRecord{}
+		if err := proto.Unmarshal(blob, rec); err != nil {
+			return nil, fmt.Errorf("could not unmarshal turn %d of playthrough %d: %w", turn, gid, err)
+		}
+		rec.Turn = proto.Int64(turn)
+		if len(aid.String) > 0 {
+			rec.ActionId = proto.String(aid.String)
+		}
+		rec.Narrator = proto.String(narrator.String)
+		rec.Narration = proto.String(narration.String)
+		turns = append(turns, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading history of playthrough %d: %w", gid, err)
+	}
+	return turns, nil
+}
+
 func loadActions(ctx context.Context, txn *sql.Tx, aids ...string) ([]*storypb.Action, error) {
 	if len(aids) == 0 {
 		return []*storypb.Action{}, nil
@@ -120,6 +200,7 @@ func loadStoryLocations(ctx context.Context, txn *sql.Tx, sid int64) ([]*storypb
 	if err != nil {
 		return nil, fmt.Errorf("story %d locations query failed: %w", sid, err)
 	}
+	defer rows.Close()
 	ret := make([]*storypb.Location, 0, 10)
 	for rows.Next() {
 		var lid string
@@ -133,7 +214,9 @@ func loadStoryLocations(ctx context.Context, txn *sql.Tx, sid int64) ([]*storypb
 		}
 		loc.Id = proto.String(lid)
 		ret = append(ret, loc)
-
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading locations for story %d: %w", sid, err)
 	}
 	return ret, nil
 }
@@ -148,6 +231,7 @@ func loadStoryActions(ctx context.Context, txn *sql.Tx, sid int64) ([]*storypb.A
 	if err != nil {
 		return nil, fmt.Errorf("story %d actions query failed: %w", sid, err)
 	}
+	defer rows.Close()
 	ret := make([]*storypb.Action, 0, 10)
 	for rows.Next() {
 		var aid string
@@ -162,5 +246,176 @@ func loadStoryActions(ctx context.Context, txn *sql.Tx, sid int64) ([]*storypb.A
 		act.Id = proto.String(aid)
 		ret = append(ret, act)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading actions for story %d: %w", sid, err)
+	}
+	return ret, nil
+}
+
+func loadStoryItems(ctx context.Context, txn *sql.Tx, sid int64) ([]*storypb.Item, error) {
+	rows, err := txn.QueryContext(ctx, `SELECT i.id, i.proto FROM Items AS i WHERE i.story_id = ? ORDER BY i.id ASC`, sid)
+	if err != nil {
+		return nil, fmt.Errorf("story %d items query failed: %w", sid, err)
+	}
+	defer rows.Close()
+	ret := make([]*storypb.Item, 0, 10)
+	for rows.Next() {
+		var iid string
+		blob := []byte{}
+		if err := rows.Scan(&iid, &blob); err != nil {
+			return nil, fmt.Errorf("error scanning item for story %d: %w", sid, err)
+		}
+		item := &storypb.Item{}
+		if err := proto.Unmarshal(blob, item); err != nil {
+			return nil, fmt.Errorf("could not unmarshal item %s for story %d: %w", iid, sid, err)
+		}
+		item.Id = proto.String(iid)
+		ret = append(ret, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading items for story %d: %w", sid, err)
+	}
+	return ret, nil
+}
+
+// loadAllActions returns every action, in order of ID.
+func loadAllActions(ctx context.Context, txn *sql.Tx) ([]*storypb.Action, error) {
+	rows, err := txn.QueryContext(ctx, `SELECT a.id, a.proto FROM Actions AS a ORDER BY a.id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("actions query failed: %w", err)
+	}
+	defer rows.Close()
+	ret := make([]*storypb.Action, 0, 10)
+	for rows.Next() {
+		var aid string
+		blob := []byte{}
+		if err := rows.Scan(&aid, &blob); err != nil {
+			return nil, fmt.Errorf("error scanning action: %w", err)
+		}
+		act := &storypb.Action{}
+		if err := proto.Unmarshal(blob, act); err != nil {
+			return nil, fmt.Errorf("could not unmarshal action %s: %w", aid, err)
+		}
+		act.Id = proto.String(aid)
+		ret = append(ret, act)
+	}
+	return ret, rows.Err()
+}
+
+// loadAllLocations returns every location, in order of ID.
+func loadAllLocations(ctx context.Context, txn *sql.Tx) ([]*storypb.Location, error) {
+	rows, err := txn.QueryContext(ctx, `SELECT l.id, l.proto FROM Locations AS l ORDER BY l.id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("locations query failed: %w", err)
+	}
+	defer rows.Close()
+	ret := make([]*storypb.Location, 0, 10)
+	for rows.Next() {
+		var lid string
+		blob := []byte{}
+		if err := rows.Scan(&lid, &blob); err != nil {
+			return nil, fmt.Errorf("error scanning location: %w", err)
+		}
+		loc := &storypb.Location{}
+		if err := proto.Unmarshal(blob, loc); err != nil {
+			return nil, fmt.Errorf("could not unmarshal location %s: %w", lid, err)
+		}
+		loc.Id = proto.String(lid)
+		ret = append(ret, loc)
+	}
+	return ret, rows.Err()
+}
+
+// loadAllStories returns every story, in order of ID.
+func loadAllStories(ctx context.Context, txn *sql.Tx) ([]*storypb.Story, error) {
+	rows, err := txn.QueryContext(ctx, `SELECT s.id, s.proto FROM Stories AS s ORDER BY s.id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("stories query failed: %w", err)
+	}
+	defer rows.Close()
+	ret := make([]*storypb.Story, 0, 10)
+	for rows.Next() {
+		var sid int64
+		blob := []byte{}
+		if err := rows.Scan(&sid, &blob); err != nil {
+			return nil, fmt.Errorf("error scanning story: %w", err)
+		}
+		str := &storypb.Story{}
+		if err := proto.Unmarshal(blob, str); err != nil {
+			return nil, fmt.Errorf("could not unmarshal story %d: %w", sid, err)
+		}
+		str.Id = proto.Int64(sid)
+		ret = append(ret, str)
+	}
+	return ret, rows.Err()
+}
+
+// loadActionLocations returns the locations which offer the action, in
+// order of ID. Locations with no recorded actions may predate the
+// LocationActions table, so they are returned too.
+func loadActionLocations(ctx context.Context, txn *sql.Tx, aid string) ([]*storypb.Location, error) {
+	rows, err := txn.QueryContext(ctx, `SELECT l.id, l.proto
+                                      FROM Locations AS l
+                                      WHERE EXISTS (SELECT 1 FROM LocationActions AS la
+                                                    WHERE la.location_id = l.id AND la.action_id = ?)
+                                      OR NOT EXISTS (SELECT 1 FROM LocationActions AS la
+                                                     WHERE la.location_id = l.id)
+                                      ORDER BY l.id ASC`,
+		aid)
+	if err != nil {
+		return nil, fmt.Errorf("action %s locations query failed: %w", aid, err)
+	}
+	defer rows.Close()
+	ret := make([]*storypb.Location, 0, 10)
+	for rows.Next() {
+		var lid string
+		blob := []byte{}
+		if err := rows.Scan(&lid, &blob); err != nil {
+			return nil, fmt.Errorf("error scanning location for action %s: %w", aid, err)
+		}
+		loc := &storypb.Location{}
+		if err := proto.Unmarshal(blob, loc); err != nil {
+			return nil, fmt.Errorf("could not unmarshal location %s for action %s: %w", lid, aid, err)
+		}
+		loc.Id = proto.String(lid)
+		ret = append(ret, loc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading locations for action %s: %w", aid, err)
+	}
+	return ret, nil
+}
+
+// loadActionStories returns the stories which use the action, in order
+// of ID.
+func loadActionStories(ctx context.Context, txn *sql.Tx, aid string) ([]*storypb.Story, error) {
+	rows, err := txn.QueryContext(ctx, `SELECT s.id, s.proto
+                                      FROM StoryActions AS sa
+                                      JOIN Stories AS s
+                                      ON sa.story_id = s.id
+                                      WHERE sa.action_id = ?
+                                      ORDER BY s.id ASC`,
+		aid)
+	if err != nil {
+		return nil, fmt.Errorf("action %s stories query failed: %w", aid, err)
+	}
+	defer rows.Close()
+	ret := make([]*storypb.Story, 0, 10)
+	for rows.Next() {
+		var sid int64
+		blob := []byte{}
+		if err := rows.Scan(&sid, &blob); err != nil {
+			return nil, fmt.Errorf("error scanning story for action %s: %w", aid, err)
+		}
+		str := &storypb.Story{}
+		if err := proto.Unmarshal(blob, str); err != nil {
+			return nil, fmt.Errorf("could not unmarshal story %d for action %s: %w", sid, aid, err)
+		}
+		str.Id = proto.Int64(sid)
+		ret = append(ret, str)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading stories for action %s: %w", aid, err)
+	}
 	return ret, nil
 }
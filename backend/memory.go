@@ -0,0 +1,521 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+// memoryData is the content of a memoryStore. The stored protos are
+// never modified in place, so copies of the maps may share them.
+type memoryData struct {
+	stories   map[int64]*storypb.Story
+	storyLocs map[int64][]string
+	storyActs map[int64][]string
+	items     map[int64][]*storypb.Item
+	locations map[string]*storypb.Location
+	actions   map[string]*storypb.Action
+	games     map[int64]*memoryGame
+	turns     map[int64]map[int64]*storypb.TurnRecord
+	lastStory int64
+	lastGame  int64
+}
+
+type memoryGame struct {
+	game      *storypb.Playthrough
+	narration string
+}
+
+func (d *memoryData) clone() *memoryData {
+	turns := make(map[int64]map[int64]*storypb.TurnRecord, len(d.turns))
+	for gid, recs := range d.turns {
+		turns[gid] = maps.Clone(recs)
+	}
+	return &memoryData{
+		stories:   maps.Clone(d.stories),
+		storyLocs: maps.Clone(d.storyLocs),
+		storyActs: maps.Clone(d.storyActs),
+		items:     maps.Clone(d.items),
+		locations: maps.Clone(d.locations),
+		actions:   maps.Clone(d.actions),
+		games:     maps.Clone(d.games),
+		turns:     turns,
+		lastStory: d.lastStory,
+		lastGame:  d.lastGame,
+	}
+}
+
+// memoryStore implements Store in memory, for tests and local demos.
+// Transactions are serialized; write transactions work on a copy of
+// the data which replaces the original when committed.
+type memoryStore struct {
+	mu   sync.RWMutex
+	data *memoryData
+}
+
+// NewMemoryStore returns an empty Store which keeps its content in memory.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		data: &memoryData{
+			stories:   make(map[int64]*storypb.Story),
+			storyLocs: make(map[int64][]string),
+			storyActs: make(map[int64][]string),
+			items:     make(map[int64][]*storypb.Item),
+			locations: make(map[string]*storypb.Location),
+			actions:   make(map[string]*storypb.Action),
+			games:     make(map[int64]*memoryGame),
+			turns:     make(map[int64]map[int64]*storypb.TurnRecord),
+		},
+	}
+}
+
+func (s *memoryStore) Begin(ctx context.Context, readOnly bool) (Txn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if readOnly {
+		s.mu.RLock()
+		return &memoryTxn{store: s, data: s.data, readOnly: true}, nil
+	}
+	s.mu.Lock()
+	return &memoryTxn{store: s, data: s.data.clone()}, nil
+}
+
+type memoryTxn struct {
+	store    *memoryStore
+	data     *memoryData
+	readOnly bool
+	done     bool
+}
+
+var errReadOnly = errors.New("write in read-only transaction")
+
+func (t *memoryTxn) finish(commit bool) error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	if t.readOnly {
+		t.store.mu.RUnlock()
+		return nil
+	}
+	if commit {
+		t.store.data = t.data
+	}
+	t.store.mu.Unlock()
+	return nil
+}
+
+func (t *memoryTxn) Commit() error {
+	return t.finish(true)
+}
+
+func (t *memoryTxn) Rollback() error {
+	return t.finish(false)
+}
+
+// writable returns an error if the transaction may not write.
+func (t *memoryTxn) writable() error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	return nil
+}
+
+func (t *memoryTxn) CreateStory(ctx context.Context, title string) (int64, error) {
+	if err := t.writable(); err != nil {
+		return 0, err
+	}
+	t.data.lastStory++
+	sid := t.data.lastStory
+	t.data.stories[sid] = &storypb.Story{
+		Id:    proto.Int64(sid),
+		Title: proto.String(title),
+	}
+	return sid, nil
+}
+
+func (t *memoryTxn) LoadStory(ctx context.Context, sid int64) (*storypb.Story, error) {
+	str, ok := t.data.stories[sid]
+	if !ok {
+		return nil, fmt.Errorf("no story %d: %w", sid, sql.ErrNoRows)
+	}
+	return proto.Clone(str).(*storypb.Story), nil
+}
+
+func (t *memoryTxn) LoadStories(ctx context.Context) ([]*storypb.Story, error) {
+	ret := make([]*storypb.Story, 0, len(t.data.stories))
+	for _, sid := range slices.Sorted(maps.Keys(t.data.stories)) {
+		ret = append(ret, proto.Clone(t.data.stories[sid]).(*storypb.Story))
+	}
+	return ret, nil
+}
+
+func (t *memoryTxn) WriteStory(ctx context.Context, str *storypb.Story) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	// As for an SQL update, missing stories are not created.
+	if _, ok := t.data.stories[str.GetId()]; ok {
+		str.Revision = newRevision()
+		t.data.stories[str.GetId()] = proto.Clone(str).(*storypb.Story)
+	}
+	return nil
+}
+
+func (t *memoryTxn) DeleteStory(ctx context.Context, sid int64) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	delete(t.data.stories, sid)
+	delete(t.data.storyLocs, sid)
+	delete(t.data.storyActs, sid)
+	delete(t.data.items, sid)
+	return nil
+}
+
+func (t *memoryTxn) StoryLocations(ctx context.Context, sid int64) ([]*storypb.Location, error) {
+	lids := t.data.storyLocs[sid]
+	ret := make([]*storypb.Location, 0, len(lids))
+	for _, lid := range lids {
+		ret = append(ret, proto.Clone(t.data.locations[lid]).(*storypb.Location))
+	}
+	return ret, nil
+}
+
+func (t *memoryTxn) SetStoryLocations(ctx context.Context, sid int64, lids []string) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	if _, ok := t.data.stories[sid]; !ok {
+		return fmt.Errorf("no story %d: %w", sid, sql.ErrNoRows)
+	}
+	for _, lid := range lids {
+		if _, ok := t.data.locations[lid]; !ok {
+			return fmt.Errorf("no location %s for story %d: %w", lid, sid, sql.ErrNoRows)
+		}
+	}
+	t.data.storyLocs[sid] = slices.Compact(slices.Sorted(slices.Values(lids)))
+	return nil
+}
+
+func (t *memoryTxn) StoryActions(ctx context.Context, sid int64) ([]*storypb.Action, error) {
+	aids := t.data.storyActs[sid]
+	ret := make([]*storypb.Action, 0, len(aids))
+	for _, aid := range aids {
+		ret = append(ret, proto.Clone(t.data.actions[aid]).(*storypb.Action))
+	}
+	return ret, nil
+}
+
+func (t *memoryTxn) SetStoryActions(ctx context.Context, sid int64, aids []string) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	if _, ok := t.data.stories[sid]; !ok {
+		return fmt.Errorf("no story %d: %w", sid, sql.ErrNoRows)
+	}
+	for _, aid := range aids {
+		if _, ok := t.data.actions[aid]; !ok {
+			return fmt.Errorf("no action %s for story %d: %w", aid, sid, sql.ErrNoRows)
+		}
+	}
+	t.data.storyActs[sid] = slices.Compact(slices.Sorted(slices.Values(aids)))
+	return nil
+}
+
+func (t *memoryTxn) StoryItems(ctx context.Context, sid int64) ([]*storypb.Item, error) {
+	items := t.data.items[sid]
+	ret := make([]*storypb.Item, 0, len(items))
+	for _, item := range items {
+		ret = append(ret, proto.Clone(item).(*storypb.Item))
+	}
+	return ret, nil
+}
+
+func (t *memoryTxn) SetStoryItems(ctx context.Context, sid int64, items []*storypb.Item) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	if _, ok := t.data.stories[sid]; !ok {
+		return fmt.Errorf("no story %d: %w", sid, sql.ErrNoRows)
+	}
+	stored := make([]*storypb.Item, 0, len(items))
+	for _, item := range items {
+		if slices.ContainsFunc(stored, func(prev *storypb.Item) bool { return prev.GetId() == item.GetId() }) {
+			return newError(codes.AlreadyExists, "duplicate item %s in story %d", item.GetId(), sid)
+		}
+		stored = append(stored, proto.Clone(item).(*storypb.Item))
+	}
+	slices.SortFunc(stored, func(a, b *storypb.Item) int {
+		return strings.Compare(a.GetId(), b.GetId())
+	})
+	t.data.items[sid] = stored
+	return nil
+}
+
+func (t *memoryTxn) CreateLocation(ctx context.Context, loc *storypb.Location) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	if _, ok := t.data.locations[loc.GetId()]; ok {
+		return newError(codes.AlreadyExists, "location %s already exists", loc.GetId())
+	}
+	loc.Revision = newRevision()
+	t.data.locations[loc.GetId()] = proto.Clone(loc).(*storypb.Location)
+	return nil
+}
+
+func (t *memoryTxn) WriteLocation(ctx context.Context, loc *storypb.Location) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	loc.Revision = newRevision()
+	t.data.locations[loc.GetId()] = proto.Clone(loc).(*storypb.Location)
+	return nil
+}
+
+func (t *memoryTxn) LoadLocation(ctx context.Context, lid string) (*storypb.Location, error) {
+	loc, ok := t.data.locations[lid]
+	if !ok {
+		return nil, fmt.Errorf("no location %s: %w", lid, sql.ErrNoRows)
+	}
+	return proto.Clone(loc).(*storypb.Location), nil
+}
+
+func (t *memoryTxn) LoadLocations(ctx context.Context) ([]*storypb.Location, error) {
+	ret := make([]*storypb.Location, 0, len(t.data.locations))
+	for _, lid := range slices.Sorted(maps.Keys(t.data.locations)) {
+		ret = append(ret, proto.Clone(t.data.locations[lid]).(*storypb.Location))
+	}
+	return ret, nil
+}
+
+func (t *memoryTxn) DeleteLocation(ctx context.Context, lid string) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	delete(t.data.locations, lid)
+	for sid, lids := range t.data.storyLocs {
+		if slices.Contains(lids, lid) {
+			t.data.storyLocs[sid] = slices.DeleteFunc(slices.Clone(lids), func(id string) bool { return id == lid })
+		}
+	}
+	return nil
+}
+
+func (t *memoryTxn) ActionLocations(ctx context.Context, aid string) ([]*storypb.Location, error) {
+	ret := make([]*storypb.Location, 0, 10)
+	for _, lid := range slices.Sorted(maps.Keys(t.data.locations)) {
+		loc := t.data.locations[lid]
+		if slices.ContainsFunc(loc.GetPossibleActions(), func(cond *storypb.ActionCondition) bool { return cond.GetActionId() == aid }) {
+			ret = append(ret, proto.Clone(loc).(*storypb.Location))
+		}
+	}
+	return ret, nil
+}
+
+func (t *memoryTxn) ActionStories(ctx context.Context, aid string) ([]*storypb.Story, error) {
+	ret := make([]*storypb.Story, 0, 10)
+	for _, sid := range slices.Sorted(maps.Keys(t.data.stories)) {
+		if slices.Contains(t.data.storyActs[sid], aid) {
+			ret = append(ret, proto.Clone(t.data.stories[sid]).(*storypb.Story))
+		}
+	}
+	return ret, nil
+}
+
+func (t *memoryTxn) CreateAction(ctx context.Context, act *storypb.Action) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	if _, ok := t.data.actions[act.GetId()]; ok {
+		return newError(codes.AlreadyExists, "action %s already exists", act.GetId())
+	}
+	act.Revision = newRevision()
+	t.data.actions[act.GetId()] = proto.Clone(act).(*storypb.Action)
+	return nil
+}
+
+func (t *memoryTxn) WriteAction(ctx context.Context, act *storypb.Action) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	act.Revision = newRevision()
+	t.data.actions[act.GetId()] = proto.Clone(act).(*storypb.Action)
+	return nil
+}
+
+func (t *memoryTxn) LoadAction(ctx context.Context, aid string) (*storypb.Action, error) {
+	act, ok := t.data.actions[aid]
+	if !ok {
+		return nil, fmt.Errorf("no action %s: %w", aid, sql.ErrNoRows)
+	}
+	return proto.Clone(act).(*storypb.Action), nil
+}
+
+func (t *memoryTxn) LoadActions(ctx context.Context, aids ...string) ([]*storypb.Action, error) {
+	var ret []*storypb.Action
+	for _, aid := range slices.Compact(slices.Sorted(slices.Values(aids))) {
+		if act, ok := t.data.actions[aid]; ok {
+			ret = append(ret, proto.Clone(act).(*storypb.Action))
+		}
+	}
+	return ret, nil
+}
+
+func (t *memoryTxn) LoadAllActions(ctx context.Context) ([]*storypb.Action, error) {
+	ret := make([]*storypb.Action, 0, len(t.data.actions))
+	for _, aid := range slices.Sorted(maps.Keys(t.data.actions)) {
+		ret = append(ret, proto.Clone(t.data.actions[aid]).(*storypb.Action))
+	}
+	return ret, nil
+}
+
+func (t *memoryTxn) DeleteAction(ctx context.Context, aid string) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	delete(t.data.actions, aid)
+	for sid, aids := range t.data.storyActs {
+		if slices.Contains(aids, aid) {
+			t.data.storyActs[sid] = slices.DeleteFunc(slices.Clone(aids), func(id string) bool { return id == aid })
+		}
+	}
+	return nil
+}
+
+func (t *memoryTxn) CreateGame(ctx context.Context, game *storypb.Playthrough, narration string) (int64, error) {
+	if err := t.writable(); err != nil {
+		return 0, err
+	}
+	if game.Slot != nil {
+		if used, _ := t.SlotUsed(ctx, game.GetParentId(), game.GetSlot()); used {
+			return 0, newError(codes.AlreadyExists, "save slot %q of playthrough %d already used", game.GetSlot(), game.GetParentId())
+		}
+	}
+	t.data.lastGame++
+	gid := t.data.lastGame
+	stored := proto.Clone(game).(*storypb.Playthrough)
+	stored.Id = proto.Int64(gid)
+	if game.ParentId == nil {
+		stored.ParentTurn = nil
+	}
+	t.data.games[gid] = &memoryGame{game: stored, narration: narration}
+	t.data.turns[gid] = make(map[int64]*storypb.TurnRecord)
+	return gid, nil
+}
+
+func (t *memoryTxn) LoadGame(ctx context.Context, gid int64) (*storypb.Playthrough, string, error) {
+	mg, ok := t.data.games[gid]
+	if !ok {
+		return nil, "", fmt.Errorf("no playthrough %d: %w", gid, sql.ErrNoRows)
+	}
+	return proto.Clone(mg.game).(*storypb.Playthrough), mg.narration, nil
+}
+
+func (t *memoryTxn) WriteGame(ctx context.Context, game *storypb.Playthrough, narration string) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	gid := game.GetId()
+	prev, ok := t.data.games[gid]
+	if !ok {
+		return nil
+	}
+	stored := proto.Clone(game).(*storypb.Playthrough)
+	stored.ParentId = prev.game.ParentId
+	stored.ParentTurn = prev.game.ParentTurn
+	stored.Slot = prev.game.Slot
+	t.data.games[gid] = &memoryGame{game: stored, narration: narration}
+	return nil
+}
+
+func (t *memoryTxn) LoadGames(ctx context.Context) ([]*storypb.Playthrough, error) {
+	ret := make([]*storypb.Playthrough, 0, len(t.data.games))
+	for _, gid := range slices.Sorted(maps.Keys(t.data.games)) {
+		ret = append(ret, proto.Clone(t.data.games[gid].game).(*storypb.Playthrough))
+	}
+	return ret, nil
+}
+
+func (t *memoryTxn) SlotUsed(ctx context.Context, gid int64, slot string) (bool, error) {
+	for _, mg := range t.data.games {
+		if mg.game.ParentId != nil && mg.game.GetParentId() == gid && mg.game.Slot != nil && mg.game.GetSlot() == slot {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (t *memoryTxn) CreateTurn(ctx context.Context, gid int64, rec *storypb.TurnRecord) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	recs, ok := t.data.turns[gid]
+	if !ok {
+		return fmt.Errorf("no playthrough %d: %w", gid, sql.ErrNoRows)
+	}
+	if _, ok := recs[rec.GetTurn()]; ok {
+		return newError(codes.AlreadyExists, "turn %d of playthrough %d already recorded", rec.GetTurn(), gid)
+	}
+	// Normalize the record as the SQL columns would.
+	stored := proto.Clone(rec).(*storypb.TurnRecord)
+	stored.Turn = proto.Int64(rec.GetTurn())
+	if len(rec.GetActionId()) == 0 {
+		stored.ActionId = nil
+	}
+	stored.Narrator = proto.String(rec.GetNarrator())
+	stored.Narration = proto.String(rec.GetNarration())
+	recs[rec.GetTurn()] = stored
+	return nil
+}
+
+func (t *memoryTxn) LoadTurns(ctx context.Context, gid, from, limit int64) ([]*storypb.TurnRecord, error) {
+	recs := t.data.turns[gid]
+	ret := make([]*storypb.TurnRecord, 0, min(limit, int64(len(recs))))
+	for _, turn := range slices.Sorted(maps.Keys(recs)) {
+		if int64(len(ret)) >= limit {
+			break
+		}
+		if turn >= from {
+			ret = append(ret, proto.Clone(recs[turn]).(*storypb.TurnRecord))
+		}
+	}
+	return ret, nil
+}
+
+func (t *memoryTxn) DeleteTurns(ctx context.Context, gid, after int64) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	maps.DeleteFunc(t.data.turns[gid], func(turn int64, _ *storypb.TurnRecord) bool {
+		return turn > after
+	})
+	return nil
+}
+
+func (t *memoryTxn) CopyTurns(ctx context.Context, from, to int64) error {
+	if err := t.writable(); err != nil {
+		return err
+	}
+	for _, rec := range t.data.turns[from] {
+		if err := t.CreateTurn(ctx, to, rec); err != nil {
+			return fmt.Errorf("could not copy history of playthrough %d: %w", from, err)
+		}
+	}
+	return nil
+}
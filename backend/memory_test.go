@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	st := NewMemoryStore()
+	loc := &storypb.Location{Id: proto.String("cave"), Title: proto.String("Cave")}
+
+	// Rolled-back writes are forgotten.
+	txn, err := st.Begin(ctx, false)
+	if err != nil {
+		t.Fatalf("Begin() => %v", err)
+	}
+	if err := txn.CreateLocation(ctx, loc); err != nil {
+		t.Fatalf("CreateLocation() => %v", err)
+	}
+	if err := txn.Rollback(); err != nil {
+		t.Fatalf("Rollback() => %v", err)
+	}
+	txn, err = st.Begin(ctx, true)
+	if err != nil {
+		t.Fatalf("Begin() => %v", err)
+	}
+	if _, err := txn.LoadLocation(ctx, "cave"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("LoadLocation() after rollback => %v, want %v", err, sql.ErrNoRows)
+	}
+	if err := txn.WriteLocation(ctx, loc); err == nil {
+		t.Errorf("WriteLocation() in read-only transaction succeeded, want error")
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("Commit() => %v", err)
+	}
+
+	// Committed writes are kept, and loads do not share the stored protos.
+	txn, err = st.Begin(ctx, false)
+	if err != nil {
+		t.Fatalf("Begin() => %v", err)
+	}
+	sid, err := txn.CreateStory(ctx, "Spelunking")
+	if err != nil {
+		t.Fatalf("CreateStory() => %v", err)
+	}
+	if err := txn.CreateLocation(ctx, loc); err != nil {
+		t.Fatalf("CreateLocation() => %v", err)
+	}
+	if err := txn.CreateLocation(ctx, loc); err == nil {
+		t.Errorf("CreateLocation() with existing ID succeeded, want error")
+	}
+	if err := txn.SetStoryLocations(ctx, sid, []string{"cave"}); err != nil {
+		t.Fatalf("SetStoryLocations() => %v", err)
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("Commit() => %v", err)
+	}
+	if err := txn.Commit(); !errors.Is(err, sql.ErrTxDone) {
+		t.Errorf("second Commit() => %v, want %v", err, sql.ErrTxDone)
+	}
+	loc.Title = proto.String("Changed")
+
+	txn, err = st.Begin(ctx, false)
+	if err != nil {
+		t.Fatalf("Begin() => %v", err)
+	}
+	got, err := txn.StoryLocations(ctx, sid)
+	if err != nil {
+		t.Fatalf("StoryLocations() => %v", err)
+	}
+	want := []*storypb.Location{{Id: proto.String("cave"), Title: proto.String("Cave"), Revision: proto.String(loc.GetRevision())}}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("StoryLocations() => diff (-want +got)\n%s", diff)
+	}
+	got[0].Title = proto.String("Changed")
+
+	// Deleting the location removes it from the story.
+	if err := txn.DeleteLocation(ctx, "cave"); err != nil {
+		t.Fatalf("DeleteLocation() => %v", err)
+	}
+	if got, err := txn.StoryLocations(ctx, sid); err != nil || len(got) > 0 {
+		t.Errorf("StoryLocations() after deletion => %v, %v, want none", got, err)
+	}
+	if err := txn.Rollback(); err != nil {
+		t.Fatalf("Rollback() => %v", err)
+	}
+
+	txn, err = st.Begin(ctx, true)
+	if err != nil {
+		t.Fatalf("Begin() => %v", err)
+	}
+	defer txn.Commit()
+	if got, err := txn.LoadLocation(ctx, "cave"); err != nil || got.GetTitle() != "Cave" {
+		t.Errorf("LoadLocation() => %v, %v, want title %q", got, err, "Cave")
+	}
+}
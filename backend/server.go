@@ -3,7 +3,7 @@ package handlers
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"maps"
@@ -11,8 +11,10 @@ import (
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/kingofmen/cyoa-exploratory/logic"
 	"github.com/kingofmen/cyoa-exploratory/narrate"
 	"github.com/kingofmen/cyoa-exploratory/story"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/protobuf/proto"
 
 	spb "github.com/kingofmen/cyoa-exploratory/backend/proto"
@@ -24,18 +26,22 @@ const (
 )
 
 type Server struct {
-	db        *sql.DB
+	spb.UnimplementedCyoaServer
+	store     Store
 	tellers   map[string]*narrateInfo
 	tellerKey string
+	// If set, GameState honours the author flag. There is no
+	// authentication; enable it only where every caller is trusted.
+	authors bool
 }
 
 type narrateInfo struct {
 	narrate.Narrator
 }
 
-func New(db *sql.DB) *Server {
+func New(st Store) *Server {
 	return &Server{
-		db: db,
+		store: st,
 		tellers: map[string]*narrateInfo{
 			"noop":         &narrateInfo{Narrator: narrate.NewNoop()},
 			debugTellerKey: &narrateInfo{Narrator: narrate.NewDebug()},
@@ -46,24 +52,33 @@ func New(db *sql.DB) *Server {
 
 func (s *Server) WithNarrator(key string, n narrate.Narrator) *Server {
 	if s == nil {
-		s = New(nil)
+		s = New(NewMemoryStore())
 	}
 	s.tellers[key] = &narrateInfo{Narrator: n}
 	s.tellerKey = key
 	return s
 }
 
+// WithAuthors lets GameState requests ask for condition traces.
+func (s *Server) WithAuthors(on bool) *Server {
+	if s == nil {
+		s = New(NewMemoryStore())
+	}
+	s.authors = on
+	return s
+}
+
 func (s *Server) CreateLocation(ctx context.Context, req *spb.CreateLocationRequest) (*spb.CreateLocationResponse, error) {
 	loc := req.GetLocation()
 	if loc == nil {
-		return nil, fmt.Errorf("CreateLocation called with nil location")
+		return nil, newError(codes.InvalidArgument, "CreateLocation called with nil location")
 	}
 	if len(loc.GetTitle()) < 1 {
-		return nil, fmt.Errorf("cannot create location with empty title")
+		return nil, newError(codes.InvalidArgument, "cannot create location with empty title")
 	}
-	resp, err := createLocationImpl(ctx, s.db, loc)
+	resp, err := createLocationImpl(ctx, s.store, loc)
 	if err != nil {
-		return nil, fmt.Errorf("CreateLocation error: %w", err)
+		return nil, wrapError("CreateLocation error", err)
 	}
 	return resp, nil
 }
@@ -71,18 +86,18 @@ func (s *Server) CreateLocation(ctx context.Context, req *spb.CreateLocationRequ
 func (s *Server) UpdateLocation(ctx context.Context, req *spb.UpdateLocationRequest) (*spb.UpdateLocationResponse, error) {
 	loc := req.GetLocation()
 	if loc == nil {
-		return nil, fmt.Errorf("UpdateLocation called with nil location")
+		return nil, newError(codes.InvalidArgument, "UpdateLocation called with nil location")
 	}
 	if len(loc.GetTitle()) < 1 {
-		return nil, fmt.Errorf("cannot update location to have empty title")
+		return nil, newError(codes.InvalidArgument, "cannot update location to have empty title")
 	}
 	lid := req.GetLocationId()
 	if err := uuid.Validate(lid); err != nil {
-		return nil, fmt.Errorf("invalid location ID %q: %w", lid, err)
+		return nil, newError(codes.InvalidArgument, "invalid location ID %q: %w", lid, err)
 	}
-	resp, err := updateLocationImpl(ctx, s.db, lid, loc)
+	resp, err := updateLocationImpl(ctx, s.store, lid, loc)
 	if err != nil {
-		return nil, fmt.Errorf("UpdateLocation error: %w", err)
+		return nil, wrapError("UpdateLocation error", err)
 	}
 	return resp, nil
 }
@@ -90,11 +105,11 @@ func (s *Server) UpdateLocation(ctx context.Context, req *spb.UpdateLocationRequ
 func (s *Server) DeleteLocation(ctx context.Context, req *spb.DeleteLocationRequest) (*spb.DeleteLocationResponse, error) {
 	lid := req.GetLocationId()
 	if err := uuid.Validate(lid); err != nil {
-		return nil, fmt.Errorf("invalid location ID %q: %w", lid, err)
+		return nil, newError(codes.InvalidArgument, "invalid location ID %q: %w", lid, err)
 	}
-	resp, err := deleteLocationImpl(ctx, s.db, lid)
+	resp, err := deleteLocationImpl(ctx, s.store, lid)
 	if err != nil {
-		return nil, fmt.Errorf("DeleteLocation error: %w", err)
+		return nil, wrapError("DeleteLocation error", err)
 	}
 	return resp, nil
 }
@@ -102,25 +117,141 @@ func (s *Server) DeleteLocation(ctx context.Context, req *spb.DeleteLocationRequ
 func (s *Server) GetLocation(ctx context.Context, req *spb.GetLocationRequest) (*spb.GetLocationResponse, error) {
 	lid := req.GetLocationId()
 	if err := uuid.Validate(lid); err != nil {
-		return nil, fmt.Errorf("invalid location ID %q: %w", lid, err)
+		return nil, newError(codes.InvalidArgument, "invalid location ID %q: %w", lid, err)
 	}
-	resp, err := getLocationImpl(ctx, s.db, lid)
+	resp, err := getLocationImpl(ctx, s.store, lid)
 	if err != nil {
-		return nil, fmt.Errorf("GetLocation error: %w", err)
+		return nil, wrapError("GetLocation error", err)
 	}
 	return resp, nil
 }
 
 func (s *Server) ListLocations(ctx context.Context, req *spb.ListLocationsRequest) (*spb.ListLocationsResponse, error) {
-	resp, err := listLocationsImpl(ctx, s.db, req)
+	resp, err := listLocationsImpl(ctx, s.store, req)
 	if err != nil {
-		return nil, fmt.Errorf("ListLocations error: %w", err)
+		return nil, wrapError("ListLocations error", err)
 	}
 	return resp, nil
 }
 
-func validateContent(content *spb.StoryContent) ([]*storypb.Location, []*storypb.Action, error) {
-	locs, acts := content.GetLocations(), content.GetActions()
+// checkTypes returns an error for every condition or effect in the
+// story and its content that does not match the declared variables.
+// Stories that declare no variables may use any variable, but their
+// scoped keys, expressions and operations are still checked.
+func checkTypes(str *storypb.Story, locs []*storypb.Location, acts []*storypb.Action, items []*storypb.Item) error {
+	schema, err := story.Schema(str)
+	if err != nil {
+		return fmt.Errorf("bad variable declarations: %w", err)
+	}
+	if len(str.GetVariables()) == 0 {
+		schema.Open()
+	}
+	schema.WithScope(story.InventoryScope, story.InventorySchema(items))
+	schema.WithScope(story.CharacterScope, story.CharacterSchema(str))
+	schema.WithScope(story.GameScope, story.GameSchema())
+	checkTrigger := func(tap *storypb.TriggerAction) error {
+		return errors.Join(story.CheckTrigger(tap, schema), story.CheckChoices(tap, str))
+	}
+	var errs []error
+	for _, decl := range str.GetVariables() {
+		if ex := decl.GetInitialExpr(); len(ex) > 0 {
+			if err := logic.CheckInt(ex, schema); err != nil {
+				errs = append(errs, fmt.Errorf("initial value of %q: %w", decl.GetName(), err))
+			}
+		}
+	}
+	for cidx, cand := range str.GetGlobalActions() {
+		if err := logic.Check(cand.GetCondition(), schema); err != nil {
+			errs = append(errs, fmt.Errorf("story global action %d: %w", cidx, err))
+		}
+	}
+	for _, reg := range str.GetRegions() {
+		for cidx, cand := range reg.GetPossibleActions() {
+			if err := logic.Check(cand.GetCondition(), schema); err != nil {
+				errs = append(errs, fmt.Errorf("region %q possible action %d: %w", reg.GetTitle(), cidx, err))
+			}
+		}
+	}
+	for _, loc := range locs {
+		if err := story.CheckDescription(loc.GetDescription(), loc.GetVariants(), schema); err != nil {
+			errs = append(errs, fmt.Errorf("location %q description: %w", loc.GetTitle(), err))
+		}
+		for cidx, cand := range loc.GetPossibleActions() {
+			if err := logic.Check(cand.GetCondition(), schema); err != nil {
+				errs = append(errs, fmt.Errorf("location %q possible action %d: %w", loc.GetTitle(), cidx, err))
+			}
+		}
+		for tidx, trg := range loc.GetOnEnter() {
+			if err := checkTrigger(trg); err != nil {
+				errs = append(errs, fmt.Errorf("location %q entry trigger %d: %w", loc.GetTitle(), tidx, err))
+			}
+		}
+		for tidx, trg := range loc.GetOnExit() {
+			if err := checkTrigger(trg); err != nil {
+				errs = append(errs, fmt.Errorf("location %q exit trigger %d: %w", loc.GetTitle(), tidx, err))
+			}
+		}
+	}
+	for _, act := range acts {
+		if err := story.CheckDescription(act.GetDescription(), act.GetVariants(), schema); err != nil {
+			errs = append(errs, fmt.Errorf("action %q description: %w", act.GetTitle(), err))
+		}
+		for tidx, trg := range act.GetTriggers() {
+			if err := checkTrigger(trg); err != nil {
+				errs = append(errs, fmt.Errorf("action %q trigger %d: %w", act.GetTitle(), tidx, err))
+			}
+		}
+	}
+	for eidx, evt := range str.GetEvents() {
+		if err := checkTrigger(evt); err != nil {
+			errs = append(errs, fmt.Errorf("story event %d: %w", eidx, err))
+		}
+	}
+	for tidx, trg := range str.GetOnStart() {
+		if err := checkTrigger(trg); err != nil {
+			errs = append(errs, fmt.Errorf("story start trigger %d: %w", tidx, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkReferences returns an error if any effect of the triggers
+// names a location or item not in the story.
+func checkReferences(where string, taps []*storypb.TriggerAction, lids, iids map[string]bool) error {
+	for tidx, trg := range taps {
+		for eidx, eff := range trg.GetEffects() {
+			if nlid := eff.GetNewLocationId(); len(nlid) > 0 && !lids[nlid] {
+				return fmt.Errorf("%s trigger %d/%d has bad location ID %q", where, tidx, eidx, nlid)
+			}
+			for _, it := range eff.GetItemTweaks() {
+				iid := it.GetItemId()
+				if !iids[iid] {
+					return fmt.Errorf("%s trigger %d/%d has bad item ID %q", where, tidx, eidx, iid)
+				}
+				if it.Quantity != nil && it.GetQuantity() < 1 && it.GetOperation() != storypb.ItemTweak_IT_DROP {
+					return fmt.Errorf("%s trigger %d/%d has non-positive quantity %d of item %q", where, tidx, eidx, it.GetQuantity(), iid)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func validateContent(str *storypb.Story, content *spb.StoryContent) ([]*storypb.Location, []*storypb.Action, error) {
+	locs, acts, items := content.GetLocations(), content.GetActions(), content.GetItems()
+	if err := story.CheckItems(items); err != nil {
+		return nil, nil, err
+	}
+	if err := story.CheckCharacters(str); err != nil {
+		return nil, nil, err
+	}
+	if err := story.CheckRegions(str, locs); err != nil {
+		return nil, nil, err
+	}
+	iids := make(map[string]bool)
+	for _, item := range items {
+		iids[item.GetId()] = true
+	}
 	lids, aids := make(map[string]bool), make(map[string]bool)
 	for _, loc := range locs {
 		lid := loc.GetId()
@@ -135,11 +266,25 @@ func validateContent(content *spb.StoryContent) ([]*storypb.Location, []*storypb
 			return nil, nil, fmt.Errorf("invalid action ID %q for %q: %w", aid, act.GetTitle(), err)
 		}
 		aids[aid] = true
-		for tidx, trg := range act.GetTriggers() {
-			for eidx, eff := range trg.GetEffects() {
-				if nlid := eff.GetNewLocationId(); len(nlid) > 0 && !lids[nlid] {
-					return nil, nil, fmt.Errorf("action %q trigger %d/%d has bad location ID %q", act.GetTitle(), tidx, eidx, nlid)
-				}
+		if err := checkReferences(fmt.Sprintf("action %q", act.GetTitle()), act.GetTriggers(), lids, iids); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := checkReferences("story start", str.GetOnStart(), lids, iids); err != nil {
+		return nil, nil, err
+	}
+	if err := checkReferences("story event", str.GetEvents(), lids, iids); err != nil {
+		return nil, nil, err
+	}
+	for cidx, cand := range str.GetGlobalActions() {
+		if caid := cand.GetActionId(); !aids[caid] {
+			return nil, nil, fmt.Errorf("story global action %d has bad action ID %q", cidx, caid)
+		}
+	}
+	for _, reg := range str.GetRegions() {
+		for cidx, cand := range reg.GetPossibleActions() {
+			if caid := cand.GetActionId(); !aids[caid] {
+				return nil, nil, fmt.Errorf("region %q possible action %d has bad action ID %q", reg.GetTitle(), cidx, caid)
 			}
 		}
 	}
@@ -150,6 +295,15 @@ func validateContent(content *spb.StoryContent) ([]*storypb.Location, []*storypb
 				return nil, nil, fmt.Errorf("location %q possible action %d has bad action ID %q", loc.GetTitle(), cidx, caid)
 			}
 		}
+		if err := checkReferences(fmt.Sprintf("location %q entry", loc.GetTitle()), loc.GetOnEnter(), lids, iids); err != nil {
+			return nil, nil, err
+		}
+		if err := checkReferences(fmt.Sprintf("location %q exit", loc.GetTitle()), loc.GetOnExit(), lids, iids); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := checkTypes(str, locs, acts, items); err != nil {
+		return nil, nil, err
 	}
 	return locs, acts, nil
 }
@@ -157,16 +311,16 @@ func validateContent(content *spb.StoryContent) ([]*storypb.Location, []*storypb
 func (s *Server) UpdateStory(ctx context.Context, req *spb.UpdateStoryRequest) (*spb.UpdateStoryResponse, error) {
 	str := req.GetStory()
 	if str == nil {
-		return nil, fmt.Errorf("UpdateStory called with nil story")
+		return nil, newError(codes.InvalidArgument, "UpdateStory called with nil story")
 	}
-	locs, acts, err := validateContent(req.GetContent())
+	locs, acts, err := validateContent(str, req.GetContent())
 	if err != nil {
-		return nil, fmt.Errorf("content validation failed: %w", err)
+		return nil, newError(codes.InvalidArgument, "content validation failed: %w", err)
 	}
 
-	txn, err := s.db.BeginTx(ctx, nil)
+	txn, err := s.store.Begin(ctx, false)
 	if err != nil {
-		return nil, fmt.Errorf("could not begin transaction: %w", err)
+		return nil, wrapError("could not begin transaction", err)
 	}
 
 	resp, err := updateStoryImpl(ctx, txn, str)
@@ -176,30 +330,32 @@ func (s *Server) UpdateStory(ctx context.Context, req *spb.UpdateStoryRequest) (
 
 	locIds := make(map[string]bool)
 	for idx, loc := range locs {
-		locs[idx], err = createOrUpdateLocation(ctx, txn, loc.GetId(), loc)
-		if err != nil {
+		if err := txn.WriteLocation(ctx, loc); err != nil {
 			return nil, txnError(fmt.Sprintf("could not update location %q", loc.GetTitle()), txn, err)
 		}
 		locIds[locs[idx].GetId()] = true
 	}
 
-	if err := updateStoryLocationsTable(ctx, txn, resp.GetStory().GetId(), slices.Collect(maps.Keys(locIds))); err != nil {
+	if err := txn.SetStoryLocations(ctx, resp.GetStory().GetId(), slices.Collect(maps.Keys(locIds))); err != nil {
 		return nil, txnError("could not update story-location relationships", txn, err)
 	}
 
 	actIds := make(map[string]bool)
 	for idx, act := range acts {
-		acts[idx], err = createOrUpdateAction(ctx, txn, act.GetId(), act)
-		if err != nil {
+		if err := txn.WriteAction(ctx, act); err != nil {
 			return nil, txnError(fmt.Sprintf("could not update action %q", act.GetTitle()), txn, err)
 		}
 		actIds[acts[idx].GetId()] = true
 	}
 
-	if err := updateStoryActionsTable(ctx, txn, resp.GetStory().GetId(), slices.Collect(maps.Keys(actIds))); err != nil {
+	if err := txn.SetStoryActions(ctx, resp.GetStory().GetId(), slices.Collect(maps.Keys(actIds))); err != nil {
 		return nil, txnError("could not update story-action relationships", txn, err)
 	}
 
+	if err := txn.SetStoryItems(ctx, resp.GetStory().GetId(), req.GetContent().GetItems()); err != nil {
+		return nil, txnError("could not update story items", txn, err)
+	}
+
 	resp.Content = req.GetContent()
 	if err := txn.Commit(); err != nil {
 		return nil, txnError("could not commit to database", txn, err)
@@ -211,23 +367,31 @@ func (s *Server) UpdateStory(ctx context.Context, req *spb.UpdateStoryRequest) (
 func (s *Server) DeleteStory(ctx context.Context, req *spb.DeleteStoryRequest) (*spb.DeleteStoryResponse, error) {
 	sid := req.GetId()
 	if sid < 1 {
-		return nil, fmt.Errorf("DeleteStory called with invalid story ID %d", sid)
+		return nil, newError(codes.InvalidArgument, "DeleteStory called with invalid story ID %d", sid)
+	}
+	resp, err := deleteStoryImpl(ctx, s.store, sid)
+	if err != nil {
+		return nil, wrapError("DeleteStory error", err)
 	}
-	return deleteStoryImpl(ctx, s.db, sid)
+	return resp, nil
 }
 
 func (s *Server) GetStory(ctx context.Context, req *spb.GetStoryRequest) (*spb.GetStoryResponse, error) {
 	sid := req.GetId()
 	if sid < 1 {
-		return nil, fmt.Errorf("GetStory called with invalid story ID %d", sid)
+		return nil, newError(codes.InvalidArgument, "GetStory called with invalid story ID %d", sid)
+	}
+	resp, err := getStoryImpl(ctx, s.store, sid, req.GetView())
+	if err != nil {
+		return nil, wrapError("GetStory error", err)
 	}
-	return getStoryImpl(ctx, s.db, sid, req.GetView())
+	return resp, nil
 }
 
 func (s *Server) ListStories(ctx context.Context, req *spb.ListStoriesRequest) (*spb.ListStoriesResponse, error) {
-	resp, err := listStoriesImpl(ctx, s.db, req)
+	resp, err := listStoriesImpl(ctx, s.store, req)
 	if err != nil {
-		return nil, fmt.Errorf("ListStories error: %w", err)
+		return nil, wrapError("ListStories error", err)
 	}
 	return resp, nil
 }
@@ -235,14 +399,14 @@ func (s *Server) ListStories(ctx context.Context, req *spb.ListStoriesRequest) (
 func (s *Server) CreateAction(ctx context.Context, req *spb.CreateActionRequest) (*spb.CreateActionResponse, error) {
 	act := req.GetAction()
 	if act == nil {
-		return nil, fmt.Errorf("CreateAction called with nil action")
+		return nil, newError(codes.InvalidArgument, "CreateAction called with nil action")
 	}
 	if len(act.GetTitle()) < 1 {
-		return nil, fmt.Errorf("cannot create action with empty title")
+		return nil, newError(codes.InvalidArgument, "cannot create action with empty title")
 	}
-	resp, err := createActionImpl(ctx, s.db, act)
+	resp, err := createActionImpl(ctx, s.store, act)
 	if err != nil {
-		return nil, fmt.Errorf("CreateAction error: %w", err)
+		return nil, wrapError("CreateAction error", err)
 	}
 	return resp, nil
 }
@@ -250,143 +414,231 @@ func (s *Server) CreateAction(ctx context.Context, req *spb.CreateActionRequest)
 func (s *Server) UpdateAction(ctx context.Context, req *spb.UpdateActionRequest) (*spb.UpdateActionResponse, error) {
 	act := req.GetAction()
 	if act == nil {
-		return nil, fmt.Errorf("UpdateAction called with nil action")
+		return nil, newError(codes.InvalidArgument, "UpdateAction called with nil action")
+	}
+	if len(act.GetTitle()) < 1 {
+		return nil, newError(codes.InvalidArgument, "cannot update action to have empty title")
 	}
 	aid := act.GetId()
 	if err := uuid.Validate(aid); err != nil {
-		return nil, fmt.Errorf("invalid action ID %q: %w", aid, err)
+		return nil, newError(codes.InvalidArgument, "invalid action ID %q: %w", aid, err)
 	}
-	resp, err := updateActionImpl(ctx, s.db, act)
+	resp, err := updateActionImpl(ctx, s.store, act)
 	if err != nil {
-		return nil, fmt.Errorf("UpdateAction error: %w", err)
+		return nil, wrapError("UpdateAction error", err)
 	}
 	return resp, nil
 }
 
 func (s *Server) DeleteAction(ctx context.Context, req *spb.DeleteActionRequest) (*spb.DeleteActionResponse, error) {
-	return &spb.DeleteActionResponse{}, nil
+	aid := req.GetActionId()
+	if err := uuid.Validate(aid); err != nil {
+		return nil, newError(codes.InvalidArgument, "invalid action ID %q: %w", aid, err)
+	}
+	resp, err := deleteActionImpl(ctx, s.store, aid, req.GetRemoveReferences())
+	if err != nil {
+		return nil, wrapError("DeleteAction error", err)
+	}
+	return resp, nil
 }
 
 func (s *Server) GetAction(ctx context.Context, req *spb.GetActionRequest) (*spb.GetActionResponse, error) {
-	return &spb.GetActionResponse{}, nil
+	aid := req.GetActionId()
+	if err := uuid.Validate(aid); err != nil {
+		return nil, newError(codes.InvalidArgument, "invalid action ID %q: %w", aid, err)
+	}
+	resp, err := getActionImpl(ctx, s.store, aid)
+	if err != nil {
+		return nil, wrapError("GetAction error", err)
+	}
+	return resp, nil
 }
 
 func (s *Server) ListActions(ctx context.Context, req *spb.ListActionsRequest) (*spb.ListActionsResponse, error) {
-	return &spb.ListActionsResponse{}, nil
+	if sid := req.GetStoryId(); sid < 0 {
+		return nil, newError(codes.InvalidArgument, "ListActions called with bad story ID %d", sid)
+	}
+	resp, err := listActionsImpl(ctx, s.store, req)
+	if err != nil {
+		return nil, wrapError("ListActions error", err)
+	}
+	return resp, nil
 }
 
 func (s *Server) CreateGame(ctx context.Context, req *spb.CreateGameRequest) (*spb.CreateGameResponse, error) {
 	sid := req.GetStoryId()
 	if sid < 1 {
-		return nil, fmt.Errorf("CreateGame called with bad story ID %d", sid)
+		return nil, newError(codes.InvalidArgument, "CreateGame called with bad story ID %d", sid)
 	}
-	resp, err := createGameImpl(ctx, s.db, sid)
+	resp, err := createGameImpl(ctx, s.store, sid, req.GetCharacterId(), req.GetCustomCharacter())
 	if err != nil {
-		return nil, fmt.Errorf("CreateGame error: %w", err)
+		return nil, wrapError("CreateGame error", err)
 	}
 	return resp, nil
 }
 
 func (s *Server) ListGames(ctx context.Context, req *spb.ListGamesRequest) (*spb.ListGamesResponse, error) {
-	resp, err := listGamesImpl(ctx, s.db, req)
+	resp, err := listGamesImpl(ctx, s.store, req)
 	if err != nil {
-		return nil, fmt.Errorf("ListGames error: %w", err)
+		return nil, wrapError("ListGames error", err)
 	}
 	return resp, nil
 }
 
-func makeGameDisplay(event *storypb.GameEvent) *storypb.GameDisplay {
+func makeGameDisplay(event *storypb.GameEvent, author bool) *storypb.GameDisplay {
 	display := &storypb.GameDisplay{
 		Story:     summarize(event.GetStory()),
 		Location:  summarize(event.GetLocation()),
 		Narration: proto.String(event.GetNarration()),
 		RunState:  event.GetState().Enum(),
+		Inventory: event.GetInventory(),
+	}
+	if !event.GetStory().GetIronman() && event.GetTurn() > 0 {
+		display.CanUndo = proto.Bool(true)
 	}
 
-	acts := story.PossibleActions(event)
-	for _, act := range acts {
-		summary := identify(act)
+	for _, choice := range story.Choices(event) {
+		summary := identify(choice.Action)
+		if !choice.Enabled {
+			summary.Enabled = proto.Bool(false)
+			summary.DisabledReason = proto.String(choice.Reason)
+		}
 		display.Actions = append(display.Actions, summary)
 	}
+	if author {
+		display.Traces = story.Traces(event)
+	}
 
 	return display
 }
 
 func (s *Server) GameState(ctx context.Context, req *spb.GameStateRequest) (*spb.GameStateResponse, error) {
 	gid, aid := req.GetGameId(), req.GetActionId()
+	author := req.GetAuthor() && s.authors
 	if gid < 1 {
-		return nil, fmt.Errorf("GameState called with bad game ID %d", gid)
+		return nil, newError(codes.InvalidArgument, "GameState called with bad game ID %d", gid)
 	}
 	if len(aid) > 0 {
 		if err := uuid.Validate(aid); err != nil {
-			return nil, fmt.Errorf("GameState called with invalid action ID %q: %w", aid, err)
+			return nil, newError(codes.InvalidArgument, "GameState called with invalid action ID %q: %w", aid, err)
 		}
 	}
 
-	txn, err := s.db.BeginTx(ctx, nil)
+	txn, err := s.store.Begin(ctx, true)
 	if err != nil {
-		return nil, fmt.Errorf("could not begin read transaction for action %s in playthrough %d: %w", aid, gid, err)
+		return nil, wrapError(fmt.Sprintf("could not begin read transaction for action %s in playthrough %d", aid, gid), err)
 	}
 	gstate, err := loadStoryState(ctx, txn, gid, aid)
 	if err != nil {
 		return nil, txnError(fmt.Sprintf("could not load story state for action %s in playthrough %d", aid, gid), txn, err)
 	}
-	if err := txn.Commit(); err != nil {
-		return nil, txnError(fmt.Sprintf("could not commit read for action %s in playthrough %d", aid, gid), txn, err)
-	}
-
 	if gstate.GetPlayerAction() == nil {
+		if err := txn.Commit(); err != nil {
+			return nil, txnError(fmt.Sprintf("could not commit read for playthrough %d", gid), txn, err)
+		}
+		if err := story.Render(gstate); err != nil {
+			log.Printf("Could not render descriptions for playthrough %d: %v", gid, err)
+		}
 		return &spb.GameStateResponse{
-			State: makeGameDisplay(gstate),
+			State: makeGameDisplay(gstate, author),
 		}, nil
 	}
 
-	nstate, err := story.HandleEvent(gstate)
+	nstate, err := story.HandleEvent(gstate, &dbResolver{ctx: ctx, txn: txn})
 	if err != nil {
-		return nil, fmt.Errorf("could not apply action %s in game %d: %w", aid, gid, err)
+		var nerr *story.NotAllowedError
+		if errors.As(err, &nerr) {
+			err = withCode(codes.FailedPrecondition, err)
+		}
+		return nil, txnError(fmt.Sprintf("could not apply action %s in game %d", aid, gid), txn, err)
 	}
-
-	txn, err = s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return nil, fmt.Errorf("could not begin write transaction for action %s in playthrough %d: %w", aid, gid, err)
+	if err := txn.Commit(); err != nil {
+		return nil, txnError(fmt.Sprintf("could not commit read for action %s in playthrough %d", aid, gid), txn, err)
 	}
-	if nlid := nstate.GetLocation().GetId(); nlid != gstate.GetLocation().GetId() {
-		// New location, load from DB.
-		nloc, err := loadLocation(ctx, txn, nlid)
-		if err != nil {
-			return nil, txnError(fmt.Sprintf("could not load new location %s after action %s", nlid, aid), txn, err)
-		}
-		nstate.Location = nloc
-		acts, err := loadPossibleActions(ctx, txn, nloc)
-		if err != nil {
-			return nil, txnError(fmt.Sprintf("could not load new candidate actions for location %s after action %s", nlid, aid), txn, err)
-		}
-		nstate.CandidateActions = acts
+	// The narrator sees the same descriptions as the player.
+	if err := story.Render(gstate); err != nil {
+		log.Printf("Could not render descriptions before action %s in playthrough %d: %v", aid, gid, err)
+	}
+	if err := story.Render(nstate); err != nil {
+		log.Printf("Could not render descriptions after action %s in playthrough %d: %v", aid, gid, err)
 	}
 
-	tell, ok := s.tellers[s.tellerKey]
+	key := s.tellerKey
+	tell, ok := s.tellers[key]
 	if !ok {
-		log.Printf("No teller %q found, falling back on default %q", s.tellerKey, debugTellerKey)
-		tell = s.tellers[debugTellerKey]
+		log.Printf("No teller %q found, falling back on default %q", key, debugTellerKey)
+		key = debugTellerKey
+		tell = s.tellers[key]
 	}
 	content, err := tell.Event(ctx, gstate, nstate)
 	if err != nil {
-		return nil, fmt.Errorf("could not narrate action %s in game %d: %w", aid, gid, err)
+		return nil, newError(codes.Unavailable, "could not narrate action %s in game %d: %w", aid, gid, err)
 	}
+	rec := story.RecordTurn(gstate, nstate)
+	rec.Narrator = proto.String(key)
+	rec.Narration = proto.String(content)
+	rec.State = snapshot(gid, nstate)
 
 	if nn := gstate.GetNarration(); len(nn) > 0 {
 		content = strings.Join([]string{nn, content}, "\n")
 	}
 	nstate.Narration = proto.String(content)
 
+	txn, err = s.store.Begin(ctx, false)
+	if err != nil {
+		return nil, wrapError(fmt.Sprintf("could not begin write transaction for action %s in playthrough %d", aid, gid), err)
+	}
 	if err := writeAction(ctx, txn, gid, nstate, content); err != nil {
 		return nil, txnError(fmt.Sprintf("error writing action %s to playthrough %d", aid, gid), txn, err)
 	}
+	if err := txn.CreateTurn(ctx, gid, rec); err != nil {
+		return nil, txnError(fmt.Sprintf("error recording action %s in playthrough %d", aid, gid), txn, err)
+	}
 	if err := txn.Commit(); err != nil {
 		return nil, txnError(fmt.Sprintf("could not commit action %s to playthrough %d", aid, gid), txn, err)
 	}
 
 	return &spb.GameStateResponse{
-		State: makeGameDisplay(nstate),
+		State: makeGameDisplay(nstate, author),
 	}, nil
 }
+
+func (s *Server) GetGameHistory(ctx context.Context, req *spb.GetGameHistoryRequest) (*spb.GetGameHistoryResponse, error) {
+	if gid := req.GetGameId(); gid < 1 {
+		return nil, newError(codes.InvalidArgument, "GetGameHistory called with bad game ID %d", gid)
+	}
+	resp, err := getGameHistoryImpl(ctx, s.store, req)
+	if err != nil {
+		return nil, wrapError("GetGameHistory error", err)
+	}
+	return resp, nil
+}
+
+func (s *Server) RewindGame(ctx context.Context, req *spb.RewindGameRequest) (*spb.RewindGameResponse, error) {
+	gid := req.GetGameId()
+	if gid < 1 {
+		return nil, newError(codes.InvalidArgument, "RewindGame called with bad game ID %d", gid)
+	}
+	if err := rewindGameImpl(ctx, s.store, gid, req.Turn); err != nil {
+		return nil, wrapError("RewindGame error", err)
+	}
+	resp, err := s.GameState(ctx, &spb.GameStateRequest{GameId: proto.Int64(gid)})
+	if err != nil {
+		return nil, wrapError(fmt.Sprintf("could not load rewound playthrough %d", gid), err)
+	}
+	return &spb.RewindGameResponse{
+		State: resp.GetState(),
+	}, nil
+}
+
+func (s *Server) ForkGame(ctx context.Context, req *spb.ForkGameRequest) (*spb.ForkGameResponse, error) {
+	gid := req.GetGameId()
+	if gid < 1 {
+		return nil, newError(codes.InvalidArgument, "ForkGame called with bad game ID %d", gid)
+	}
+	resp, err := forkGameImpl(ctx, s.store, gid, req.GetSlot())
+	if err != nil {
+		return nil, wrapError("ForkGame error", err)
+	}
+	return resp, nil
+}
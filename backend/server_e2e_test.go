@@ -3,13 +3,16 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
+	"github.com/kingofmen/cyoa-exploratory/logic"
 	"github.com/pressly/goose/v3"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/mysql"
@@ -18,31 +21,38 @@ import (
 	"google.golang.org/protobuf/testing/protocmp"
 
 	spb "github.com/kingofmen/cyoa-exploratory/backend/proto"
+	initialize "github.com/kingofmen/cyoa-exploratory/db"
 	lpb "github.com/kingofmen/cyoa-exploratory/logic/proto"
 	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
 )
 
 var db *sql.DB
 
-func TestMain(m *testing.M) {
-	ctx := context.Background()
-
-	container, err := mysql.RunContainer(ctx,
+// startMySQL runs a MySQL container. It returns an error, rather than
+// panicking, if there is no Docker to run it in.
+func startMySQL(ctx context.Context) (container *mysql.MySQLContainer, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return mysql.RunContainer(ctx,
 		testcontainers.WithImage("mysql:8.0"),
 		mysql.WithDatabase("test_db"),
 		mysql.WithUsername("test_user"),
 		mysql.WithPassword("test_password"),
 	)
+}
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+
+	container, err := startMySQL(ctx)
 	if err != nil {
-		log.Fatalf("could not start mysql container: %v", err)
+		log.Printf("could not start mysql container, testing in-memory store only: %v", err)
+		os.Exit(m.Run())
 	}
 
-	defer func() {
-		if err := container.Terminate(ctx); err != nil {
-			log.Fatalf("could not stop mysql container: %v", err)
-		}
-	}()
-
 	connStr, err := container.ConnectionString(ctx, "multiStatements=true")
 	if err != nil {
 		log.Fatalf("could not get connection string: %v", err)
@@ -66,16 +76,65 @@ func TestMain(m *testing.M) {
 
 	exitCode := m.Run()
 
+	if err := container.Terminate(ctx); err != nil {
+		log.Fatalf("could not stop mysql container: %v", err)
+	}
 	os.Exit(exitCode)
 }
 
+// forEachStore runs the test against fresh in-memory and SQLite
+// stores, and against MySQL if it is available.
+func forEachStore(t *testing.T, test func(*testing.T, Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryStore())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		cfg, err := initialize.FromEnv("", "", initialize.SQLiteNet, filepath.Join(t.TempDir(), "test.db"), "", "")
+		if err != nil {
+			t.Fatalf("could not configure sqlite: %v", err)
+		}
+		sdb, _, err := initialize.ConnectionPool(context.Background(), cfg)
+		if err != nil {
+			t.Fatalf("could not open sqlite database: %v", err)
+		}
+		defer sdb.Close()
+		test(t, NewSQLStore(sdb, SQLite))
+	})
+	t.Run("mysql", func(t *testing.T) {
+		if db == nil {
+			t.Skip("no mysql container")
+		}
+		test(t, NewSQLStore(db, MySQL))
+	})
+}
+
 func TestStoryE2E(t *testing.T) {
+	forEachStore(t, testStoryE2E)
+}
+
+func testStoryE2E(t *testing.T, st Store) {
 	ctx := context.Background()
-	srv := New(db)
+	srv := New(st)
 	uuid1 := uuid.New().String()
 	uuid2 := uuid.New().String()
 	uuid3 := uuid.New().String()
 	uuid4 := uuid.New().String()
+	uuid5 := uuid.New().String()
+	parse := func(text string) *lpb.Predicate {
+		pred, err := logic.Parse(text)
+		if err != nil {
+			t.Fatalf("Parse(%q) => %v, want nil", text, err)
+		}
+		return pred
+	}
+	classTweak := func(class string) []*storypb.StringTweak {
+		return []*storypb.StringTweak{
+			&storypb.StringTweak{
+				Key:   proto.String("class"),
+				Value: proto.String("'" + class),
+			},
+		}
+	}
 	charFighter := &storypb.Action{
 		Id:          proto.String(uuid1),
 		Title:       proto.String("Fighter"),
@@ -87,6 +146,7 @@ func TestStoryE2E(t *testing.T) {
 						NewLocationId: proto.String(uuid2),
 						TweakValue:    proto.String("Strength"),
 						TweakAmount:   proto.Int64(5),
+						StringTweaks:  classTweak("fighter"),
 					},
 				},
 			},
@@ -103,6 +163,7 @@ func TestStoryE2E(t *testing.T) {
 						NewLocationId: proto.String(uuid2),
 						TweakValue:    proto.String("Dexterity"),
 						TweakAmount:   proto.Int64(5),
+						StringTweaks:  classTweak("rogue"),
 					},
 				},
 			},
@@ -114,15 +175,7 @@ func TestStoryE2E(t *testing.T) {
 		Description: proto.String("Fight the ogre with your sword."),
 		Triggers: []*storypb.TriggerAction{
 			&storypb.TriggerAction{
-				Condition: &lpb.Predicate{
-					Test: &lpb.Predicate_Comp{
-						Comp: &lpb.Compare{
-							KeyOne:    proto.String("Strength"),
-							KeyTwo:    proto.String("3"),
-							Operation: lpb.Compare_CMP_GT.Enum(),
-						},
-					},
-				},
+				Condition: parse("Strength > 3"),
 				Effects: []*storypb.Effect{
 					&storypb.Effect{
 						TweakValue:  proto.String("ogre_defeated"),
@@ -147,15 +200,7 @@ func TestStoryE2E(t *testing.T) {
 		Description: proto.String("Sneak past the ogre."),
 		Triggers: []*storypb.TriggerAction{
 			&storypb.TriggerAction{
-				Condition: &lpb.Predicate{
-					Test: &lpb.Predicate_Comp{
-						Comp: &lpb.Compare{
-							KeyOne:    proto.String("Dexterity"),
-							KeyTwo:    proto.String("3"),
-							Operation: lpb.Compare_CMP_GT.Enum(),
-						},
-					},
-				},
+				Condition: parse("Dexterity > 3"),
 				Effects: []*storypb.Effect{
 					&storypb.Effect{
 						TweakValue:  proto.String("ogre_defeated"),
@@ -174,6 +219,36 @@ func TestStoryE2E(t *testing.T) {
 			},
 		},
 	}
+	ogreKey := &storypb.Item{
+		Id:          proto.String("ogre_key"),
+		Title:       proto.String("Ogre's key"),
+		Description: proto.String("A large iron key, greasy from the ogre's pocket."),
+	}
+	pickPocket := &storypb.Action{
+		Id:          proto.String(uuid5),
+		Title:       proto.String("Light fingers"),
+		Description: proto.String("Steal the ogre's key and slip away."),
+		Triggers: []*storypb.TriggerAction{
+			&storypb.TriggerAction{
+				Effects: []*storypb.Effect{
+					&storypb.Effect{
+						TweakValue:  proto.String("ogre_defeated"),
+						TweakAmount: proto.Int64(1),
+						ItemTweaks: []*storypb.ItemTweak{
+							&storypb.ItemTweak{ItemId: proto.String("ogre_key")},
+						},
+						StringTweaks: []*storypb.StringTweak{
+							&storypb.StringTweak{
+								Key:       proto.String("loot"),
+								Operation: storypb.StringTweak_ST_APPEND.Enum(),
+								Value:     proto.String("'ogre_key"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
 
 	chooseChar := &storypb.Location{
 		Id:          proto.String(uuid1),
@@ -191,6 +266,10 @@ func TestStoryE2E(t *testing.T) {
 		PossibleActions: []*storypb.ActionCondition{
 			&storypb.ActionCondition{ActionId: proto.String(uuid3)},
 			&storypb.ActionCondition{ActionId: proto.String(uuid4)},
+			&storypb.ActionCondition{
+				ActionId:  proto.String(uuid5),
+				Condition: parse("class == 'rogue'"),
+			},
 		},
 	}
 
@@ -200,15 +279,7 @@ func TestStoryE2E(t *testing.T) {
 		StartLocationId: proto.String(uuid1),
 		Events: []*storypb.TriggerAction{
 			&storypb.TriggerAction{
-				Condition: &lpb.Predicate{
-					Test: &lpb.Predicate_Comp{
-						Comp: &lpb.Compare{
-							KeyOne:    proto.String("ogre_defeated"),
-							KeyTwo:    proto.String("0"),
-							Operation: lpb.Compare_CMP_GT.Enum(),
-						},
-					},
-				},
+				Condition: parse("ogre_defeated > 0"),
 				Effects: []*storypb.Effect{
 					&storypb.Effect{
 						NewState: storypb.RunState_RS_COMPLETE.Enum(),
@@ -216,15 +287,7 @@ func TestStoryE2E(t *testing.T) {
 				},
 			},
 			&storypb.TriggerAction{
-				Condition: &lpb.Predicate{
-					Test: &lpb.Predicate_Comp{
-						Comp: &lpb.Compare{
-							KeyOne:    proto.String("player_killed"),
-							KeyTwo:    proto.String("0"),
-							Operation: lpb.Compare_CMP_GT.Enum(),
-						},
-					},
-				},
+				Condition: parse("player_killed > 0"),
 				Effects: []*storypb.Effect{
 					&storypb.Effect{
 						NewState: storypb.RunState_RS_COMPLETE.Enum(),
@@ -239,8 +302,9 @@ func TestStoryE2E(t *testing.T) {
 		Content: &spb.StoryContent{
 			Locations: []*storypb.Location{chooseChar, ogreFight},
 			Actions: []*storypb.Action{
-				charFighter, charThief, fightOgre, sneakOgre,
+				charFighter, charThief, fightOgre, sneakOgre, pickPocket,
 			},
+			Items: []*storypb.Item{ogreKey},
 		},
 	})
 	if err != nil {
@@ -264,9 +328,17 @@ func TestStoryE2E(t *testing.T) {
 		identify(fightOgre),
 		identify(sneakOgre),
 	}
+	// Only rogues may pick the ogre's pocket.
+	displayActionsRogue := []*storypb.Summary{
+		identify(fightOgre),
+		identify(sneakOgre),
+		identify(pickPocket),
+	}
 	cases := []struct {
 		desc    string
 		actions []string
+		// Index of the action which should be refused, if any.
+		wantErr int
 		expect  []*storypb.GameDisplay
 	}{
 		{
@@ -276,18 +348,23 @@ func TestStoryE2E(t *testing.T) {
 				&storypb.GameDisplay{
 					Location:  summarize(chooseChar),
 					Story:     displayStory,
+					RunState:  storypb.RunState_RS_ACTIVE.Enum(),
 					Narration: proto.String(""),
 					Actions:   displayActions1,
 				},
 				&storypb.GameDisplay{
 					Location:  summarize(ogreFight),
+					CanUndo:   proto.Bool(true),
 					Story:     displayStory,
+					RunState:  storypb.RunState_RS_ACTIVE.Enum(),
 					Narration: proto.String("Fighter"),
 					Actions:   displayActions2,
 				},
 				&storypb.GameDisplay{
 					Location:  summarize(ogreFight),
+					CanUndo:   proto.Bool(true),
 					Story:     displayStory,
+					RunState:  storypb.RunState_RS_COMPLETE.Enum(),
 					Narration: proto.String("Fighter\nAttack!"),
 				},
 			},
@@ -299,18 +376,23 @@ func TestStoryE2E(t *testing.T) {
 				&storypb.GameDisplay{
 					Location:  summarize(chooseChar),
 					Story:     displayStory,
+					RunState:  storypb.RunState_RS_ACTIVE.Enum(),
 					Narration: proto.String(""),
 					Actions:   displayActions1,
 				},
 				&storypb.GameDisplay{
 					Location:  summarize(ogreFight),
+					CanUndo:   proto.Bool(true),
 					Story:     displayStory,
+					RunState:  storypb.RunState_RS_ACTIVE.Enum(),
 					Narration: proto.String("Rogue"),
-					Actions:   displayActions2,
+					Actions:   displayActionsRogue,
 				},
 				&storypb.GameDisplay{
 					Location:  summarize(ogreFight),
+					CanUndo:   proto.Bool(true),
 					Story:     displayStory,
+					RunState:  storypb.RunState_RS_COMPLETE.Enum(),
 					Narration: proto.String("Rogue\nAttack!"),
 				},
 			},
@@ -322,18 +404,23 @@ func TestStoryE2E(t *testing.T) {
 				&storypb.GameDisplay{
 					Location:  summarize(chooseChar),
 					Story:     displayStory,
+					RunState:  storypb.RunState_RS_ACTIVE.Enum(),
 					Narration: proto.String(""),
 					Actions:   displayActions1,
 				},
 				&storypb.GameDisplay{
 					Location:  summarize(ogreFight),
+					CanUndo:   proto.Bool(true),
 					Story:     displayStory,
+					RunState:  storypb.RunState_RS_ACTIVE.Enum(),
 					Narration: proto.String("Fighter"),
 					Actions:   displayActions2,
 				},
 				&storypb.GameDisplay{
 					Location:  summarize(ogreFight),
+					CanUndo:   proto.Bool(true),
 					Story:     displayStory,
+					RunState:  storypb.RunState_RS_COMPLETE.Enum(),
 					Narration: proto.String("Fighter\nSlow and sneaky wins the race..."),
 				},
 			},
@@ -345,22 +432,86 @@ func TestStoryE2E(t *testing.T) {
 				&storypb.GameDisplay{
 					Location:  summarize(chooseChar),
 					Story:     displayStory,
+					RunState:  storypb.RunState_RS_ACTIVE.Enum(),
 					Narration: proto.String(""),
 					Actions:   displayActions1,
 				},
 				&storypb.GameDisplay{
 					Location:  summarize(ogreFight),
+					CanUndo:   proto.Bool(true),
 					Story:     displayStory,
+					RunState:  storypb.RunState_RS_ACTIVE.Enum(),
 					Narration: proto.String("Rogue"),
-					Actions:   displayActions2,
+					Actions:   displayActionsRogue,
 				},
 				&storypb.GameDisplay{
 					Location:  summarize(ogreFight),
+					CanUndo:   proto.Bool(true),
 					Story:     displayStory,
+					RunState:  storypb.RunState_RS_COMPLETE.Enum(),
 					Narration: proto.String("Rogue\nSlow and sneaky wins the race..."),
 				},
 			},
 		},
+		{
+			desc:    "Rogue, pick pocket",
+			actions: []string{"", charThief.GetId(), pickPocket.GetId()},
+			expect: []*storypb.GameDisplay{
+				&storypb.GameDisplay{
+					Location:  summarize(chooseChar),
+					Story:     displayStory,
+					RunState:  storypb.RunState_RS_ACTIVE.Enum(),
+					Narration: proto.String(""),
+					Actions:   displayActions1,
+				},
+				&storypb.GameDisplay{
+					Location:  summarize(ogreFight),
+					CanUndo:   proto.Bool(true),
+					Story:     displayStory,
+					RunState:  storypb.RunState_RS_ACTIVE.Enum(),
+					Narration: proto.String("Rogue"),
+					Actions:   displayActionsRogue,
+				},
+				&storypb.GameDisplay{
+					Location:  summarize(ogreFight),
+					CanUndo:   proto.Bool(true),
+					Story:     displayStory,
+					RunState:  storypb.RunState_RS_COMPLETE.Enum(),
+					Narration: proto.String("Rogue\nLight fingers"),
+					Inventory: []*storypb.Item{
+						&storypb.Item{
+							Id:          proto.String("ogre_key"),
+							Title:       proto.String("Ogre's key"),
+							Description: proto.String("A large iron key, greasy from the ogre's pocket."),
+							Quantity:    proto.Int64(1),
+						},
+					},
+				},
+			},
+		},
+		{
+			desc:    "Fighter, pick pocket",
+			actions: []string{"", charFighter.GetId(), pickPocket.GetId()},
+			wantErr: 2,
+			expect: []*storypb.GameDisplay{
+				&storypb.GameDisplay{
+					Location:  summarize(chooseChar),
+					Story:     displayStory,
+					RunState:  storypb.RunState_RS_ACTIVE.Enum(),
+					Narration: proto.String(""),
+					Actions:   displayActions1,
+				},
+				&storypb.GameDisplay{
+					Location:  summarize(ogreFight),
+					CanUndo:   proto.Bool(true),
+					Story:     displayStory,
+					RunState:  storypb.RunState_RS_ACTIVE.Enum(),
+					Narration: proto.String("Fighter"),
+					Actions:   displayActions2,
+				},
+				nil,
+			},
+		},
 	}
 
 	for cid, cc := range cases {
@@ -380,6 +531,12 @@ func TestStoryE2E(t *testing.T) {
 					GameId:   proto.Int64(gid),
 					ActionId: proto.String(actid),
 				})
+				if cc.wantErr > 0 && idx == cc.wantErr {
+					if err == nil {
+						t.Errorf("%s: Action %d succeeded, want error", cc.desc, idx)
+					}
+					continue
+				}
 				if err != nil {
 					t.Errorf("%s: Action %d had unexpected error %v", cc.desc, idx, err)
 					continue
@@ -389,6 +546,255 @@ func TestStoryE2E(t *testing.T) {
 					t.Errorf("%s: GameState(%d) => %s, want %s, diff %s", cc.desc, idx, prototext.Format(got), prototext.Format(want), diff)
 				}
 			}
+
+			// The start of the game and every action taken.
+			wantTurns := 1
+			for idx, actid := range cc.actions {
+				if len(actid) > 0 && idx != cc.wantErr {
+					wantTurns++
+				}
+			}
+			var turns []*storypb.TurnRecord
+			for req := (&spb.GetGameHistoryRequest{GameId: proto.Int64(gid), PageSize: proto.Int32(1)}); ; {
+				hresp, err := srv.GetGameHistory(ctx, req)
+				if err != nil {
+					t.Fatalf("%s: GetGameHistory(%s) => %v, want nil", cc.desc, prototext.Format(req), err)
+				}
+				turns = append(turns, hresp.GetTurns()...)
+				if len(hresp.GetNextPageToken()) == 0 {
+					break
+				}
+				req.PageToken = proto.String(hresp.GetNextPageToken())
+			}
+			if len(turns) != wantTurns {
+				t.Errorf("%s: GetGameHistory() => %d turns, want %d", cc.desc, len(turns), wantTurns)
+			}
+			for idx, turn := range turns {
+				if turn.GetTurn() != int64(idx) {
+					t.Errorf("%s: GetGameHistory() => turn %d at index %d", cc.desc, turn.GetTurn(), idx)
+				}
+			}
+
+			// Rewinding to the character choice shows it again.
+			rresp, err := srv.RewindGame(ctx, &spb.RewindGameRequest{
+				GameId: proto.Int64(gid),
+				Turn:   proto.Int64(1),
+			})
+			if err != nil {
+				t.Fatalf("%s: RewindGame() => %v, want nil", cc.desc, err)
+			}
+			if got, want := rresp.GetState(), cc.expect[1]; !proto.Equal(got, want) {
+				t.Errorf("%s: RewindGame() => %s, want %s", cc.desc, prototext.Format(got), prototext.Format(want))
+			}
 		})
 	}
+
+	// Forks copy the game into a new ID with the same display.
+	fresp, err := srv.ForkGame(ctx, &spb.ForkGameRequest{
+		GameId: proto.Int64(1),
+		Slot:   proto.String("before the ogre"),
+	})
+	if err != nil {
+		t.Fatalf("ForkGame() => %v, want nil", err)
+	}
+	fid := fresp.GetGameId()
+	if fid != int64(len(cases)+1) {
+		t.Errorf("ForkGame() => unexpected game ID %d, want %d", fid, len(cases)+1)
+	}
+	if _, err := srv.ForkGame(ctx, &spb.ForkGameRequest{
+		GameId: proto.Int64(1),
+		Slot:   proto.String("before the ogre"),
+	}); err == nil {
+		t.Errorf("ForkGame() into a used slot succeeded, want error")
+	}
+	orig, err := srv.GameState(ctx, &spb.GameStateRequest{GameId: proto.Int64(1)})
+	if err != nil {
+		t.Fatalf("GameState(1) => %v, want nil", err)
+	}
+	fork, err := srv.GameState(ctx, &spb.GameStateRequest{GameId: proto.Int64(fid)})
+	if err != nil {
+		t.Fatalf("GameState(%d) => %v, want nil", fid, err)
+	}
+	if diff := cmp.Diff(fork.GetState(), orig.GetState(), protocmp.Transform()); diff != "" {
+		t.Errorf("GameState(%d) => %s, want %s, diff %s", fid, prototext.Format(fork.GetState()), prototext.Format(orig.GetState()), diff)
+	}
+	if len(orig.GetState().GetTraces()) > 0 {
+		t.Errorf("GameState(1) => %d traces for a player, want none", len(orig.GetState().GetTraces()))
+	}
+	authored, err := srv.GameState(ctx, &spb.GameStateRequest{GameId: proto.Int64(1), Author: proto.Bool(true)})
+	if err != nil {
+		t.Fatalf("GameState(1) as author => %v, want nil", err)
+	}
+	if len(authored.GetState().GetTraces()) > 0 {
+		t.Errorf("GameState(1) as author without author mode => %d traces, want none", len(authored.GetState().GetTraces()))
+	}
+	authored, err = srv.WithAuthors(true).GameState(ctx, &spb.GameStateRequest{GameId: proto.Int64(1), Author: proto.Bool(true)})
+	if err != nil {
+		t.Fatalf("GameState(1) as author => %v, want nil", err)
+	}
+	if got, want := len(authored.GetState().GetTraces()), len(orig.GetState().GetActions()); got < want {
+		t.Errorf("GameState(1) as author => %d traces, want at least %d", got, want)
+	}
+	lresp, err := srv.ListGames(ctx, &spb.ListGamesRequest{})
+	if err != nil {
+		t.Fatalf("ListGames() => %v, want nil", err)
+	}
+	for _, gam := range lresp.GetGames() {
+		if gam.GetId() != fid {
+			continue
+		}
+		if gam.GetParentId() != 1 || gam.GetSlot() != "before the ogre" {
+			t.Errorf("ListGames() => fork %s, want parent 1 and slot %q", prototext.Format(gam), "before the ogre")
+		}
+	}
+
+	// Ironman stories cannot be rewound, but can still be forked.
+	txn, err := st.Begin(ctx, false)
+	if err != nil {
+		t.Fatalf("Begin() => %v", err)
+	}
+	str, err := txn.LoadStory(ctx, stid)
+	if err != nil {
+		t.Fatalf("LoadStory(%d) => %v", stid, err)
+	}
+	str.Ironman = proto.Bool(true)
+	if err := txn.WriteStory(ctx, str); err != nil {
+		t.Fatalf("WriteStory(%d) => %v", stid, err)
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("Commit() => %v", err)
+	}
+	if _, err := srv.ForkGame(ctx, &spb.ForkGameRequest{GameId: proto.Int64(1)}); err != nil {
+		t.Errorf("ForkGame() of ironman playthrough => %v, want nil", err)
+	}
+}
+
+func TestActionsE2E(t *testing.T) {
+	forEachStore(t, testActionsE2E)
+}
+
+func testActionsE2E(t *testing.T, st Store) {
+	ctx := context.Background()
+	srv := New(st)
+
+	cresp, err := srv.CreateAction(ctx, &spb.CreateActionRequest{
+		Action: &storypb.Action{Title: proto.String("Wait")},
+	})
+	if err != nil {
+		t.Fatalf("CreateAction() => %v, want nil", err)
+	}
+	aid := cresp.GetAction().GetId()
+	upd := &storypb.Action{
+		Id:          proto.String(aid),
+		Title:       proto.String("Wait patiently"),
+		Description: proto.String("Time passes."),
+	}
+	if _, err := srv.UpdateAction(ctx, &spb.UpdateActionRequest{Action: upd}); err != nil {
+		t.Fatalf("UpdateAction() => %v, want nil", err)
+	}
+	if _, err := srv.UpdateAction(ctx, &spb.UpdateActionRequest{
+		Action: &storypb.Action{Id: proto.String(uuid.New().String()), Title: proto.String("Ghost")},
+	}); err == nil {
+		t.Errorf("UpdateAction() of unknown action succeeded, want error")
+	}
+	gresp, err := srv.GetAction(ctx, &spb.GetActionRequest{ActionId: proto.String(aid)})
+	if err != nil {
+		t.Fatalf("GetAction() => %v, want nil", err)
+	}
+	if diff := cmp.Diff(gresp.GetAction(), upd, protocmp.Transform()); diff != "" {
+		t.Errorf("GetAction() => %s, want %s, diff %s", prototext.Format(gresp.GetAction()), prototext.Format(upd), diff)
+	}
+	lresp, err := srv.ListActions(ctx, &spb.ListActionsRequest{})
+	if err != nil {
+		t.Fatalf("ListActions() => %v, want nil", err)
+	}
+	found := false
+	for _, act := range lresp.GetActions() {
+		found = found || act.GetId() == aid
+	}
+	if !found {
+		t.Errorf("ListActions() => %d actions without %s", len(lresp.GetActions()), aid)
+	}
+
+	locresp, err := srv.CreateLocation(ctx, &spb.CreateLocationRequest{
+		Location: &storypb.Location{
+			Title: proto.String("Waiting room"),
+			PossibleActions: []*storypb.ActionCondition{
+				&storypb.ActionCondition{ActionId: proto.String(aid)},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateLocation() => %v, want nil", err)
+	}
+	lid := locresp.GetLocation().GetId()
+
+	// Only the location and story which use the action refer to it.
+	other, err := srv.CreateAction(ctx, &spb.CreateActionRequest{
+		Action: &storypb.Action{Title: proto.String("Leave")},
+	})
+	if err != nil {
+		t.Fatalf("CreateAction() => %v, want nil", err)
+	}
+	if _, err := srv.CreateLocation(ctx, &spb.CreateLocationRequest{
+		Location: &storypb.Location{
+			Title: proto.String("Exit"),
+			PossibleActions: []*storypb.ActionCondition{
+				&storypb.ActionCondition{ActionId: proto.String(other.GetAction().GetId())},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("CreateLocation() => %v, want nil", err)
+	}
+	txn, err := st.Begin(ctx, false)
+	if err != nil {
+		t.Fatalf("Begin() => %v", err)
+	}
+	sid, err := txn.CreateStory(ctx, "Waiting")
+	if err != nil {
+		t.Fatalf("CreateStory() => %v", err)
+	}
+	if _, err := txn.CreateStory(ctx, "Leaving"); err != nil {
+		t.Fatalf("CreateStory() => %v", err)
+	}
+	if err := txn.SetStoryActions(ctx, sid, []string{aid}); err != nil {
+		t.Fatalf("SetStoryActions() => %v", err)
+	}
+	alocs, err := txn.ActionLocations(ctx, aid)
+	if err != nil {
+		t.Fatalf("ActionLocations(%s) => %v", aid, err)
+	}
+	if len(alocs) != 1 || alocs[0].GetId() != lid {
+		t.Errorf("ActionLocations(%s) => %d locations, want only %s", aid, len(alocs), lid)
+	}
+	astrs, err := txn.ActionStories(ctx, aid)
+	if err != nil {
+		t.Fatalf("ActionStories(%s) => %v", aid, err)
+	}
+	if len(astrs) != 1 || astrs[0].GetId() != sid {
+		t.Errorf("ActionStories(%s) => %d stories, want only %d", aid, len(astrs), sid)
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("Commit() => %v", err)
+	}
+
+	if _, err := srv.DeleteAction(ctx, &spb.DeleteActionRequest{ActionId: proto.String(aid)}); err == nil {
+		t.Errorf("DeleteAction() of offered action succeeded, want error")
+	}
+	if _, err := srv.DeleteAction(ctx, &spb.DeleteActionRequest{
+		ActionId:         proto.String(aid),
+		RemoveReferences: proto.Bool(true),
+	}); err != nil {
+		t.Fatalf("DeleteAction() => %v, want nil", err)
+	}
+	if _, err := srv.GetAction(ctx, &spb.GetActionRequest{ActionId: proto.String(aid)}); err == nil {
+		t.Errorf("GetAction() of deleted action succeeded, want error")
+	}
+	getloc, err := srv.GetLocation(ctx, &spb.GetLocationRequest{LocationId: proto.String(lid)})
+	if err != nil {
+		t.Fatalf("GetLocation() => %v, want nil", err)
+	}
+	if pacts := getloc.GetLocation().GetPossibleActions(); len(pacts) > 0 {
+		t.Errorf("GetLocation() => %d possible actions after deletion, want none", len(pacts))
+	}
 }
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+
+	spb "github.com/kingofmen/cyoa-exploratory/backend/proto"
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+func TestCheckTypesUndeclared(t *testing.T) {
+	trigger := func(eff *storypb.Effect) *storypb.Action {
+		return &storypb.Action{
+			Title:    proto.String("Act"),
+			Triggers: []*storypb.TriggerAction{&storypb.TriggerAction{Effects: []*storypb.Effect{eff}}},
+		}
+	}
+	items := []*storypb.Item{&storypb.Item{Id: proto.String("rope")}}
+	cases := []struct {
+		desc  string
+		act   *storypb.Action
+		valid bool
+	}{
+		{
+			desc:  "Undeclared variable",
+			act:   trigger(&storypb.Effect{TweakValue: proto.String("gold"), TweakExpr: proto.String("gold * 2")}),
+			valid: true,
+		},
+		{
+			desc: "Unknown item",
+			act:  trigger(&storypb.Effect{TweakExpr: proto.String("inv.sword + 1"), TweakValue: proto.String("gold")}),
+		},
+		{
+			desc: "Bad expression",
+			act:  trigger(&storypb.Effect{TweakValue: proto.String("gold"), TweakExpr: proto.String("gold +")}),
+		},
+		{
+			desc: "Bad clamp",
+			act: trigger(&storypb.Effect{Ops: []*storypb.VariableOp{&storypb.VariableOp{
+				Key: proto.String("gold"),
+				Op:  &storypb.VariableOp_Clamp{Clamp: &storypb.Range{Min: proto.Int64(5), Max: proto.Int64(1)}},
+			}}}),
+		},
+		{
+			desc: "Unknown scope in description",
+			act:  &storypb.Action{Title: proto.String("Act"), Description: proto.String("You see {{troll.name}}.")},
+		},
+	}
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			err := checkTypes(&storypb.Story{}, nil, []*storypb.Action{cc.act}, items)
+			if (err == nil) != cc.valid {
+				t.Errorf("%s: checkTypes() => %v, want valid %v", cc.desc, err, cc.valid)
+			}
+		})
+	}
+}
+
+func TestValidateStoryEvents(t *testing.T) {
+	loc := &storypb.Location{Id: proto.String(uuid.New().String()), Title: proto.String("Cave")}
+	event := func(eff *storypb.Effect) *storypb.Story {
+		return &storypb.Story{
+			Title:           proto.String("Spelunking"),
+			StartLocationId: loc.Id,
+			Events:          []*storypb.TriggerAction{&storypb.TriggerAction{Effects: []*storypb.Effect{eff}}},
+		}
+	}
+	content := &spb.StoryContent{
+		Locations: []*storypb.Location{loc},
+		Items:     []*storypb.Item{&storypb.Item{Id: proto.String("rope")}},
+	}
+	cases := []struct {
+		desc  string
+		str   *storypb.Story
+		valid bool
+	}{
+		{desc: "Good", str: event(&storypb.Effect{NewLocationId: loc.Id}), valid: true},
+		{desc: "Bad location", str: event(&storypb.Effect{NewLocationId: proto.String(uuid.New().String())})},
+		{
+			desc: "Bad item",
+			str: event(&storypb.Effect{ItemTweaks: []*storypb.ItemTweak{
+				&storypb.ItemTweak{ItemId: proto.String("sword"), Operation: storypb.ItemTweak_IT_GRANT.Enum()},
+			}}),
+		},
+	}
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			if _, _, err := validateContent(cc.str, content); (err == nil) != cc.valid {
+				t.Errorf("%s: validateContent() => %v, want valid %v", cc.desc, err, cc.valid)
+			}
+		})
+	}
+}
+
+func TestCheckTypesChoices(t *testing.T) {
+	str := &storypb.Story{
+		Variables: []*storypb.Variable{
+			&storypb.Variable{Name: proto.String("mood"), Type: storypb.Variable_VT_STRING.Enum(), DefaultStr: proto.String("calm"), Choices: []string{"calm", "angry"}},
+		},
+	}
+	for val, valid := range map[string]bool{"'angry": true, "'sleepy": false} {
+		act := &storypb.Action{
+			Title: proto.String("Act"),
+			Triggers: []*storypb.TriggerAction{&storypb.TriggerAction{Effects: []*storypb.Effect{&storypb.Effect{
+				StringTweaks: []*storypb.StringTweak{&storypb.StringTweak{Key: proto.String("mood"), Value: proto.String(val)}},
+			}}}},
+		}
+		if err := checkTypes(str, nil, []*storypb.Action{act}, nil); (err == nil) != valid {
+			t.Errorf("checkTypes() setting mood to %s => %v, want valid %v", val, err, valid)
+		}
+	}
+}
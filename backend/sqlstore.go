@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+
+	"google.golang.org/protobuf/proto"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+// Dialect is the SQL dialect of a database, for the few statements
+// which MySQL and SQLite spell differently.
+type Dialect int
+
+const (
+	MySQL Dialect = iota
+	SQLite
+)
+
+// sqlStore implements Store over the schema in db/migrations, in
+// MySQL or SQLite.
+type sqlStore struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// NewSQLStore returns a Store backed by the MySQL or SQLite database.
+func NewSQLStore(db *sql.DB, dialect Dialect) Store {
+	return &sqlStore{db: db, dialect: dialect}
+}
+
+func (s *sqlStore) Begin(ctx context.Context, readOnly bool) (Txn, error) {
+	txn, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: readOnly})
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTxn{txn: txn, dialect: s.dialect}, nil
+}
+
+type sqlTxn struct {
+	txn     *sql.Tx
+	dialect Dialect
+}
+
+func (t *sqlTxn) Commit() error {
+	return t.txn.Commit()
+}
+
+func (t *sqlTxn) Rollback() error {
+	return t.txn.Rollback()
+}
+
+func (t *sqlTxn) CreateStory(ctx context.Context, title string) (int64, error) {
+	str, err := createStory(ctx, t.txn, &storypb.Story{Title: proto.String(title)})
+	if err != nil {
+		return 0, err
+	}
+	return str.GetId(), nil
+}
+
+func (t *sqlTxn) LoadStory(ctx context.Context, sid int64) (*storypb.Story, error) {
+	return loadStory(ctx, t.txn, sid)
+}
+
+func (t *sqlTxn) LoadStories(ctx context.Context) ([]*storypb.Story, error) {
+	return loadAllStories(ctx, t.txn)
+}
+
+func (t *sqlTxn) WriteStory(ctx context.Context, str *storypb.Story) error {
+	return writeStory(ctx, t.txn, str)
+}
+
+func (t *sqlTxn) DeleteStory(ctx context.Context, sid int64) error {
+	return deleteStory(ctx, t.txn, sid)
+}
+
+func (t *sqlTxn) StoryLocations(ctx context.Context, sid int64) ([]*storypb.Location, error) {
+	return loadStoryLocations(ctx, t.txn, sid)
+}
+
+func (t *sqlTxn) SetStoryLocations(ctx context.Context, sid int64, lids []string) error {
+	return updateStoryLocationsTable(ctx, t.txn, sid, lids)
+}
+
+func (t *sqlTxn) StoryActions(ctx context.Context, sid int64) ([]*storypb.Action, error) {
+	return loadStoryActions(ctx, t.txn, sid)
+}
+
+func (t *sqlTxn) SetStoryActions(ctx context.Context, sid int64, aids []string) error {
+	return updateStoryActionsTable(ctx, t.txn, sid, aids)
+}
+
+func (t *sqlTxn) StoryItems(ctx context.Context, sid int64) ([]*storypb.Item, error) {
+	return loadStoryItems(ctx, t.txn, sid)
+}
+
+func (t *sqlTxn) SetStoryItems(ctx context.Context, sid int64, items []*storypb.Item) error {
+	return updateStoryItemsTable(ctx, t.txn, sid, items)
+}
+
+func (t *sqlTxn) CreateLocation(ctx context.Context, loc *storypb.Location) error {
+	return insertLocation(ctx, t.txn, loc)
+}
+
+func (t *sqlTxn) WriteLocation(ctx context.Context, loc *storypb.Location) error {
+	_, err := createOrUpdateLocation(ctx, t.txn, t.dialect, loc.GetId(), loc)
+	return err
+}
+
+func (t *sqlTxn) LoadLocation(ctx context.Context, lid string) (*storypb.Location, error) {
+	return loadLocation(ctx, t.txn, lid)
+}
+
+func (t *sqlTxn) LoadLocations(ctx context.Context) ([]*storypb.Location, error) {
+	return loadAllLocations(ctx, t.txn)
+}
+
+func (t *sqlTxn) DeleteLocation(ctx context.Context, lid string) error {
+	return deleteLocation(ctx, t.txn, lid)
+}
+
+func (t *sqlTxn) ActionLocations(ctx context.Context, aid string) ([]*storypb.Location, error) {
+	return loadActionLocations(ctx, t.txn, aid)
+}
+
+func (t *sqlTxn) ActionStories(ctx context.Context, aid string) ([]*storypb.Story, error) {
+	return loadActionStories(ctx, t.txn, aid)
+}
+
+func (t *sqlTxn) CreateAction(ctx context.Context, act *storypb.Action) error {
+	return insertAction(ctx, t.txn, act)
+}
+
+func (t *sqlTxn) WriteAction(ctx context.Context, act *storypb.Action) error {
+	_, err := createOrUpdateAction(ctx, t.txn, t.dialect, act.GetId(), act)
+	return err
+}
+
+func (t *sqlTxn) LoadAction(ctx context.Context, aid string) (*storypb.Action, error) {
+	return loadAction(ctx, t.txn, aid)
+}
+
+func (t *sqlTxn) LoadActions(ctx context.Context, aids ...string) ([]*storypb.Action, error) {
+	return loadActions(ctx, t.txn, aids...)
+}
+
+func (t *sqlTxn) LoadAllActions(ctx context.Context) ([]*storypb.Action, error) {
+	return loadAllActions(ctx, t.txn)
+}
+
+func (t *sqlTxn) DeleteAction(ctx context.Context, aid string) error {
+	return deleteAction(ctx, t.txn, aid)
+}
+
+func (t *sqlTxn) CreateGame(ctx context.Context, game *storypb.Playthrough, narration string) (int64, error) {
+	return insertGame(ctx, t.txn, game, narration)
+}
+
+func (t *sqlTxn) LoadGame(ctx context.Context, gid int64) (*storypb.Playthrough, string, error) {
+	return loadGame(ctx, t.txn, gid)
+}
+
+func (t *sqlTxn) WriteGame(ctx context.Context, game *storypb.Playthrough, narration string) error {
+	return writeGame(ctx, t.txn, game, narration)
+}
+
+func (t *sqlTxn) LoadGames(ctx context.Context) ([]*storypb.Playthrough, error) {
+	return loadAllGames(ctx, t.txn)
+}
+
+func (t *sqlTxn) SlotUsed(ctx context.Context, gid int64, slot string) (bool, error) {
+	return slotUsed(ctx, t.txn, gid, slot)
+}
+
+func (t *sqlTxn) CreateTurn(ctx context.Context, gid int64, rec *storypb.TurnRecord) error {
+	return writeTurn(ctx, t.txn, gid, rec)
+}
+
+func (t *sqlTxn) LoadTurns(ctx context.Context, gid, from, limit int64) ([]*storypb.TurnRecord, error) {
+	return loadTurns(ctx, t.txn, gid, from, limit)
+}
+
+func (t *sqlTxn) DeleteTurns(ctx context.Context, gid, after int64) error {
+	return deleteTurns(ctx, t.txn, gid, after)
+}
+
+func (t *sqlTxn) CopyTurns(ctx context.Context, from, to int64) error {
+	return copyTurns(ctx, t.txn, from, to)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+// Store is the persistent storage behind the server.
+type Store interface {
+	// Begin starts a transaction, which must be committed or rolled
+	// back.
+	Begin(ctx context.Context, readOnly bool) (Txn, error)
+}
+
+// Txn is a transaction in a Store. Loads of missing objects return
+// errors wrapping sql.ErrNoRows; loaded objects are the caller's to
+// modify. Writing a story, location or action gives it a new
+// revision.
+type Txn interface {
+	Commit() error
+	Rollback() error
+
+	// CreateStory creates an empty story and returns its ID.
+	CreateStory(ctx context.Context, title string) (int64, error)
+	LoadStory(ctx context.Context, sid int64) (*storypb.Story, error)
+	// LoadStories returns every story, in order of ID.
+	LoadStories(ctx context.Context) ([]*storypb.Story, error)
+	WriteStory(ctx context.Context, str *storypb.Story) error
+	DeleteStory(ctx context.Context, sid int64) error
+	StoryLocations(ctx context.Context, sid int64) ([]*storypb.Location, error)
+	SetStoryLocations(ctx context.Context, sid int64, lids []string) error
+	StoryActions(ctx context.Context, sid int64) ([]*storypb.Action, error)
+	SetStoryActions(ctx context.Context, sid int64, aids []string) error
+	StoryItems(ctx context.Context, sid int64) ([]*storypb.Item, error)
+	SetStoryItems(ctx context.Context, sid int64, items []*storypb.Item) error
+
+	// CreateLocation fails if the location ID is taken; WriteLocation
+	// creates or overwrites.
+	CreateLocation(ctx context.Context, loc *storypb.Location) error
+	WriteLocation(ctx context.Context, loc *storypb.Location) error
+	LoadLocation(ctx context.Context, lid string) (*storypb.Location, error)
+	// LoadLocations returns every location, in order of ID.
+	LoadLocations(ctx context.Context) ([]*storypb.Location, error)
+	DeleteLocation(ctx context.Context, lid string) error
+
+	// As for locations. LoadActions skips IDs it does not find.
+	CreateAction(ctx context.Context, act *storypb.Action) error
+	WriteAction(ctx context.Context, act *storypb.Action) error
+	LoadAction(ctx context.Context, aid string) (*storypb.Action, error)
+	LoadActions(ctx context.Context, aids ...string) ([]*storypb.Action, error)
+	LoadAllActions(ctx context.Context) ([]*storypb.Action, error)
+	// ActionLocations and ActionStories return, in order of ID, at
+	// least the locations and stories which offer the action; callers
+	// must still check each one.
+	ActionLocations(ctx context.Context, aid string) ([]*storypb.Location, error)
+	ActionStories(ctx context.Context, aid string) ([]*storypb.Story, error)
+	DeleteAction(ctx context.Context, aid string) error
+
+	// CreateGame stores a new playthrough, including its parent and
+	// save slot if any, and returns its ID. WriteGame overwrites the
+	// state and narration of the playthrough with the game's ID but
+	// not its parent or slot.
+	CreateGame(ctx context.Context, game *storypb.Playthrough, narration string) (int64, error)
+	LoadGame(ctx context.Context, gid int64) (*storypb.Playthrough, string, error)
+	WriteGame(ctx context.Context, game *storypb.Playthrough, narration string) error
+	// LoadGames returns every playthrough, in order of ID.
+	LoadGames(ctx context.Context) ([]*storypb.Playthrough, error)
+	// SlotUsed returns true if a fork of the game has the slot name.
+	SlotUsed(ctx context.Context, gid int64, slot string) (bool, error)
+
+	// CreateTurn adds a turn to the playthrough's history.
+	CreateTurn(ctx context.Context, gid int64, rec *storypb.TurnRecord) error
+	// LoadTurns returns up to limit turns, starting from the given turn.
+	LoadTurns(ctx context.Context, gid, from, limit int64) ([]*storypb.TurnRecord, error)
+	// DeleteTurns forgets the turns after the given one.
+	DeleteTurns(ctx context.Context, gid, after int64) error
+	// CopyTurns copies the history of one playthrough to another.
+	CopyTurns(ctx context.Context, from, to int64) error
+}
+
+// newRevision returns a revision for a story, location or action
+// about to be written.
+func newRevision() *string {
+	return proto.String(uuid.NewString())
+}
@@ -11,12 +11,12 @@ import (
 )
 
 func createStory(ctx context.Context, txn *sql.Tx, str *storypb.Story) (*storypb.Story, error) {
-	if _, err := txn.ExecContext(ctx, `INSERT INTO Stories (title) VALUES (?)`, str.GetTitle()); err != nil {
+	res, err := txn.ExecContext(ctx, `INSERT INTO Stories (title) VALUES (?)`, str.GetTitle())
+	if err != nil {
 		return nil, fmt.Errorf("could not insert into Stories: %w", err)
 	}
-	var sid int64
-	row := txn.QueryRowContext(ctx, `SELECT LAST_INSERT_ID()`)
-	if err := row.Scan(&sid); err != nil {
+	sid, err := res.LastInsertId()
+	if err != nil {
 		return nil, fmt.Errorf("could not read back created ID: %w", err)
 	}
 
@@ -25,16 +25,28 @@ func createStory(ctx context.Context, txn *sql.Tx, str *storypb.Story) (*storypb
 	}, nil
 }
 
-func createOrUpdateLocation(ctx context.Context, txn *sql.Tx, lid string, loc *storypb.Location) (*storypb.Location, error) {
+// upsertLocation writes a location whether or not it exists yet,
+// in each dialect.
+var upsertLocation = map[Dialect]string{
+	MySQL: `INSERT INTO Locations (id, title, proto)
+          VALUES (?, ?, ?)
+          ON DUPLICATE KEY UPDATE title = VALUES(title), proto = VALUES(proto);`,
+	SQLite: `INSERT INTO Locations (id, title, proto)
+           VALUES (?, ?, ?)
+           ON CONFLICT(id) DO UPDATE SET title = excluded.title, proto = excluded.proto;`,
+}
+
+func createOrUpdateLocation(ctx context.Context, txn *sql.Tx, dialect Dialect, lid string, loc *storypb.Location) (*storypb.Location, error) {
+	loc.Revision = newRevision()
 	blob, err := proto.Marshal(loc)
 	if err != nil {
 		return nil, fmt.Errorf("could not marshal updated location %s (%s): %w", lid, loc.GetTitle(), err)
 	}
-	if _, err := txn.ExecContext(ctx, `INSERT INTO Locations (id, title, proto)
-                                     VALUES (?, ?, ?)
-                                     ON DUPLICATE KEY UPDATE title = VALUES(title), proto = VALUES(proto);
-                                    `, lid, loc.GetTitle(), blob); err != nil {
-		return nil, fmt.Errorf("could not insert into Locations: %w", err)
+	if _, err := txn.ExecContext(ctx, upsertLocation[dialect], lid, loc.GetTitle(), blob); err != nil {
+		return nil, fmt.Errorf("could not write to Locations: %w", err)
+	}
+	if err := updateLocationActionsTable(ctx, txn, lid, loc.GetPossibleActions()); err != nil {
+		return nil, err
 	}
 
 	loc.Id = proto.String(lid)
@@ -60,16 +72,25 @@ func updateStoryLocationsTable(ctx context.Context, txn *sql.Tx, sid int64, locI
 	return nil
 }
 
-func createOrUpdateAction(ctx context.Context, txn *sql.Tx, aid string, act *storypb.Action) (*storypb.Action, error) {
+// upsertAction writes an action whether or not it exists yet, in
+// each dialect.
+var upsertAction = map[Dialect]string{
+	MySQL: `INSERT INTO Actions (id, proto)
+          VALUES (?, ?)
+          ON DUPLICATE KEY UPDATE proto = VALUES(proto);`,
+	SQLite: `INSERT INTO Actions (id, proto)
+           VALUES (?, ?)
+           ON CONFLICT(id) DO UPDATE SET proto = excluded.proto;`,
+}
+
+func createOrUpdateAction(ctx context.Context, txn *sql.Tx, dialect Dialect, aid string, act *storypb.Action) (*storypb.Action, error) {
+	act.Revision = newRevision()
 	blob, err := proto.Marshal(act)
 	if err != nil {
 		return nil, fmt.Errorf("could not marshal updated action %s (%s): %w", aid, act.GetTitle(), err)
 	}
-	if _, err := txn.ExecContext(ctx, `INSERT INTO Actions (id, proto)
-                                     VALUES (?, ?)
-                                     ON DUPLICATE KEY UPDATE proto = VALUES(proto);
-                                    `, aid, blob); err != nil {
-		return nil, fmt.Errorf("could not insert into Actions: %w", err)
+	if _, err := txn.ExecContext(ctx, upsertAction[dialect], aid, blob); err != nil {
+		return nil, fmt.Errorf("could not write to Actions: %w", err)
 	}
 
 	act.Id = proto.String(aid)
@@ -94,3 +115,185 @@ func updateStoryActionsTable(ctx context.Context, txn *sql.Tx, sid int64, actIds
 	}
 	return nil
 }
+
+// updateLocationActionsTable records which actions the location offers.
+func updateLocationActionsTable(ctx context.Context, txn *sql.Tx, lid string, conds []*storypb.ActionCondition) error {
+	_, err := txn.ExecContext(ctx, `DELETE FROM LocationActions WHERE location_id = ?`, lid)
+	if err != nil {
+		return fmt.Errorf("failed to delete existing location actions: %w", err)
+	}
+	insrt, err := txn.PrepareContext(ctx, `INSERT INTO LocationActions (location_id, action_id) VALUES (?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert statement: %w", err)
+	}
+	defer insrt.Close()
+	seen := make(map[string]bool, len(conds))
+	for _, cond := range conds {
+		aid := cond.GetActionId()
+		if seen[aid] {
+			continue
+		}
+		seen[aid] = true
+		if _, err := insrt.ExecContext(ctx, lid, aid); err != nil {
+			return fmt.Errorf("failed to insert location-action association (%s, %s): %w", lid, aid, err)
+		}
+	}
+	return nil
+}
+
+// updateStoryItemsTable replaces the story's items with the given ones.
+func updateStoryItemsTable(ctx context.Context, txn *sql.Tx, sid int64, items []*storypb.Item) error {
+	_, err := txn.ExecContext(ctx, `DELETE FROM Items WHERE story_id = ?`, sid)
+	if err != nil {
+		return fmt.Errorf("failed to delete existing story items: %w", err)
+	}
+	insrt, err := txn.PrepareContext(ctx, `INSERT INTO Items (story_id, id, title, proto) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert statement: %w", err)
+	}
+	defer insrt.Close()
+	for _, item := range items {
+		blob, err := proto.Marshal(item)
+		if err != nil {
+			return fmt.Errorf("could not marshal item %s (%s): %w", item.GetId(), item.GetTitle(), err)
+		}
+		if _, err := insrt.ExecContext(ctx, sid, item.GetId(), item.GetTitle(), blob); err != nil {
+			return fmt.Errorf("failed to insert item (%d, %s): %w", sid, item.GetId(), err)
+		}
+	}
+	return nil
+}
+
+func writeStory(ctx context.Context, txn *sql.Tx, str *storypb.Story) error {
+	str.Revision = newRevision()
+	blob, err := proto.Marshal(str)
+	if err != nil {
+		return fmt.Errorf("could not marshal story %d: %w", str.GetId(), err)
+	}
+	if _, err = txn.ExecContext(ctx, `UPDATE Stories SET title = ?, proto = ? WHERE id = ?`, str.GetTitle(), blob, str.GetId()); err != nil {
+		return fmt.Errorf("could not update stories table: %w", err)
+	}
+	return nil
+}
+
+func deleteStory(ctx context.Context, txn *sql.Tx, sid int64) error {
+	if _, err := txn.ExecContext(ctx, `DELETE FROM Stories WHERE id = ?`, sid); err != nil {
+		return fmt.Errorf("could not delete Story %d: %w", sid, err)
+	}
+	return nil
+}
+
+func insertLocation(ctx context.Context, txn *sql.Tx, loc *storypb.Location) error {
+	loc.Revision = newRevision()
+	blob, err := proto.Marshal(loc)
+	if err != nil {
+		return fmt.Errorf("could not marshal Location: %w", err)
+	}
+	if _, err := txn.ExecContext(ctx, `INSERT INTO Locations (id, title, proto) VALUES (?, ?, ?)`, loc.GetId(), loc.GetTitle(), blob); err != nil {
+		return fmt.Errorf("could not insert into Locations: %w", err)
+	}
+	return updateLocationActionsTable(ctx, txn, loc.GetId(), loc.GetPossibleActions())
+}
+
+func deleteLocation(ctx context.Context, txn *sql.Tx, lid string) error {
+	if _, err := txn.ExecContext(ctx, `DELETE FROM Locations WHERE id = ?`, lid); err != nil {
+		return fmt.Errorf("could not delete Location %s: %w", lid, err)
+	}
+	return nil
+}
+
+func insertAction(ctx context.Context, txn *sql.Tx, act *storypb.Action) error {
+	act.Revision = newRevision()
+	blob, err := proto.Marshal(act)
+	if err != nil {
+		return fmt.Errorf("could not marshal Action: %w", err)
+	}
+	if _, err := txn.ExecContext(ctx, `INSERT INTO Actions (id, proto) VALUES (?, ?)`, act.GetId(), blob); err != nil {
+		return fmt.Errorf("could not insert into Actions: %w", err)
+	}
+	return nil
+}
+
+func deleteAction(ctx context.Context, txn *sql.Tx, aid string) error {
+	if _, err := txn.ExecContext(ctx, `DELETE FROM Actions WHERE id = ?`, aid); err != nil {
+		return fmt.Errorf("could not delete Action %s: %w", aid, err)
+	}
+	return nil
+}
+
+// insertGame stores the playthrough; its parent and slot have their
+// own columns.
+func insertGame(ctx context.Context, txn *sql.Tx, game *storypb.Playthrough, narration string) (int64, error) {
+	var pid, pturn sql.NullInt64
+	var slot sql.NullString
+	if game.ParentId != nil {
+		pid = sql.NullInt64{Int64: game.GetParentId(), Valid: true}
+		pturn = sql.NullInt64{Int64: game.GetParentTurn(), Valid: true}
+	}
+	if game.Slot != nil {
+		slot = sql.NullString{String: game.GetSlot(), Valid: true}
+	}
+	game = proto.Clone(game).(*storypb.Playthrough)
+	game.Id, game.ParentId, game.ParentTurn, game.Slot = nil, nil, nil, nil
+	blob, err := proto.Marshal(game)
+	if err != nil {
+		return 0, fmt.Errorf("could not marshal new game: %w", err)
+	}
+	res, err := txn.ExecContext(ctx, `INSERT INTO Playthroughs (proto, narration, parent_id, parent_turn, slot) VALUES (?, ?, ?, ?, ?)`,
+		blob, narration, pid, pturn, slot)
+	if err != nil {
+		return 0, fmt.Errorf("could not insert into Playthroughs: %w", err)
+	}
+	gid, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("could not read back created ID: %w", err)
+	}
+	return gid, nil
+}
+
+func writeGame(ctx context.Context, txn *sql.Tx, game *storypb.Playthrough, narration string) error {
+	gid := game.GetId()
+	blob, err := proto.Marshal(game)
+	if err != nil {
+		return fmt.Errorf("could not marshal updated playthrough %d of story %d: %w", gid, game.GetStoryId(), err)
+	}
+	if _, err := txn.ExecContext(ctx, `UPDATE Playthroughs SET proto = ?, narration = ? WHERE id = ?`, blob, narration, gid); err != nil {
+		return fmt.Errorf("could not update playthrough %d: %w", gid, err)
+	}
+	return nil
+}
+
+// writeTurn records a turn in the playthrough's history. The action,
+// narrator and narration have their own columns.
+func writeTurn(ctx context.Context, txn *sql.Tx, gid int64, rec *storypb.TurnRecord) error {
+	blob, err := proto.Marshal(&storypb.TurnRecord{
+		Effects: rec.GetEffects(),
+		Values:  rec.GetValues(),
+		State:   rec.GetState(),
+	})
+	if err != nil {
+		return fmt.Errorf("could not marshal turn %d of playthrough %d: %w", rec.GetTurn(), gid, err)
+	}
+	if _, err := txn.ExecContext(ctx, `INSERT INTO PlaythroughEvents (game_id, turn, action_id, narrator, narration, proto)
+                                     VALUES (?, ?, ?, ?, ?, ?)`,
+		gid, rec.GetTurn(), rec.GetActionId(), rec.GetNarrator(), rec.GetNarration(), blob); err != nil {
+		return fmt.Errorf("could not insert turn %d of playthrough %d: %w", rec.GetTurn(), gid, err)
+	}
+	return nil
+}
+
+func deleteTurns(ctx context.Context, txn *sql.Tx, gid, after int64) error {
+	if _, err := txn.ExecContext(ctx, `DELETE FROM PlaythroughEvents WHERE game_id = ? AND turn > ?`, gid, after); err != nil {
+		return fmt.Errorf("could not truncate history of playthrough %d: %w", gid, err)
+	}
+	return nil
+}
+
+func copyTurns(ctx context.Context, txn *sql.Tx, from, to int64) error {
+	if _, err := txn.ExecContext(ctx, `INSERT INTO PlaythroughEvents (game_id, turn, action_id, narrator, narration, proto)
+                                     SELECT ?, e.turn, e.action_id, e.narrator, e.narration, e.proto
+                                     FROM PlaythroughEvents AS e WHERE e.game_id = ?`, to, from); err != nil {
+		return fmt.Errorf("could not copy history of playthrough %d: %w", from, err)
+	}
+	return nil
+}
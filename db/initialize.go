@@ -4,18 +4,36 @@ package initialize
 import (
 	"context"
 	"database/sql"
+	"embed"
 	"fmt"
+	"io/fs"
 	"log"
 	"net"
 	"time"
 
 	"cloud.google.com/go/cloudsqlconn"
 	"github.com/go-sql-driver/mysql"
+	"github.com/pressly/goose/v3"
+	_ "modernc.org/sqlite"
 )
 
+// SQLiteNet is the connection type of a SQLite database, whose
+// address is the path of the database file.
+const SQLiteNet = "sqlite"
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
 // FromEnv returns a MySQL configuration object based on the
-// provided environment strings.
+// provided environment strings. For SQLite, only the network and
+// address are used.
 func FromEnv(user, pwd, network, addr, port, dbname string) (*mysql.Config, error) {
+	if network == SQLiteNet {
+		if len(addr) == 0 {
+			return nil, fmt.Errorf("no SQLite database file given")
+		}
+		return &mysql.Config{Net: SQLiteNet, Addr: addr}, nil
+	}
 	if len(pwd) > 0 {
 		pwd = fmt.Sprintf(":%s", pwd)
 	}
@@ -28,6 +46,9 @@ func FromEnv(user, pwd, network, addr, port, dbname string) (*mysql.Config, erro
 }
 
 func ConnectionPool(ctx context.Context, cfg *mysql.Config) (*sql.DB, func() error, error) {
+	if cfg.Net == SQLiteNet {
+		return sqlitePool(ctx, cfg.Addr)
+	}
 	cleanup := func() error { return nil } // Default no-op cleanup.
 	connString := cfg.FormatDSN()
 	log.Printf("Initializing database connection.")
@@ -76,3 +97,42 @@ func ConnectionPool(ctx context.Context, cfg *mysql.Config) (*sql.DB, func() err
 	log.Println("Database initialization succeeded.")
 	return db, cleanup, nil
 }
+
+// sqlitePool opens the SQLite database in the file, creating it if
+// needed, and brings its schema up to date.
+func sqlitePool(ctx context.Context, path string) (*sql.DB, func() error, error) {
+	cleanup := func() error { return nil }
+	log.Printf("Opening SQLite database %q.", path)
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, cleanup, fmt.Errorf("sql.Open(%s) failed: %w", dsn, err)
+	}
+	// SQLite has one writer at a time, and in-memory databases are
+	// private to their connection.
+	db.SetMaxOpenConns(1)
+
+	if err := MigrateSQLite(ctx, db); err != nil {
+		db.Close()
+		return nil, cleanup, err
+	}
+	log.Println("Database initialization succeeded.")
+	return db, cleanup, nil
+}
+
+// MigrateSQLite applies the SQLite variants of the migrations, which
+// are built into the binary.
+func MigrateSQLite(ctx context.Context, db *sql.DB) error {
+	fsys, err := fs.Sub(sqliteMigrations, "migrations/sqlite")
+	if err != nil {
+		return fmt.Errorf("could not find SQLite migrations: %w", err)
+	}
+	provider, err := goose.NewProvider(goose.DialectSQLite3, db, fsys)
+	if err != nil {
+		return fmt.Errorf("could not create migration provider: %w", err)
+	}
+	if _, err := provider.Up(ctx); err != nil {
+		return fmt.Errorf("goose up failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE Items (
+    story_id BIGINT UNSIGNED NOT NULL,
+    id VARCHAR(64) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    proto BLOB,
+    PRIMARY KEY (story_id, id),
+    FOREIGN KEY (story_id) REFERENCES Stories(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE Items;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE Playthroughs
+    ADD COLUMN parent_id BIGINT UNSIGNED,
+    ADD COLUMN parent_turn BIGINT,
+    ADD COLUMN slot VARCHAR(64),
+    ADD UNIQUE KEY playthrough_slot (parent_id, slot),
+    ADD CONSTRAINT playthrough_parent FOREIGN KEY (parent_id) REFERENCES Playthroughs(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE Playthroughs
+    DROP FOREIGN KEY playthrough_parent,
+    DROP INDEX playthrough_slot,
+    DROP COLUMN slot,
+    DROP COLUMN parent_turn,
+    DROP COLUMN parent_id;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The actions each location offers, which are otherwise only in its
+-- proto. Locations written before this table existed have no rows
+-- until they are next written.
+CREATE TABLE LocationActions (
+    location_id CHAR(36) NOT NULL,
+    action_id CHAR(36) NOT NULL,
+
+    PRIMARY KEY (location_id, action_id),
+    KEY location_action (action_id),
+    FOREIGN KEY (location_id) REFERENCES Locations(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE LocationActions;
+-- +goose StatementEnd
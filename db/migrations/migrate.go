@@ -34,7 +34,7 @@ func printDebugInfo(migrationFiles string) error {
 	}
 	entries, err = os.ReadDir(filepath.FromSlash(migrationFiles))
 	if err != nil {
-		fmt.Errorf("could not read migration directory %q: %v", migrationFiles, err)
+		return fmt.Errorf("could not read migration directory %q: %v", migrationFiles, err)
 	}
 	for idx, entry := range entries {
 		log.Printf("Migration entry %d: %v", idx, entry)
@@ -72,7 +72,12 @@ func migrate(rollback int64) error {
 	}
 	defer cleanup()
 
-	if err := goose.SetDialect("mysql"); err != nil {
+	// Point GOOSE_MIGRATION_FILES at the sqlite subdirectory for SQLite.
+	dialect := "mysql"
+	if config.Net == initialize.SQLiteNet {
+		dialect = "sqlite3"
+	}
+	if err := goose.SetDialect(dialect); err != nil {
 		return fmt.Errorf("failed to set goose dialect: %v", err)
 	}
 
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE Playthroughs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    proto BLOB,
+    narration TEXT
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE Playthroughs;
+-- +goose StatementEnd
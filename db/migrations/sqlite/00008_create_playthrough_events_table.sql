@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE PlaythroughEvents (
+    game_id INTEGER NOT NULL,
+    turn INTEGER NOT NULL,
+    action_id VARCHAR(64),
+    narrator VARCHAR(64),
+    narration TEXT,
+    proto BLOB,
+    PRIMARY KEY (game_id, turn),
+    FOREIGN KEY (game_id) REFERENCES Playthroughs(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE PlaythroughEvents;
+-- +goose StatementEnd
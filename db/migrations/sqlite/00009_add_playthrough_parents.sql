@@ -0,0 +1,21 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+ALTER TABLE Playthroughs ADD COLUMN parent_id INTEGER REFERENCES Playthroughs(id) ON DELETE SET NULL;
+ALTER TABLE Playthroughs ADD COLUMN parent_turn INTEGER;
+ALTER TABLE Playthroughs ADD COLUMN slot VARCHAR(64);
+CREATE UNIQUE INDEX playthrough_slot ON Playthroughs (parent_id, slot);
+
+-- +goose Down
+-- SQLite cannot drop a column with a foreign key, so the table is
+-- rebuilt, with keys off so that dropping the old one does not
+-- delete its history.
+PRAGMA foreign_keys = OFF;
+CREATE TABLE PlaythroughsOld (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    proto BLOB,
+    narration TEXT
+);
+INSERT INTO PlaythroughsOld (id, proto, narration) SELECT id, proto, narration FROM Playthroughs;
+DROP TABLE Playthroughs;
+ALTER TABLE PlaythroughsOld RENAME TO Playthroughs;
+PRAGMA foreign_keys = ON;
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/kingofmen/cyoa-exploratory/story"
 	"github.com/yuin/goldmark"
 	"google.golang.org/protobuf/proto"
 
@@ -21,9 +22,97 @@ type playData struct {
 	State     *storypb.GameDisplay
 	Narration template.HTML
 	Ended     bool
+	// Author shows the evaluation of every action condition.
+	Author bool
 }
 
-// CreatePlaythroughHandler creates a new playthrough for the requested story.
+// attrField describes an input for a custom character attribute.
+type attrField struct {
+	Key      string
+	Name     string
+	IsInt    bool
+	Min, Max string
+	Default  string
+	Choices  []string
+}
+
+// characterData holds data for the character-choice template.
+type characterData struct {
+	Story          *storypb.Story
+	StoryId        int64
+	CreateURI      string
+	StoryIdKey     string
+	CharacterIdKey string
+	NameKey        string
+	CustomId       string
+	AllowCustom    bool
+	PointBudget    int64
+	Attributes     []*attrField
+}
+
+func makeCharacterData(str *storypb.Story) *characterData {
+	rules := str.GetCharacterRules()
+	data := &characterData{
+		Story:          str,
+		StoryId:        str.GetId(),
+		CreateURI:      CreateGameURL,
+		StoryIdKey:     storyIdKey,
+		CharacterIdKey: charIdKey,
+		NameKey:        charNameKey,
+		CustomId:       story.CustomCharacterId,
+		AllowCustom:    rules.GetAllowCustom(),
+		PointBudget:    rules.GetPointBudget(),
+	}
+	for _, attr := range rules.GetAttributes() {
+		field := &attrField{
+			Key:     charAttrPrefix + attr.GetName(),
+			Name:    attr.GetName(),
+			IsInt:   attr.GetType() == storypb.Variable_VT_INT,
+			Default: attr.GetDefaultStr(),
+			Choices: attr.GetChoices(),
+		}
+		if field.IsInt {
+			field.Default = strconv.FormatInt(attr.GetDefaultInt(), 10)
+		}
+		if attr.Min != nil {
+			field.Min = strconv.FormatInt(attr.GetMin(), 10)
+		}
+		if attr.Max != nil {
+			field.Max = strconv.FormatInt(attr.GetMax(), 10)
+		}
+		data.Attributes = append(data.Attributes, field)
+	}
+	return data
+}
+
+// customCharacter reads a custom character from the submitted form.
+func customCharacter(req *http.Request, str *storypb.Story) (*storypb.Character, error) {
+	char := &storypb.Character{
+		Name:    proto.String(req.FormValue(charNameKey)),
+		Values:  make(map[string]int64),
+		Strings: make(map[string]string),
+	}
+	for _, attr := range str.GetCharacterRules().GetAttributes() {
+		name := attr.GetName()
+		val := req.FormValue(charAttrPrefix + name)
+		if len(val) == 0 {
+			continue
+		}
+		if attr.GetType() != storypb.Variable_VT_INT {
+			char.Strings[name] = val
+			continue
+		}
+		num, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s %q: %w", name, val, err)
+		}
+		char.Values[name] = num
+	}
+	return char, nil
+}
+
+// CreatePlaythroughHandler creates a new playthrough for the requested
+// story, first asking for a character if the story has any.
 func (h *Handler) CreatePlaythroughHandler(w http.ResponseWriter, req *http.Request) {
 	sid, err := getStoryId(req)
 	if err != nil {
@@ -32,11 +121,38 @@ func (h *Handler) CreatePlaythroughHandler(w http.ResponseWriter, req *http.Requ
 	}
 
 	ctx := req.Context()
-	resp, err := h.client.CreateGame(ctx, &spb.CreateGameRequest{
-		StoryId: proto.Int64(sid),
+	sresp, err := h.client.GetStory(ctx, &spb.GetStoryRequest{
+		Id:   proto.Int64(sid),
+		View: spb.StoryView_VIEW_PROTO.Enum(),
 	})
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error creating playthrough: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Cannot load story %d to create playthrough: %v", sid, err), httpStatus(err))
+		return
+	}
+	str := sresp.GetStory()
+	greq := &spb.CreateGameRequest{
+		StoryId: proto.Int64(sid),
+	}
+	switch cid := req.FormValue(charIdKey); cid {
+	case "":
+		if len(str.GetCharacters()) > 0 || str.GetCharacterRules().GetAllowCustom() {
+			if err := h.charTmpl.Execute(w, makeCharacterData(str)); err != nil {
+				log.Printf("Character template execution error: %v", err)
+			}
+			return
+		}
+	case story.CustomCharacterId:
+		if greq.CustomCharacter, err = customCharacter(req, str); err != nil {
+			http.Error(w, fmt.Sprintf("Bad custom character: %v", err), http.StatusBadRequest)
+			return
+		}
+	default:
+		greq.CharacterId = proto.String(cid)
+	}
+
+	resp, err := h.client.CreateGame(ctx, greq)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error creating playthrough: %v", err), httpStatus(err))
 		return
 	}
 
@@ -51,8 +167,10 @@ func (h *Handler) PlayGameHandler(w http.ResponseWriter, req *http.Request) {
 	}
 
 	ctx := req.Context()
+	author := len(req.URL.Query().Get(authorKey)) > 0
 	gsr := &spb.GameStateRequest{
 		GameId: proto.Int64(gid),
+		Author: proto.Bool(author),
 	}
 	astr := ""
 	if req.Method == http.MethodPost {
@@ -71,7 +189,7 @@ func (h *Handler) PlayGameHandler(w http.ResponseWriter, req *http.Request) {
 
 	resp, err := h.client.GameState(ctx, gsr)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Cannot load playthrough %d%s: %v", gid, astr, err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Cannot load playthrough %d%s: %v", gid, astr, err), httpStatus(err))
 		return
 	}
 
@@ -88,12 +206,58 @@ func (h *Handler) PlayGameHandler(w http.ResponseWriter, req *http.Request) {
 		State:     resp.GetState(),
 		Narration: template.HTML(mdbuf.String()),
 		Ended:     resp.GetState().GetRunState() == storypb.RunState_RS_COMPLETE,
+		Author:    author,
 	}
 	if err := h.playTmpl.Execute(w, data); err != nil {
 		log.Printf("Play template execution error: %v", err)
 	}
 }
 
+// UndoTurnHandler rewinds a playthrough by one turn.
+func (h *Handler) UndoTurnHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "undo requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+	gid, err := getGameId(req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Cannot parse game ID to undo: %v", err), http.StatusBadRequest)
+		return
+	}
+	if _, err := h.client.RewindGame(req.Context(), &spb.RewindGameRequest{GameId: proto.Int64(gid)}); err != nil {
+		http.Error(w, fmt.Sprintf("Cannot undo last turn of playthrough %d: %v", gid, err), httpStatus(err))
+		return
+	}
+	http.Redirect(w, req, fmt.Sprintf("%s?game_id=%d", PlayGameURL, gid), http.StatusSeeOther)
+}
+
+// ForkGameHandler copies a playthrough, optionally into a named save
+// slot, and returns to the original.
+func (h *Handler) ForkGameHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "fork requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+	gid, err := getGameId(req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Cannot parse game ID to fork: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("bad form: %v", err), http.StatusBadRequest)
+		return
+	}
+	fgr := &spb.ForkGameRequest{GameId: proto.Int64(gid)}
+	if slot := req.FormValue(slotKey); len(slot) > 0 {
+		fgr.Slot = proto.String(slot)
+	}
+	if _, err := h.client.ForkGame(req.Context(), fgr); err != nil {
+		http.Error(w, fmt.Sprintf("Cannot fork playthrough %d: %v", gid, err), httpStatus(err))
+		return
+	}
+	http.Redirect(w, req, fmt.Sprintf("%s?game_id=%d", PlayGameURL, gid), http.StatusSeeOther)
+}
+
 // ArchiveGameHandler handles archiving a playthrough.
 func (h *Handler) ArchiveGameHandler(w http.ResponseWriter, req *http.Request) {
 	params := req.URL.Query()
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/kingofmen/cyoa-exploratory/logic"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	lpb "github.com/kingofmen/cyoa-exploratory/logic/proto"
+)
+
+// predicateText is the JSON exchanged with the story editor
+// when converting predicates to and from text.
+type predicateText struct {
+	Text   string `json:"text"`
+	Error  string `json:"error,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, bts []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(bts)
+}
+
+// ParsePredicateHandler converts predicate text into the JSON
+// form of a Predicate proto, or reports where the text is wrong.
+func (h *Handler) ParsePredicateHandler(w http.ResponseWriter, req *http.Request) {
+	var in predicateText
+	if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
+		http.Error(w, fmt.Sprintf("could not parse request object: %v", err), http.StatusBadRequest)
+		return
+	}
+	pred, err := logic.Parse(in.Text)
+	if err != nil {
+		out := predicateText{Text: in.Text, Error: err.Error()}
+		var perr *logic.ParseError
+		if errors.As(err, &perr) {
+			out.Error, out.Line, out.Column = perr.Msg, perr.Line, perr.Column
+		}
+		bts, _ := json.Marshal(out)
+		writeJSON(w, http.StatusBadRequest, bts)
+		return
+	}
+	bts, err := protojson.Marshal(pred)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error marshaling proto: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, bts)
+}
+
+// FormatPredicateHandler converts the JSON form of a Predicate
+// proto into predicate text.
+func (h *Handler) FormatPredicateHandler(w http.ResponseWriter, req *http.Request) {
+	bts, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not read request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	pred := &lpb.Predicate{}
+	opts := protojson.UnmarshalOptions{DiscardUnknown: true}
+	if err := opts.Unmarshal(bts, pred); err != nil {
+		http.Error(w, fmt.Sprintf("could not parse predicate: %v", err), http.StatusBadRequest)
+		return
+	}
+	bts, err = json.Marshal(predicateText{Text: logic.Format(pred)})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error marshaling JSON: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, bts)
+}
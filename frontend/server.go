@@ -15,6 +15,8 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/microcosm-cc/bluemonday"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 
@@ -30,16 +32,28 @@ const (
 	DeleteStoryURL         = "/api/story/delete"
 	CreateGameURL          = "/api/game/create"
 	PlayGameURL            = "/play"
+	UndoTurnURL            = "/undo_turn"
+	ForkGameURL            = "/fork_game"
 	ArchiveGameURL         = "/archive_game"
-
-	createCtx  = "create"
-	updateCtx  = "update"
-	titleKey   = "title_key"
-	contentKey = "content_key"
-	locIdKey   = "location_id_key"
-	deleteKey  = "delete_key"
-	storyIdKey = "story_id"
-	gameIdKey  = "game_id"
+	ParsePredicateURL      = "/api/predicate/parse"
+	FormatPredicateURL     = "/api/predicate/format"
+
+	createCtx   = "create"
+	updateCtx   = "update"
+	titleKey    = "title_key"
+	contentKey  = "content_key"
+	locIdKey    = "location_id_key"
+	deleteKey   = "delete_key"
+	storyIdKey  = "story_id"
+	gameIdKey   = "game_id"
+	slotKey     = "slot"
+	charIdKey   = "character_id"
+	charNameKey = "character_name"
+	// Play pages with this query parameter show the author's debug
+	// panel. Anyone can set it; the backend decides whether to honour it.
+	authorKey = "author"
+	// Custom character attributes are form fields with this prefix.
+	charAttrPrefix = "attr_"
 )
 
 // indexData holds data for the front page.
@@ -70,6 +84,7 @@ type Handler struct {
 	index    *template.Template
 	editTmpl *template.Template
 	playTmpl *template.Template
+	charTmpl *template.Template
 	client   spb.CyoaClient
 	mdPolicy *bluemonday.Policy
 }
@@ -80,11 +95,40 @@ func NewHandler(cl spb.CyoaClient) *Handler {
 		index:    template.Must(template.ParseFiles("frontend/content/index.html")),
 		editTmpl: template.Must(template.ParseFiles("frontend/story_editor_app/dist/story_editor.html")),
 		playTmpl: template.Must(template.ParseFiles("frontend/content/game.html")),
+		charTmpl: template.Must(template.ParseFiles("frontend/content/character.html")),
 		client:   cl,
 		mdPolicy: bluemonday.UGCPolicy(),
 	}
 }
 
+// httpStatus returns the HTTP status matching the gRPC code of an
+// error from the backend.
+func httpStatus(err error) int {
+	switch status.Code(err) {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
 func makeKey(ctx, key string) string {
 	return fmt.Sprintf("%s_%s", ctx, key)
 }
@@ -94,6 +138,10 @@ type gameDisplay struct {
 	Id    int64
 	Title string
 	State string
+	// For forks, the game and turn they were forked from.
+	ParentId   int64
+	ParentTurn int64
+	Slot       string
 }
 
 func makeIndexData() indexData {
@@ -113,12 +161,12 @@ func makeIndexData() indexData {
 func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	strResp, err := h.client.ListStories(req.Context(), &spb.ListStoriesRequest{})
 	if err != nil {
-		http.Error(w, fmt.Errorf("could not load stories: %w", err).Error(), http.StatusInternalServerError)
+		http.Error(w, fmt.Errorf("could not load stories: %w", err).Error(), httpStatus(err))
 		return
 	}
 	gamResp, err := h.client.ListGames(req.Context(), &spb.ListGamesRequest{})
 	if err != nil {
-		http.Error(w, fmt.Errorf("could not load stories: %w", err).Error(), http.StatusInternalServerError)
+		http.Error(w, fmt.Errorf("could not load games: %w", err).Error(), httpStatus(err))
 		return
 	}
 	data := makeIndexData()
@@ -130,9 +178,12 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	data.Games = make([]*gameDisplay, 0, len(gamResp.GetGames()))
 	for _, gam := range gamResp.GetGames() {
 		data.Games = append(data.Games, &gameDisplay{
-			Id:    gam.GetId(),
-			Title: storyTitles[gam.GetStoryId()],
-			State: gam.GetState().String(),
+			Id:         gam.GetId(),
+			Title:      storyTitles[gam.GetStoryId()],
+			State:      gam.GetState().String(),
+			ParentId:   gam.GetParentId(),
+			ParentTurn: gam.GetParentTurn(),
+			Slot:       gam.GetSlot(),
 		})
 	}
 
@@ -155,7 +206,7 @@ func (h *Handler) CreateLocation(w http.ResponseWriter, req *http.Request) {
 		Location: locData,
 	})
 	if err != nil {
-		http.Error(w, fmt.Errorf("error creating location: %w", err).Error(), http.StatusInternalServerError)
+		http.Error(w, fmt.Errorf("error creating location: %w", err).Error(), httpStatus(err))
 		return
 	}
 	log.Printf("Location with title %q updated by frontend handler.", title)
@@ -172,7 +223,7 @@ func (h *Handler) deleteLocation(ctx context.Context, locID string) error {
 func (h *Handler) updateLocation(ctx context.Context, locID string, title, content string) error {
 	_, err := h.client.GetLocation(ctx, &spb.GetLocationRequest{LocationId: proto.String(locID)})
 	if err != nil {
-		return fmt.Errorf("error fetching location to prepare update for ID %s: %v", locID, err)
+		return fmt.Errorf("error fetching location to prepare update for ID %s: %w", locID, err)
 	}
 
 	if _, err = h.client.UpdateLocation(ctx, &spb.UpdateLocationRequest{
@@ -183,7 +234,7 @@ func (h *Handler) updateLocation(ctx context.Context, locID string, title, conte
 			Description: proto.String(content),
 		},
 	}); err != nil {
-		return fmt.Errorf("Error updating location with ID %d: %v", locID, err)
+		return fmt.Errorf("Error updating location with ID %s: %w", locID, err)
 	}
 	return nil
 }
@@ -214,16 +265,16 @@ func (h *Handler) UpdateLocationHandler(w http.ResponseWriter, req *http.Request
 	ctx := req.Context()
 	if deleteFlag {
 		if err := h.deleteLocation(ctx, lid); err != nil {
-			http.Error(w, fmt.Sprintf("Error deleting location with ID %d: %v", lid, err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Error deleting location with ID %s: %v", lid, err), httpStatus(err))
 			return
 		}
-		log.Printf("Location with ID %d deleted by frontend handler.", lid)
+		log.Printf("Location with ID %s deleted by frontend handler.", lid)
 	} else {
 		if err := h.updateLocation(ctx, lid, newTitle, newContent); err != nil {
-			http.Error(w, fmt.Sprintf("Error updating location with ID %s: %v", lid, err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Error updating location with ID %s: %v", lid, err), httpStatus(err))
 			return
 		}
-		log.Printf("Location with ID %d updated by frontend handler.", lid)
+		log.Printf("Location with ID %s updated by frontend handler.", lid)
 	}
 	http.Redirect(w, req, "/", http.StatusSeeOther)
 }
@@ -253,7 +304,7 @@ func (h *Handler) EditStoryHandler(w http.ResponseWriter, req *http.Request) {
 			View: spb.StoryView_VIEW_CONTENT.Enum(),
 		})
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Cannot find story with ID %d: %v", sid, err), http.StatusBadRequest)
+			http.Error(w, fmt.Sprintf("Cannot find story with ID %d: %v", sid, err), httpStatus(err))
 			return
 		}
 
@@ -296,7 +347,7 @@ func (h *Handler) CreateOrUpdateStoryHandler(w http.ResponseWriter, req *http.Re
 	ctx := req.Context()
 	updResp, err := h.client.UpdateStory(ctx, updReq)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("backend error: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("backend error: %v", err), httpStatus(err))
 		return
 	}
 
@@ -327,7 +378,7 @@ func (h *Handler) DeleteStoryHandler(w http.ResponseWriter, req *http.Request) {
 			if _, err := h.client.DeleteStory(ctx, &spb.DeleteStoryRequest{
 				Id: proto.Int64(sid),
 			}); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to delete story with ID %q: %v", strid, err), http.StatusBadRequest)
+				http.Error(w, fmt.Sprintf("Failed to delete story with ID %q: %v", strid, err), httpStatus(err))
 				return
 			}
 		}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	cases := []struct {
+		desc string
+		err  error
+		want int
+	}{
+		{desc: "No error", want: http.StatusOK},
+		{desc: "Invalid argument", err: status.Error(codes.InvalidArgument, "bad ID"), want: http.StatusBadRequest},
+		{desc: "Refused action", err: status.Error(codes.FailedPrecondition, "not allowed"), want: http.StatusBadRequest},
+		{desc: "Missing story", err: status.Error(codes.NotFound, "no story 3"), want: http.StatusNotFound},
+		{desc: "Duplicate", err: status.Error(codes.AlreadyExists, "exists"), want: http.StatusConflict},
+		{desc: "Database down", err: status.Error(codes.Unavailable, "no connection"), want: http.StatusServiceUnavailable},
+		{desc: "Timeout", err: status.Error(codes.DeadlineExceeded, "too slow"), want: http.StatusGatewayTimeout},
+		{desc: "Wrapped", err: fmt.Errorf("could not list: %w", status.Error(codes.NotFound, "gone")), want: http.StatusNotFound},
+		{desc: "Unknown", err: status.Error(codes.Unknown, "mystery"), want: http.StatusInternalServerError},
+		{desc: "Plain error", err: errors.New("ironman"), want: http.StatusInternalServerError},
+	}
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			if got := httpStatus(cc.err); got != cc.want {
+				t.Errorf("%s: httpStatus(%v) => %d, want %d", cc.desc, cc.err, got, cc.want)
+			}
+		})
+	}
+}
+
+// callJSON posts the body to the handler and returns the status and
+// response body.
+func callJSON(handler http.HandlerFunc, body string) (int, string) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec.Code, rec.Body.String()
+}
+
+func TestPredicateRoundTrip(t *testing.T) {
+	h := &Handler{}
+	for _, text := range []string{
+		"gold > 10",
+		"all(gold > 1, class == 'rogue')",
+		"none(class in ['fighter', 'wizard'])",
+		"any(1d6 + str >= 4, inv.lockpick > 0)",
+	} {
+		t.Run(text, func(t *testing.T) {
+			in, err := json.Marshal(predicateText{Text: text})
+			if err != nil {
+				t.Fatalf("Marshal(%q) => %v", text, err)
+			}
+			code, pred := callJSON(h.ParsePredicateHandler, string(in))
+			if code != http.StatusOK {
+				t.Fatalf("ParsePredicateHandler(%q) => %d %s, want %d", text, code, pred, http.StatusOK)
+			}
+			code, body := callJSON(h.FormatPredicateHandler, pred)
+			if code != http.StatusOK {
+				t.Fatalf("FormatPredicateHandler(%s) => %d %s, want %d", pred, code, body, http.StatusOK)
+			}
+			var got predicateText
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatalf("FormatPredicateHandler(%s) => %s, not JSON: %v", pred, body, err)
+			}
+			if got.Text != text {
+				t.Errorf("FormatPredicateHandler(%s) => %q, want %q", pred, got.Text, text)
+			}
+		})
+	}
+}
+
+func TestPredicateParseErrors(t *testing.T) {
+	h := &Handler{}
+	cases := []struct {
+		desc string
+		text string
+		want predicateText
+	}{
+		{
+			desc: "Missing operand",
+			text: "gold >",
+			want: predicateText{Line: 1, Column: 7, Error: "expected operand, found end of input"},
+		},
+		{
+			desc: "Later line",
+			text: "all(\n  gold > 1,\n  silver >)",
+			want: predicateText{Line: 3, Column: 11, Error: "expected operand"},
+		},
+		{
+			desc: "Unclosed combination",
+			text: "any(gold > 1",
+			want: predicateText{Line: 1, Column: 13, Error: "expected ',', found end of input"},
+		},
+		{
+			desc: "Unterminated string",
+			text: "class == 'rogue",
+			want: predicateText{Line: 1, Column: 10, Error: "unterminated string literal"},
+		},
+	}
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			in, err := json.Marshal(predicateText{Text: cc.text})
+			if err != nil {
+				t.Fatalf("Marshal(%q) => %v", cc.text, err)
+			}
+			code, body := callJSON(h.ParsePredicateHandler, string(in))
+			if code != http.StatusBadRequest {
+				t.Errorf("%s: ParsePredicateHandler(%q) => %d, want %d", cc.desc, cc.text, code, http.StatusBadRequest)
+			}
+			var got predicateText
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatalf("%s: ParsePredicateHandler(%q) => %s, not JSON: %v", cc.desc, cc.text, body, err)
+			}
+			cc.want.Text = cc.text
+			if diff := cmp.Diff(cc.want, got); diff != "" {
+				t.Errorf("%s: ParsePredicateHandler(%q) => diff (-want +got)\n%s", cc.desc, cc.text, diff)
+			}
+		})
+	}
+}
+
+func TestPredicateBadRequests(t *testing.T) {
+	h := &Handler{}
+	if code, _ := callJSON(h.ParsePredicateHandler, "not json"); code != http.StatusBadRequest {
+		t.Errorf("ParsePredicateHandler(not json) => %d, want %d", code, http.StatusBadRequest)
+	}
+	if code, _ := callJSON(h.FormatPredicateHandler, `{"comp": 3}`); code != http.StatusBadRequest {
+		t.Errorf("FormatPredicateHandler(bad predicate) => %d, want %d", code, http.StatusBadRequest)
+	}
+}
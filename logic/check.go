@@ -0,0 +1,223 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	lpb "github.com/kingofmen/cyoa-exploratory/logic/proto"
+)
+
+// VarType is the type of a declared variable.
+type VarType int
+
+const (
+	IntVar VarType = iota
+	StrVar
+	StrArrVar
+	// AnyVar is the type of undeclared variables in an open schema,
+	// which may be used as any type.
+	AnyVar
+)
+
+func (vt VarType) String() string {
+	switch vt {
+	case IntVar:
+		return "integer"
+	case StrVar:
+		return "string"
+	case StrArrVar:
+		return "string array"
+	case AnyVar:
+		return "any"
+	}
+	return fmt.Sprintf("VarType(%d)", int(vt))
+}
+
+// Schema declares the variables and scopes which predicates may
+// refer to, for static checking.
+type Schema struct {
+	vars   map[string]VarType
+	scopes map[string]*Schema
+	// open schemas accept undeclared variables, though not
+	// undeclared scopes or keys within scopes.
+	open bool
+}
+
+// NewSchema returns an empty Schema.
+func NewSchema() *Schema {
+	return &Schema{
+		vars:   make(map[string]VarType),
+		scopes: make(map[string]*Schema),
+	}
+}
+
+// WithVar declares a variable.
+func (s *Schema) WithVar(name string, vt VarType) *Schema {
+	if s == nil {
+		s = NewSchema()
+	}
+	s.vars[name] = vt
+	return s
+}
+
+// WithScope declares a scope with its own variables.
+func (s *Schema) WithScope(name string, scope *Schema) *Schema {
+	if s == nil {
+		s = NewSchema()
+	}
+	s.scopes[name] = scope
+	return s
+}
+
+// Open makes the schema accept undeclared variables, with type
+// AnyVar, for stories which do not declare theirs.
+func (s *Schema) Open() *Schema {
+	if s == nil {
+		s = NewSchema()
+	}
+	s.open = true
+	return s
+}
+
+// Lookup returns the type of the (possibly scoped) key.
+func (s *Schema) Lookup(key string) (VarType, error) {
+	if s == nil {
+		return 0, fmt.Errorf("no schema for key %q", key)
+	}
+	scope, skey, has := strings.Cut(key, kScopeSeparator)
+	if has {
+		sub, ok := s.scopes[scope]
+		if !ok {
+			return 0, fmt.Errorf("unknown scope %q in key %q", scope, key)
+		}
+		return sub.Lookup(skey)
+	}
+	vt, ok := s.vars[key]
+	switch {
+	case !ok && s.open:
+		return AnyVar, nil
+	case !ok:
+		return 0, fmt.Errorf("unknown variable %q", key)
+	}
+	return vt, nil
+}
+
+// checkKey returns an error if the key is not declared with the given type.
+func (s *Schema) checkKey(key string, want VarType) error {
+	vt, err := s.Lookup(key)
+	if err != nil {
+		return err
+	}
+	if vt != want && vt != AnyVar {
+		return fmt.Errorf("%q has type %v, used as %v", key, vt, want)
+	}
+	return nil
+}
+
+// checkInt returns an error if the key is not an integer literal,
+// integer variable, or expression over those.
+func (s *Schema) checkInt(key string) error {
+	if _, err := strconv.Atoi(key); err == nil {
+		return nil
+	}
+	if !isExpression(key) {
+		return s.checkKey(key, IntVar)
+	}
+	ex, err := parseExpr(key)
+	if err != nil {
+		return fmt.Errorf("could not parse integer expression %q: %w", key, err)
+	}
+	var errs []error
+	walkKeys(ex, func(k string) {
+		errs = append(errs, s.checkKey(k, IntVar))
+	})
+	return errors.Join(errs...)
+}
+
+// CheckInt returns an error if the integer key refers to
+// variables which are undeclared or not integers.
+func CheckInt(key string, schema *Schema) error {
+	return schema.checkInt(key)
+}
+
+// CheckStr returns an error if the string key refers to a
+// variable which is undeclared or not a string.
+func CheckStr(key string, schema *Schema) error {
+	return schema.checkStr(key)
+}
+
+// walkKeys calls fn on every lookup key in the expression.
+func walkKeys(ex expr, fn func(string)) {
+	switch e := ex.(type) {
+	case keyExpr:
+		fn(string(e))
+	case *negExpr:
+		walkKeys(e.arg, fn)
+	case *binExpr:
+		walkKeys(e.lhs, fn)
+		walkKeys(e.rhs, fn)
+	case *callExpr:
+		for _, arg := range e.args {
+			walkKeys(arg, fn)
+		}
+	}
+}
+
+// checkStr returns an error if the key is not a string literal
+// or string variable.
+func (s *Schema) checkStr(key string) error {
+	if isStrLiteral(key) {
+		return nil
+	}
+	return s.checkKey(key, StrVar)
+}
+
+// checkStrArr returns an error if the key is not an array
+// literal of strings or a string-array variable.
+func (s *Schema) checkStrArr(key string) error {
+	if l, ok := strings.CutSuffix(key, "]"); ok {
+		if literal, ok := strings.CutPrefix(l, "["); ok {
+			var errs []error
+			for _, entry := range strings.Split(literal, ",") {
+				errs = append(errs, s.checkStr(strings.Trim(entry, " ")))
+			}
+			return errors.Join(errs...)
+		}
+	}
+	return s.checkKey(key, StrArrVar)
+}
+
+func (s *Schema) checkComparison(comp *lpb.Compare) error {
+	one, two := comp.GetKeyOne(), comp.GetKeyTwo()
+	switch op := comp.GetOperation(); op {
+	case lpb.Compare_CMP_GT, lpb.Compare_CMP_LT, lpb.Compare_CMP_EQ, lpb.Compare_CMP_GTE, lpb.Compare_CMP_LTE, lpb.Compare_CMP_NEQ:
+		return errors.Join(s.checkInt(one), s.checkInt(two))
+	case lpb.Compare_CMP_STREQ:
+		return errors.Join(s.checkStr(one), s.checkStr(two))
+	case lpb.Compare_CMP_STRIN:
+		return errors.Join(s.checkStr(one), s.checkStrArr(two))
+	default:
+		return fmt.Errorf("unknown operator %v", op)
+	}
+}
+
+// Check returns an error describing every key in the predicate
+// which is undeclared, has the wrong type, or uses an unknown
+// scope. A nil error means the predicate is well-typed.
+func Check(pred *lpb.Predicate, schema *Schema) error {
+	if comb := pred.GetComb(); comb != nil {
+		var errs []error
+		for _, sub := range comb.GetOperands() {
+			errs = append(errs, Check(sub, schema))
+		}
+		return errors.Join(errs...)
+	}
+	if comp := pred.GetComp(); comp != nil {
+		if err := schema.checkComparison(comp); err != nil {
+			return fmt.Errorf("%s: %w", Format(pred), err)
+		}
+	}
+	return nil
+}
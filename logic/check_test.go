@@ -0,0 +1,118 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	schema := NewSchema().
+		WithVar("gold", IntVar).
+		WithVar("silver", IntVar).
+		WithVar("class", StrVar).
+		WithVar("inventory", StrArrVar).
+		WithScope("ogre", NewSchema().WithVar("strength", IntVar))
+
+	cases := []struct {
+		desc string
+		text string
+		// Substrings of the expected error; none means well-typed.
+		want []string
+	}{
+		{
+			desc: "Unconditional",
+			text: "true",
+		},
+		{
+			desc: "Well-typed",
+			text: "all(gold + silver/10 >= 50, 2*ogre.strength < gold, any(class == 'fighter', 'sword' in inventory), class in ['rogue', class])",
+		},
+		{
+			desc: "Unknown key",
+			text: "glod > 10",
+			want: []string{`glod > 10: unknown variable "glod"`},
+		},
+		{
+			desc: "Unknown key in expression",
+			text: "gold + silverr > 10",
+			want: []string{`unknown variable "silverr"`},
+		},
+		{
+			desc: "String compared as integer",
+			text: "class > 3",
+			want: []string{`"class" has type string, used as integer`},
+		},
+		{
+			desc: "Integer compared as string",
+			text: "gold == 'lots'",
+			want: []string{`"gold" has type integer, used as string`},
+		},
+		{
+			desc: "Array needed",
+			text: "'sword' in class",
+			want: []string{`"class" has type string, used as string array`},
+		},
+		{
+			desc: "Bad scope",
+			text: "troll.strength > 3",
+			want: []string{`unknown scope "troll"`},
+		},
+		{
+			desc: "Unknown key in scope",
+			text: "ogre.dexterity > 3",
+			want: []string{`unknown variable "dexterity"`},
+		},
+		{
+			desc: "All errors reported",
+			text: "any(glod > 1, class > 2, 'x' in [gold])",
+			want: []string{`"glod"`, `"class"`, `"gold"`},
+		},
+	}
+
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			pred, err := Parse(cc.text)
+			if err != nil {
+				t.Fatalf("%s: Parse(%q) => %v, want nil", cc.desc, cc.text, err)
+			}
+			err = Check(pred, schema)
+			if len(cc.want) == 0 {
+				if err != nil {
+					t.Errorf("%s: Check(%q) => %v, want nil", cc.desc, cc.text, err)
+				}
+				return
+			}
+			got := fmt.Sprintf("%v", err)
+			for _, want := range cc.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("%s: Check(%q) => %v, want %q", cc.desc, cc.text, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckOpen(t *testing.T) {
+	schema := NewSchema().
+		WithVar("class", StrVar).
+		WithScope("ogre", NewSchema().WithVar("strength", IntVar)).
+		Open()
+	for text, ok := range map[string]bool{
+		"gold > 10":                       true,
+		"'sword' in inventory":            true,
+		"gold + ogre.strength > 3":        true,
+		"class > 3":                       false,
+		"ogre.dexterity > 3":              false,
+		"troll.strength > 3":              false,
+		"all(gold > 1, class == 'rogue')": true,
+	} {
+		pred, err := Parse(text)
+		if err != nil {
+			t.Fatalf("Parse(%q) => %v, want nil", text, err)
+		}
+		if err := Check(pred, schema); (err == nil) != ok {
+			t.Errorf("Check(%q) => %v, want ok %v", text, err, ok)
+		}
+	}
+}
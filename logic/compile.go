@@ -0,0 +1,322 @@
+package logic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	lpb "github.com/kingofmen/cyoa-exploratory/logic/proto"
+)
+
+// Program is a compiled predicate, with its literals parsed and
+// its keys split into scope paths once rather than on every
+// evaluation. It gives the same results as Eval.
+type Program interface {
+	Eval(lookup Lookup) (bool, error)
+}
+
+// Compile returns a reusable evaluator for the predicate.
+func Compile(pred *lpb.Predicate) (Program, error) {
+	if comb := pred.GetComb(); comb != nil {
+		return compileCombination(comb)
+	}
+	if comp := pred.GetComp(); comp != nil {
+		return compileComparison(comp)
+	}
+	return constProgram(true), nil
+}
+
+// constProgram always returns the same value.
+type constProgram bool
+
+func (c constProgram) Eval(_ Lookup) (bool, error) {
+	return bool(c), nil
+}
+
+// combProgram is a compiled Combine.
+type combProgram struct {
+	op       lpb.Combine_Op
+	operands []Program
+}
+
+func compileCombination(comb *lpb.Combine) (Program, error) {
+	op := comb.GetOperation()
+	if _, ok := lpb.Combine_Op_name[int32(op)]; !ok {
+		return constProgram(false), nil
+	}
+	prog := &combProgram{op: op}
+	for idx, sub := range comb.GetOperands() {
+		sprog, err := Compile(sub)
+		if err != nil {
+			return nil, fmt.Errorf("operand %d: %w", idx, err)
+		}
+		prog.operands = append(prog.operands, sprog)
+	}
+	return prog, nil
+}
+
+func (c *combProgram) Eval(lookup Lookup) (bool, error) {
+	// The value which decides the combination early.
+	decisive := c.op != lpb.Combine_IF_ALL
+	for _, p := range c.operands {
+		v, err := p.Eval(lookup)
+		if err != nil {
+			return false, err
+		}
+		if v == decisive {
+			return c.op == lpb.Combine_IF_ANY, nil
+		}
+	}
+	return c.op != lpb.Combine_IF_ANY, nil
+}
+
+// path is a key split into its scopes.
+type path struct {
+	full   string
+	scopes []string
+	key    string
+}
+
+func newPath(key string) *path {
+	p := &path{full: key}
+	parts := strings.Split(key, kScopeSeparator)
+	p.scopes, p.key = parts[:len(parts)-1], parts[len(parts)-1]
+	return p
+}
+
+// resolve returns the innermost scope of the path.
+func (p *path) resolve(lookup Lookup, kind string) (Lookup, error) {
+	for _, scope := range p.scopes {
+		next := lookup.GetScope(scope)
+		if next == nil {
+			return nil, fmt.Errorf("invalid scope lookup %q from %s key %q", scope, kind, p.full)
+		}
+		lookup = next
+	}
+	return lookup, nil
+}
+
+// intPath is a compiled integer lookup; it is also an expression leaf.
+type intPath struct {
+	*path
+}
+
+func (ip intPath) eval(lookup Lookup) (int64, error) {
+	scope, err := ip.resolve(lookup, "integer")
+	if err != nil {
+		return 0, err
+	}
+	return scope.GetInt(ip.key)
+}
+
+// compileInt returns the integer operand as an expression with
+// its keys pre-split.
+func compileInt(key string) (expr, error) {
+	if val, err := strconv.Atoi(key); err == nil {
+		return litExpr(val), nil
+	}
+	if !isExpression(key) {
+		return intPath{newPath(key)}, nil
+	}
+	ex, err := parseExpr(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse integer expression %q: %w", key, err)
+	}
+	return &wrappedExpr{key: key, ex: compileKeys(ex)}, nil
+}
+
+// compileKeys replaces the lookup keys of the expression with paths.
+func compileKeys(ex expr) expr {
+	switch e := ex.(type) {
+	case keyExpr:
+		return intPath{newPath(string(e))}
+	case *negExpr:
+		return &negExpr{arg: compileKeys(e.arg)}
+	case *binExpr:
+		return &binExpr{op: e.op, lhs: compileKeys(e.lhs), rhs: compileKeys(e.rhs)}
+	case *callExpr:
+		call := &callExpr{name: e.name}
+		for _, arg := range e.args {
+			call.args = append(call.args, compileKeys(arg))
+		}
+		return call
+	}
+	return ex
+}
+
+// wrappedExpr annotates evaluation errors with the expression text, like getInt.
+type wrappedExpr struct {
+	key string
+	ex  expr
+}
+
+func (w *wrappedExpr) eval(lookup Lookup) (int64, error) {
+	val, err := w.ex.eval(lookup)
+	if err != nil {
+		return 0, fmt.Errorf("could not evaluate integer expression %q: %w", w.key, err)
+	}
+	return val, nil
+}
+
+// strSource is a compiled string source.
+type strSource interface {
+	str(lookup Lookup) (string, error)
+}
+
+type strLiteral string
+
+func (s strLiteral) str(_ Lookup) (string, error) {
+	return string(s), nil
+}
+
+type strPath struct {
+	*path
+}
+
+func (sp strPath) str(lookup Lookup) (string, error) {
+	scope, err := sp.resolve(lookup, "string")
+	if err != nil {
+		return "", err
+	}
+	return scope.GetStr(sp.key)
+}
+
+func compileStr(key string) strSource {
+	if isStrLiteral(key) {
+		return strLiteral(key[1:])
+	}
+	return strPath{newPath(key)}
+}
+
+// arrSource is a compiled string-array source.
+type arrSource interface {
+	arr(lookup Lookup) ([]string, error)
+}
+
+// arrLiteral keeps the source text of each entry for error messages.
+type arrLiteral struct {
+	texts   []string
+	entries []strSource
+}
+
+func (al *arrLiteral) arr(lookup Lookup) ([]string, error) {
+	ret := make([]string, len(al.entries))
+	for idx, entry := range al.entries {
+		val, err := entry.str(lookup)
+		if err != nil {
+			return nil, fmt.Errorf("error constructing array entry %q: %w", al.texts[idx], err)
+		}
+		ret[idx] = val
+	}
+	return ret, nil
+}
+
+type arrPath struct {
+	*path
+}
+
+func (ap arrPath) arr(lookup Lookup) ([]string, error) {
+	scope, err := ap.resolve(lookup, "string array")
+	if err != nil {
+		return nil, err
+	}
+	return scope.GetStrArr(ap.key)
+}
+
+func compileStrArr(key string) arrSource {
+	if l, ok := strings.CutSuffix(key, "]"); ok {
+		if literal, ok := strings.CutPrefix(l, "["); ok {
+			al := &arrLiteral{texts: strings.Split(literal, ",")}
+			for _, entry := range al.texts {
+				al.entries = append(al.entries, compileStr(strings.Trim(entry, " ")))
+			}
+			return al
+		}
+	}
+	return arrPath{newPath(key)}
+}
+
+// intProgram is a compiled integer comparison.
+type intProgram struct {
+	op       lpb.Compare_Op
+	one, two expr
+}
+
+func (ip *intProgram) Eval(lookup Lookup) (bool, error) {
+	one, err := ip.one.eval(lookup)
+	if err != nil {
+		return false, err
+	}
+	two, err := ip.two.eval(lookup)
+	if err != nil {
+		return false, err
+	}
+	return compareInts(ip.op, one, two)
+}
+
+// strEqProgram is a compiled string equality.
+type strEqProgram struct {
+	one, two strSource
+}
+
+func (sp *strEqProgram) Eval(lookup Lookup) (bool, error) {
+	one, err := sp.one.str(lookup)
+	if err != nil {
+		return false, err
+	}
+	two, err := sp.two.str(lookup)
+	if err != nil {
+		return false, err
+	}
+	return one == two, nil
+}
+
+// strInProgram is a compiled test for membership in a string array.
+type strInProgram struct {
+	one strSource
+	two arrSource
+}
+
+func (sp *strInProgram) Eval(lookup Lookup) (bool, error) {
+	one, err := sp.one.str(lookup)
+	if err != nil {
+		return false, err
+	}
+	arr, err := sp.two.arr(lookup)
+	if err != nil {
+		return false, err
+	}
+	for _, val := range arr {
+		if one == val {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func compileComparison(comp *lpb.Compare) (Program, error) {
+	switch op := comp.GetOperation(); op {
+	case lpb.Compare_CMP_STREQ:
+		return &strEqProgram{
+			one: compileStr(comp.GetKeyOne()),
+			two: compileStr(comp.GetKeyTwo()),
+		}, nil
+	case lpb.Compare_CMP_STRIN:
+		return &strInProgram{
+			one: compileStr(comp.GetKeyOne()),
+			two: compileStrArr(comp.GetKeyTwo()),
+		}, nil
+	case lpb.Compare_CMP_GT, lpb.Compare_CMP_LT, lpb.Compare_CMP_EQ, lpb.Compare_CMP_GTE, lpb.Compare_CMP_LTE, lpb.Compare_CMP_NEQ:
+		one, err := compileInt(comp.GetKeyOne())
+		if err != nil {
+			return nil, err
+		}
+		two, err := compileInt(comp.GetKeyTwo())
+		if err != nil {
+			return nil, err
+		}
+		return &intProgram{op: op, one: one, two: two}, nil
+	default:
+		return nil, fmt.Errorf("cannot compile unknown operator %v", op)
+	}
+}
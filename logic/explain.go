@@ -0,0 +1,204 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+
+	lpb "github.com/kingofmen/cyoa-exploratory/logic/proto"
+)
+
+// Trace records the evaluation of one node of a predicate, so
+// authors can see why a predicate came out the way it did.
+type Trace struct {
+	// Text is the node in the syntax of Format; for combinations,
+	// only the operator name.
+	Text string
+	// One and Two are the resolved operands of a comparison.
+	One, Two string
+	Result   bool
+	Err      error
+	// Skipped is true if the node was not evaluated because an
+	// earlier sibling already decided its combination.
+	Skipped  bool
+	Children []*Trace
+	// op is the operator of a combination.
+	op lpb.Combine_Op
+}
+
+// Explain evaluates the predicate like Eval, and returns a trace
+// mirroring its structure.
+func Explain(pred *lpb.Predicate, lookup Lookup) *Trace {
+	if comb := pred.GetComb(); comb != nil {
+		return explainCombination(comb, lookup)
+	}
+	if comp := pred.GetComp(); comp != nil {
+		return explainComparison(pred, comp, lookup)
+	}
+	return &Trace{Text: "true", Result: true}
+}
+
+// skipped returns an unevaluated trace of the predicate.
+func skipped(pred *lpb.Predicate) *Trace {
+	trace := &Trace{Text: Format(pred), Skipped: true}
+	if comb := pred.GetComb(); comb != nil {
+		trace.Text, trace.op = combinatorName(comb.GetOperation()), comb.GetOperation()
+		for _, sub := range comb.GetOperands() {
+			trace.Children = append(trace.Children, skipped(sub))
+		}
+	}
+	return trace
+}
+
+func explainCombination(comb *lpb.Combine, lookup Lookup) *Trace {
+	op := comb.GetOperation()
+	trace := &Trace{Text: combinatorName(op), op: op}
+	// The result if no operand decides the combination early;
+	// unknown operators are false without evaluating anything.
+	_, known := lpb.Combine_Op_name[int32(op)]
+	trace.Result = known && op != lpb.Combine_IF_ANY
+	decided := !known
+	for _, sub := range comb.GetOperands() {
+		if decided {
+			trace.Children = append(trace.Children, skipped(sub))
+			continue
+		}
+		child := Explain(sub, lookup)
+		trace.Children = append(trace.Children, child)
+		if child.Err != nil {
+			trace.Result, trace.Err = false, child.Err
+			decided = true
+			continue
+		}
+		switch {
+		case op == lpb.Combine_IF_ALL && !child.Result:
+			trace.Result, decided = false, true
+		case op == lpb.Combine_IF_ANY && child.Result:
+			trace.Result, decided = true, true
+		case op == lpb.Combine_IF_NONE && child.Result:
+			trace.Result, decided = false, true
+		}
+	}
+	return trace
+}
+
+func explainComparison(pred *lpb.Predicate, comp *lpb.Compare, lookup Lookup) *Trace {
+	trace := &Trace{Text: Format(pred)}
+	switch op := comp.GetOperation(); op {
+	case lpb.Compare_CMP_STREQ, lpb.Compare_CMP_STRIN:
+		if one, err := getStr(comp.GetKeyOne(), lookup); err == nil {
+			trace.One = fmt.Sprintf("%q", one)
+		}
+		if op == lpb.Compare_CMP_STRIN {
+			if two, err := getStrArr(comp.GetKeyTwo(), lookup); err == nil {
+				trace.Two = fmt.Sprintf("%q", two)
+			}
+		} else if two, err := getStr(comp.GetKeyTwo(), lookup); err == nil {
+			trace.Two = fmt.Sprintf("%q", two)
+		}
+	default:
+		// Integer operands are evaluated only once, since they may
+		// roll dice.
+		one, err := getInt(comp.GetKeyOne(), lookup)
+		if err == nil {
+			trace.One = fmt.Sprintf("%d", one)
+		}
+		two, terr := getInt(comp.GetKeyTwo(), lookup)
+		if terr == nil {
+			trace.Two = fmt.Sprintf("%d", two)
+		}
+		switch {
+		case err != nil:
+			trace.Err = err
+		case terr != nil:
+			trace.Err = terr
+		default:
+			trace.Result, trace.Err = compareInts(op, one, two)
+		}
+		return trace
+	}
+	trace.Result, trace.Err = evalComparison(comp, lookup)
+	return trace
+}
+
+// Failures returns the comparisons which made the traced predicate
+// false, in the syntax of Format, for telling players what they
+// lack. Alternatives which all failed are joined with "or", and
+// comparisons skipped by short-circuiting are not listed.
+func (t *Trace) Failures() []string {
+	return t.failures(true)
+}
+
+// failures returns the reasons the node did not come out as want.
+func (t *Trace) failures(want bool) []string {
+	if t == nil || t.Skipped || (t.Err == nil && t.Result == want) {
+		return nil
+	}
+	if len(t.Children) == 0 || !want {
+		if want {
+			return []string{t.Text}
+		}
+		return []string{"not " + t.format()}
+	}
+	var ret []string
+	switch t.op {
+	case lpb.Combine_IF_ALL:
+		for _, child := range t.Children {
+			ret = append(ret, child.failures(true)...)
+		}
+	case lpb.Combine_IF_ANY:
+		var alts []string
+		for _, child := range t.Children {
+			if fails := child.failures(true); len(fails) > 0 {
+				alts = append(alts, strings.Join(fails, " and "))
+			}
+		}
+		ret = append(ret, strings.Join(alts, " or "))
+	case lpb.Combine_IF_NONE:
+		for _, child := range t.Children {
+			ret = append(ret, child.failures(false)...)
+		}
+	}
+	return ret
+}
+
+// format returns the traced predicate in the syntax of Format.
+func (t *Trace) format() string {
+	if len(t.Children) == 0 {
+		return t.Text
+	}
+	subs := make([]string, len(t.Children))
+	for idx, child := range t.Children {
+		subs[idx] = child.format()
+	}
+	return fmt.Sprintf("%s(%s)", t.Text, strings.Join(subs, ", "))
+}
+
+// String renders the trace compactly, one node per line.
+func (t *Trace) String() string {
+	var buf strings.Builder
+	t.render(&buf, 0)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func (t *Trace) render(buf *strings.Builder, depth int) {
+	if t == nil {
+		return
+	}
+	buf.WriteString(strings.Repeat("  ", depth))
+	buf.WriteString(t.Text)
+	if len(t.One) > 0 || len(t.Two) > 0 {
+		fmt.Fprintf(buf, " [%s, %s]", t.One, t.Two)
+	}
+	switch {
+	case t.Skipped:
+		buf.WriteString(" (skipped)")
+	case t.Err != nil && len(t.Children) == 0:
+		fmt.Fprintf(buf, " => error: %v", t.Err)
+	default:
+		fmt.Fprintf(buf, " => %v", t.Result)
+	}
+	buf.WriteString("\n")
+	for _, child := range t.Children {
+		child.render(buf, depth+1)
+	}
+}
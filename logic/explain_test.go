@@ -0,0 +1,131 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	lookup := NewTestLookup().
+		WithInt("gold", 7).
+		WithStr("class", "rogue").
+		WithStrArr("inventory", []string{"rope"})
+
+	cases := []struct {
+		desc string
+		text string
+		want string
+	}{
+		{
+			desc: "Unconditional",
+			text: "true",
+			want: "true => true",
+		},
+		{
+			desc: "Comparison",
+			text: "gold + 3 >= 10",
+			want: "gold + 3 >= 10 [10, 10] => true",
+		},
+		{
+			desc: "Short circuit",
+			text: "all(gold >= 10, any(class == 'fighter', 'sword' in inventory))",
+			want: strings.Join([]string{
+				"all => false",
+				"  gold >= 10 [7, 10] => false",
+				"  any (skipped)",
+				"    class == 'fighter' (skipped)",
+				"    'sword' in inventory (skipped)",
+			}, "\n"),
+		},
+		{
+			desc: "String operands",
+			text: "none(class == 'fighter', 'rope' in inventory)",
+			want: strings.Join([]string{
+				"none => false",
+				`  class == 'fighter' ["rogue", "fighter"] => false`,
+				`  'rope' in inventory ["rope", ["rope"]] => true`,
+			}, "\n"),
+		},
+		{
+			desc: "Error",
+			text: "any(silver > 1, gold > 1)",
+			want: strings.Join([]string{
+				"any => false",
+				`  silver > 1 [, 1] => error: unknown key "silver"`,
+				"  gold > 1 (skipped)",
+			}, "\n"),
+		},
+	}
+
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			pred, err := Parse(cc.text)
+			if err != nil {
+				t.Fatalf("%s: Parse(%q) => %v, want nil", cc.desc, cc.text, err)
+			}
+			trace := Explain(pred, lookup)
+			if got := trace.String(); got != cc.want {
+				t.Errorf("%s: Explain(%q) =>\n%s\nwant\n%s", cc.desc, cc.text, got, cc.want)
+			}
+			want, err := Eval(pred, lookup)
+			if trace.Result != want || (trace.Err == nil) != (err == nil) {
+				t.Errorf("%s: Explain(%q) => %v, %v; Eval() => %v, %v", cc.desc, cc.text, trace.Result, trace.Err, want, err)
+			}
+		})
+	}
+}
+
+func TestFailures(t *testing.T) {
+	lookup := NewTestLookup().
+		WithInt("gold", 7).
+		WithStr("class", "rogue").
+		WithStrArr("inventory", []string{"rope"})
+
+	cases := []struct {
+		desc string
+		text string
+		want []string
+	}{
+		{
+			desc: "True",
+			text: "gold > 5",
+		},
+		{
+			desc: "Comparison",
+			text: "gold >= 10",
+			want: []string{"gold >= 10"},
+		},
+		{
+			desc: "All",
+			text: "all(gold >= 5, class == 'fighter', 'sword' in inventory)",
+			want: []string{"class == 'fighter'"},
+		},
+		{
+			desc: "Any",
+			text: "any(gold >= 10, all(class == 'fighter', 'sword' in inventory))",
+			want: []string{"gold >= 10 or class == 'fighter'"},
+		},
+		{
+			desc: "None",
+			text: "none(class == 'rogue', all(gold > 1, 'rope' in inventory))",
+			want: []string{"not class == 'rogue'"},
+		},
+		{
+			desc: "None of combination",
+			text: "none(all(gold > 1, 'rope' in inventory))",
+			want: []string{"not all(gold > 1, 'rope' in inventory)"},
+		},
+	}
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			pred, err := Parse(cc.text)
+			if err != nil {
+				t.Fatalf("%s: Parse(%q) => %v, want nil", cc.desc, cc.text, err)
+			}
+			got := Explain(pred, lookup).Failures()
+			if strings.Join(got, "|") != strings.Join(cc.want, "|") {
+				t.Errorf("%s: Failures(%q) => %q, want %q", cc.desc, cc.text, got, cc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package logic
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Integer keys may be arithmetic expressions over literals and
+// (scoped) lookup keys, for example "gold + silver / 10" or
+// "max(0, 2*ogre.strength - armour)". The supported operators are
+// + - * / % with the usual precedence, unary minus, parentheses,
+// and the functions min, max and abs. Division truncates towards
+// zero. Key names may contain hyphens, so a binary minus that
+// follows a name or number must be separated from it by whitespace.
+//
+// Dice are written NdM, for example "2d6 + dexterity", or as
+// roll(count, sides) when either number is computed; rolling
+// requires a Lookup which implements Roller.
+
+// exprChars are the characters which mark a key as an expression
+// rather than a plain lookup key.
+const exprChars = "+*/%(), \t"
+
+// isExpression returns true if the key should be parsed as an
+// arithmetic expression.
+func isExpression(key string) bool {
+	if _, _, ok := parseDice(key); ok {
+		return true
+	}
+	return strings.ContainsAny(key, exprChars) || strings.HasPrefix(key, "-")
+}
+
+// kMaxDice is the largest number of dice one roll may throw.
+const kMaxDice = 1000
+
+// parseDice returns the count and sides of dice notation NdM.
+func parseDice(word string) (int64, int64, bool) {
+	cstr, sstr, ok := strings.Cut(word, "d")
+	if !ok || len(cstr) == 0 || len(sstr) == 0 || strings.Trim(cstr+sstr, "0123456789") != "" {
+		return 0, 0, false
+	}
+	count, cerr := strconv.ParseInt(cstr, 10, 64)
+	sides, serr := strconv.ParseInt(sstr, 10, 64)
+	if cerr != nil || serr != nil {
+		return 0, 0, false
+	}
+	return count, sides, true
+}
+
+// rollDice returns the sum of count dice with the given number of sides.
+func rollDice(count, sides int64, lookup Lookup) (int64, error) {
+	roller, ok := lookup.(Roller)
+	if !ok {
+		return 0, fmt.Errorf("cannot roll %dd%d without a source of randomness", count, sides)
+	}
+	if count < 1 || count > kMaxDice || sides < 1 {
+		return 0, fmt.Errorf("cannot roll %dd%d", count, sides)
+	}
+	var total int64
+	for range count {
+		val, err := roller.Roll(sides)
+		if err != nil {
+			return 0, err
+		}
+		if total, err = Arithmetic('+', total, val); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// expr is a parsed integer expression.
+type expr interface {
+	eval(lookup Lookup) (int64, error)
+}
+
+// litExpr is an integer literal.
+type litExpr int64
+
+func (l litExpr) eval(_ Lookup) (int64, error) {
+	return int64(l), nil
+}
+
+// keyExpr is a value from the lookup table.
+type keyExpr string
+
+func (k keyExpr) eval(lookup Lookup) (int64, error) {
+	return lookupInt(string(k), lookup)
+}
+
+// negExpr is a unary minus.
+type negExpr struct {
+	arg expr
+}
+
+func (n *negExpr) eval(lookup Lookup) (int64, error) {
+	val, err := n.arg.eval(lookup)
+	if err != nil {
+		return 0, err
+	}
+	if val == math.MinInt64 {
+		return 0, fmt.Errorf("integer overflow in -(%d)", val)
+	}
+	return -val, nil
+}
+
+// binExpr is a binary arithmetic operation.
+type binExpr struct {
+	op       byte
+	lhs, rhs expr
+}
+
+func (b *binExpr) eval(lookup Lookup) (int64, error) {
+	one, err := b.lhs.eval(lookup)
+	if err != nil {
+		return 0, err
+	}
+	two, err := b.rhs.eval(lookup)
+	if err != nil {
+		return 0, err
+	}
+	return Arithmetic(b.op, one, two)
+}
+
+// Arithmetic applies the operator, checking for overflow and
+// division by zero.
+func Arithmetic(op byte, one, two int64) (int64, error) {
+	switch op {
+	case '+':
+		if (two > 0 && one > math.MaxInt64-two) || (two < 0 && one < math.MinInt64-two) {
+			return 0, fmt.Errorf("integer overflow in %d + %d", one, two)
+		}
+		return one + two, nil
+	case '-':
+		if (two < 0 && one > math.MaxInt64+two) || (two > 0 && one < math.MinInt64+two) {
+			return 0, fmt.Errorf("integer overflow in %d - %d", one, two)
+		}
+		return one - two, nil
+	case '*':
+		if one == 0 || two == 0 {
+			return 0, nil
+		}
+		res := one * two
+		if res/two != one || (one == -1 && two == math.MinInt64) || (two == -1 && one == math.MinInt64) {
+			return 0, fmt.Errorf("integer overflow in %d * %d", one, two)
+		}
+		return res, nil
+	case '/':
+		if two == 0 {
+			return 0, fmt.Errorf("division by zero in %d / %d", one, two)
+		}
+		if one == math.MinInt64 && two == -1 {
+			return 0, fmt.Errorf("integer overflow in %d / %d", one, two)
+		}
+		return one / two, nil
+	case '%':
+		if two == 0 {
+			return 0, fmt.Errorf("division by zero in %d %% %d", one, two)
+		}
+		return one % two, nil
+	}
+	return 0, fmt.Errorf("unknown arithmetic operator %q", op)
+}
+
+// callExpr is a function call.
+type callExpr struct {
+	name string
+	args []expr
+}
+
+func (c *callExpr) eval(lookup Lookup) (int64, error) {
+	vals := make([]int64, len(c.args))
+	for idx, arg := range c.args {
+		val, err := arg.eval(lookup)
+		if err != nil {
+			return 0, err
+		}
+		vals[idx] = val
+	}
+	switch c.name {
+	case "min":
+		ret := vals[0]
+		for _, val := range vals[1:] {
+			ret = min(ret, val)
+		}
+		return ret, nil
+	case "max":
+		ret := vals[0]
+		for _, val := range vals[1:] {
+			ret = max(ret, val)
+		}
+		return ret, nil
+	case "abs":
+		if vals[0] == math.MinInt64 {
+			return 0, fmt.Errorf("integer overflow in abs(%d)", vals[0])
+		}
+		if vals[0] < 0 {
+			return -vals[0], nil
+		}
+		return vals[0], nil
+	case "roll":
+		return rollDice(vals[0], vals[1], lookup)
+	}
+	return 0, fmt.Errorf("unknown function %q", c.name)
+}
+
+// arity holds the minimum and maximum argument counts of the
+// known functions; a negative maximum means no limit.
+var arity = map[string][2]int{
+	"min":  {1, -1},
+	"max":  {1, -1},
+	"abs":  {1, 1},
+	"roll": {2, 2},
+}
+
+// exprParser is a recursive-descent parser for integer expressions.
+type exprParser struct {
+	text string
+	pos  int
+}
+
+// parseExpr parses the text into an expression tree.
+func parseExpr(text string) (expr, error) {
+	return (&exprParser{text: text}).parse()
+}
+
+// parse parses the whole text; on error, pos is left near the
+// offending character.
+func (p *exprParser) parse() (expr, error) {
+	ex, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.text) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.text[p.pos], p.pos)
+	}
+	return ex, nil
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.text) && (p.text[p.pos] == ' ' || p.text[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space character, or 0 at the end of input.
+func (p *exprParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.text) {
+		return 0
+	}
+	return p.text[p.pos]
+}
+
+// sum parses terms separated by + and -.
+func (p *exprParser) sum() (expr, error) {
+	lhs, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		rhs, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &binExpr{op: op, lhs: lhs, rhs: rhs}
+	}
+	return lhs, nil
+}
+
+// product parses factors separated by *, / and %.
+func (p *exprParser) product() (expr, error) {
+	lhs, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/' || op == '%'; op = p.peek() {
+		p.pos++
+		rhs, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &binExpr{op: op, lhs: lhs, rhs: rhs}
+	}
+	return lhs, nil
+}
+
+// unary parses an optionally negated operand.
+func (p *exprParser) unary() (expr, error) {
+	if p.peek() == '-' {
+		p.pos++
+		arg, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if lit, ok := arg.(litExpr); ok && lit > 0 {
+			return litExpr(-lit), nil
+		}
+		return &negExpr{arg: arg}, nil
+	}
+	return p.operand()
+}
+
+// operand parses a literal, key, function call, or parenthesized expression.
+func (p *exprParser) operand() (expr, error) {
+	switch c := p.peek(); {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of expression %q", p.text)
+	case c == '(':
+		p.pos++
+		ex, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ')' at position %d", p.pos)
+		}
+		p.pos++
+		return ex, nil
+	case !isWordStart(c):
+		return nil, fmt.Errorf("unexpected %q at position %d", c, p.pos)
+	}
+
+	start := p.pos
+	for p.pos < len(p.text) && isWordChar(p.text[p.pos]) {
+		p.pos++
+	}
+	word := p.text[start:p.pos]
+	if val, err := strconv.ParseInt(word, 10, 64); err == nil {
+		return litExpr(val), nil
+	} else if isDigit(word[0]) && strings.Trim(word, "0123456789") == "" {
+		return nil, fmt.Errorf("bad integer literal %q: %w", word, err)
+	}
+	if count, sides, ok := parseDice(word); ok {
+		return &callExpr{name: "roll", args: []expr{litExpr(count), litExpr(sides)}}, nil
+	}
+	if p.peek() != '(' {
+		return keyExpr(word), nil
+	}
+
+	limits, ok := arity[word]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", word, start)
+	}
+	p.pos++
+	call := &callExpr{name: word}
+	for p.peek() != ')' {
+		if len(call.args) > 0 {
+			if p.peek() != ',' {
+				return nil, fmt.Errorf("expected ',' or ')' at position %d", p.pos)
+			}
+			p.pos++
+		}
+		arg, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+	}
+	p.pos++
+	if n := len(call.args); n < limits[0] || (limits[1] >= 0 && n > limits[1]) {
+		return nil, fmt.Errorf("wrong number of arguments (%d) to %s", n, word)
+	}
+	return call, nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// isWordStart returns true if c can begin a key or literal.
+func isWordStart(c byte) bool {
+	return isDigit(c) || c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// isWordChar returns true if c can continue a key or literal.
+func isWordChar(c byte) bool {
+	return isWordStart(c) || c == '.' || c == '-'
+}
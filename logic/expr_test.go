@@ -0,0 +1,210 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	lpb "github.com/kingofmen/cyoa-exploratory/logic/proto"
+)
+
+func TestExpressions(t *testing.T) {
+	lookup := NewTestLookup().
+		WithInt("gold", 45).
+		WithInt("silver", 57).
+		WithInt("strength", 7).
+		WithInt("has-sword", 1)
+	lookup.SetScope("ogre", NewTestLookup().WithInt("strength", 3))
+
+	cases := []struct {
+		desc string
+		key  string
+		want int64
+	}{
+		{desc: "Literal", key: "12", want: 12},
+		{desc: "Negative literal", key: "-12", want: -12},
+		{desc: "Plain key", key: "gold", want: 45},
+		{desc: "Hyphenated key", key: "has-sword", want: 1},
+		{desc: "Scoped key", key: "ogre.strength", want: 3},
+		{desc: "Sum", key: "gold + silver/10", want: 50},
+		{desc: "Difference", key: "gold - 5", want: 40},
+		{desc: "Precedence", key: "1 + 2 * 3", want: 7},
+		{desc: "Parentheses", key: "(1 + 2) * 3", want: 9},
+		{desc: "Left associative", key: "10 - 3 - 2", want: 5},
+		{desc: "Modulus", key: "gold % 10", want: 5},
+		{desc: "Truncating division", key: "-7 / 2", want: -3},
+		{desc: "Unary minus", key: "-gold", want: -45},
+		{desc: "Double negation", key: "--gold", want: 45},
+		{desc: "Scoped operand", key: "2*ogre.strength", want: 6},
+		{desc: "Min", key: "min(gold, silver, 100)", want: 45},
+		{desc: "Max", key: "max(0, strength - 10)", want: 0},
+		{desc: "Abs", key: "abs(strength - 10)", want: 3},
+		{desc: "Nested calls", key: "max(abs(-4), min(gold, 2))", want: 4},
+	}
+
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			got, err := getInt(cc.key, lookup)
+			if err != nil {
+				t.Fatalf("%s: getInt(%q) => %v, want nil", cc.desc, cc.key, err)
+			}
+			if got != cc.want {
+				t.Errorf("%s: getInt(%q) => %d, want %d", cc.desc, cc.key, got, cc.want)
+			}
+		})
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	lookup := NewTestLookup().
+		WithInt("zero", 0).
+		WithInt("big", 9223372036854775807)
+
+	cases := []struct {
+		desc string
+		key  string
+		want string
+	}{
+		{desc: "Division by zero", key: "1 / zero", want: "division by zero"},
+		{desc: "Modulus by zero", key: "1 % (zero)", want: "division by zero"},
+		{desc: "Addition overflow", key: "big + 1", want: "overflow"},
+		{desc: "Subtraction overflow", key: "-big - 2", want: "overflow"},
+		{desc: "Multiplication overflow", key: "big * 2", want: "overflow"},
+		{desc: "Literal overflow", key: "big + 9223372036854775808", want: "bad integer literal"},
+		{desc: "Unknown key", key: "zero + missing", want: `unknown key "missing"`},
+		{desc: "Unknown function", key: "sqrt(4)", want: `unknown function "sqrt"`},
+		{desc: "Wrong arity", key: "abs(1, 2)", want: "wrong number of arguments"},
+		{desc: "Unbalanced parentheses", key: "(1 + 2", want: "missing ')'"},
+		{desc: "Dangling operator", key: "1 +", want: "unexpected end"},
+		{desc: "Bad character", key: "1 + $", want: "unexpected '$'"},
+	}
+
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			_, err := getInt(cc.key, lookup)
+			if got := fmt.Sprintf("%v", err); !strings.Contains(got, cc.want) {
+				t.Errorf("%s: getInt(%q) => %v, want %q", cc.desc, cc.key, err, cc.want)
+			}
+		})
+	}
+}
+
+func TestExpressionComparison(t *testing.T) {
+	lookup := NewTestLookup().
+		WithInt("strength", 7)
+	lookup.SetScope("ogre", NewTestLookup().WithInt("strength", 3))
+	pred := &lpb.Predicate{
+		Test: &lpb.Predicate_Comp{
+			Comp: &lpb.Compare{
+				KeyOne:    proto.String("strength"),
+				KeyTwo:    proto.String("2*ogre.strength"),
+				Operation: lpb.Compare_CMP_GT.Enum(),
+			},
+		},
+	}
+	got, err := Eval(pred, lookup)
+	if err != nil {
+		t.Fatalf("Eval() => %v, want nil", err)
+	}
+	if !got {
+		t.Errorf("Eval() => %v, want true", got)
+	}
+}
+
+// seqRoller returns its values in order, modulo the number of sides.
+type seqRoller struct {
+	vals []int64
+}
+
+func (s *seqRoller) Roll(sides int64) (int64, error) {
+	if len(s.vals) == 0 {
+		return 0, fmt.Errorf("out of rolls")
+	}
+	val := s.vals[0]
+	s.vals = s.vals[1:]
+	return (val-1)%sides + 1, nil
+}
+
+func TestDice(t *testing.T) {
+	cases := []struct {
+		desc  string
+		key   string
+		rolls []int64
+		want  int64
+	}{
+		{desc: "Single die", key: "1d20", rolls: []int64{17}, want: 17},
+		{desc: "Sum of dice", key: "3d6", rolls: []int64{1, 4, 6}, want: 11},
+		{desc: "Dice plus key", key: "2d6 + dexterity", rolls: []int64{3, 5}, want: 12},
+		{desc: "Computed count", key: "roll(dexterity - 2, 4)", rolls: []int64{1, 2}, want: 3},
+		{desc: "Negated dice", key: "-1d4", rolls: []int64{3}, want: -3},
+	}
+
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			lookup := NewTestLookup().
+				WithInt("dexterity", 4).
+				WithRoller(&seqRoller{vals: cc.rolls})
+			got, err := getInt(cc.key, lookup)
+			if err != nil {
+				t.Fatalf("%s: getInt(%q) => %v, want nil", cc.desc, cc.key, err)
+			}
+			if got != cc.want {
+				t.Errorf("%s: getInt(%q) => %d, want %d", cc.desc, cc.key, got, cc.want)
+			}
+		})
+	}
+}
+
+func TestDiceErrors(t *testing.T) {
+	cases := []struct {
+		desc   string
+		key    string
+		roller Roller
+		want   string
+	}{
+		{desc: "No roller", key: "1d6", want: "no roller set"},
+		{desc: "Zero dice", key: "roll(0, 6)", roller: NewRandRoller(1), want: "cannot roll 0d6"},
+		{desc: "Too many dice", key: "5000d6", roller: NewRandRoller(1), want: "cannot roll 5000d6"},
+		{desc: "No sides", key: "1d0", roller: NewRandRoller(1), want: "cannot roll 1d0"},
+		{desc: "Wrong arity", key: "roll(6)", roller: NewRandRoller(1), want: "wrong number of arguments"},
+	}
+
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			lookup := NewTestLookup().WithRoller(cc.roller)
+			_, err := getInt(cc.key, lookup)
+			if got := fmt.Sprintf("%v", err); !strings.Contains(got, cc.want) {
+				t.Errorf("%s: getInt(%q) => %v, want %q", cc.desc, cc.key, err, cc.want)
+			}
+		})
+	}
+}
+
+func TestRandRollerReplay(t *testing.T) {
+	pred, err := Parse("all(1d100 <= 60, 2d6 + 3 > 5)")
+	if err != nil {
+		t.Fatalf("Parse() => %v, want nil", err)
+	}
+	for seed := int64(0); seed < 20; seed++ {
+		one, err := Eval(pred, NewTestLookup().WithRoller(NewRandRoller(seed)))
+		if err != nil {
+			t.Fatalf("Eval(seed %d) => %v, want nil", seed, err)
+		}
+		two, err := Eval(pred, NewTestLookup().WithRoller(NewRandRoller(seed)))
+		if err != nil {
+			t.Fatalf("Eval(seed %d) => %v, want nil", seed, err)
+		}
+		if one != two {
+			t.Errorf("Eval(seed %d) => %v, then %v; want the same", seed, one, two)
+		}
+	}
+	roller := NewRandRoller(7)
+	for range 1000 {
+		val, err := roller.Roll(6)
+		if err != nil || val < 1 || val > 6 {
+			t.Fatalf("Roll(6) => %d, %v; want 1-6", val, err)
+		}
+	}
+}
@@ -103,11 +103,36 @@ func evalCombination(comb *lpb.Combine, lookup Lookup) (bool, error) {
 }
 
 // getInt returns an integer either because key is a literal,
-// or from the lookup table.
+// by evaluating it as an arithmetic expression, or from the
+// lookup table.
 func getInt(key string, lookup Lookup) (int64, error) {
 	if val, err := strconv.Atoi(key); err == nil {
 		return int64(val), nil
 	}
+	if isExpression(key) {
+		ex, err := parseExpr(key)
+		if err != nil {
+			return 0, fmt.Errorf("could not parse integer expression %q: %w", key, err)
+		}
+		val, err := ex.eval(lookup)
+		if err != nil {
+			return 0, fmt.Errorf("could not evaluate integer expression %q: %w", key, err)
+		}
+		return val, nil
+	}
+	return lookupInt(key, lookup)
+}
+
+// EvalInt returns the value of an integer key: a literal, a
+// (scoped) lookup key, or an arithmetic expression which may roll
+// dice.
+func EvalInt(key string, lookup Lookup) (int64, error) {
+	return getInt(key, lookup)
+}
+
+// lookupInt returns the value of a (possibly scoped) key from
+// the lookup table.
+func lookupInt(key string, lookup Lookup) (int64, error) {
 	scope, skey, has := strings.Cut(key, kScopeSeparator)
 	if has {
 		slookup := lookup.GetScope(scope)
@@ -137,6 +162,12 @@ func getStr(key string, lookup Lookup) (string, error) {
 	return lookup.GetStr(key)
 }
 
+// EvalStr returns the value of a string key: a literal or a
+// (scoped) lookup key.
+func EvalStr(key string, lookup Lookup) (string, error) {
+	return getStr(key, lookup)
+}
+
 // getStrArr returns a string array, either from the lookup table
 // or from parsing an array literal.
 func getStrArr(key string, lookup Lookup) ([]string, error) {
@@ -174,7 +205,12 @@ func evalIntComparison(comp *lpb.Compare, lookup Lookup) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	switch comp.GetOperation() {
+	return compareInts(comp.GetOperation(), one, two)
+}
+
+// compareInts applies the integer comparison operator.
+func compareInts(op lpb.Compare_Op, one, two int64) (bool, error) {
+	switch op {
 	case lpb.Compare_CMP_GT:
 		return one > two, nil
 	case lpb.Compare_CMP_LT:
@@ -188,7 +224,7 @@ func evalIntComparison(comp *lpb.Compare, lookup Lookup) (bool, error) {
 	case lpb.Compare_CMP_NEQ:
 		return one != two, nil
 	}
-	return false, fmt.Errorf("cannot evaluate unknown (int) operator %d %v %d", one, comp.GetOperation(), two)
+	return false, fmt.Errorf("cannot evaluate unknown (int) operator %d %v %d", one, op, two)
 }
 
 // evalStrComparison returns the truth-value of the string predicate.
@@ -382,6 +382,7 @@ func TestBasics(t *testing.T) {
 			if got != cc.want {
 				t.Errorf("%s: Eval() => %v, want %v", cc.desc, got, cc.want)
 			}
+			checkCompiled(t, cc.desc, cc.pred, cc.lookup, cc.want)
 		})
 	}
 }
@@ -655,6 +656,7 @@ func TestCombinations(t *testing.T) {
 			if got != cc.want {
 				t.Errorf("%s: Eval() => %v, want %v", cc.desc, got, cc.want)
 			}
+			checkCompiled(t, cc.desc, cc.pred, cc.lookup, cc.want)
 		})
 	}
 }
@@ -767,6 +769,185 @@ func TestScopes(t *testing.T) {
 			if got != cc.want {
 				t.Errorf("%s: Eval() => %v, want %v", cc.desc, got, cc.want)
 			}
+			checkCompiled(t, cc.desc, cc.pred, cc.base, cc.want)
 		})
 	}
 }
+
+// checkCompiled verifies that the compiled predicate agrees with Eval.
+func checkCompiled(t *testing.T, desc string, pred *lpb.Predicate, lookup Lookup, want bool) {
+	t.Helper()
+	prog, err := Compile(pred)
+	if err != nil {
+		t.Fatalf("%s: Compile() => %v, want nil", desc, err)
+	}
+	got, err := prog.Eval(lookup)
+	if err != nil {
+		t.Errorf("%s: Program.Eval() => %v, want nil", desc, err)
+	}
+	if got != want {
+		t.Errorf("%s: Program.Eval() => %v, want %v", desc, got, want)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	lookup := NewTestLookup().
+		WithInt("gold", 7).
+		WithInt("silver", 25).
+		WithStr("class", "rogue").
+		WithStrArr("inventory", []string{"rope", "lockpicks"})
+	lookup.SetScope("ogre", NewTestLookup().WithInt("strength", 12))
+
+	cases := []struct {
+		desc string
+		text string
+	}{
+		{
+			desc: "Unconditional",
+			text: "true",
+		},
+		{
+			desc: "Expression",
+			text: "gold + silver/10 >= 9",
+		},
+		{
+			desc: "Scoped key in expression",
+			text: "max(gold, ogre.strength) - 5 == 7",
+		},
+		{
+			desc: "Mixed combinations",
+			text: "all(gold < 10, any(class == 'fighter', 'rope' in inventory), none(class in ['mage', 'priest']))",
+		},
+		{
+			desc: "Array literal with key",
+			text: "'rogue' in ['mage', class]",
+		},
+		{
+			desc: "Unknown key",
+			text: "copper > 1",
+		},
+		{
+			desc: "Unknown scope",
+			text: "troll.strength > 1",
+		},
+		{
+			desc: "Error after short circuit",
+			text: "any(gold > 1, copper > 1)",
+		},
+		{
+			desc: "Division by zero",
+			text: "gold / (silver - 25) > 1",
+		},
+	}
+
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			pred, err := Parse(cc.text)
+			if err != nil {
+				t.Fatalf("%s: Parse(%q) => %v, want nil", cc.desc, cc.text, err)
+			}
+			want, wantErr := Eval(pred, lookup)
+			prog, err := Compile(pred)
+			if err != nil {
+				t.Fatalf("%s: Compile(%q) => %v, want nil", cc.desc, cc.text, err)
+			}
+			got, err := prog.Eval(lookup)
+			if got != want || (err == nil) != (wantErr == nil) {
+				t.Errorf("%s: Program.Eval(%q) => %v, %v; Eval() => %v, %v", cc.desc, cc.text, got, err, want, wantErr)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	cases := []struct {
+		desc string
+		pred *lpb.Predicate
+	}{
+		{
+			desc: "Bad expression",
+			pred: &lpb.Predicate{
+				Test: &lpb.Predicate_Comp{
+					Comp: &lpb.Compare{
+						KeyOne:    proto.String("gold + * 2"),
+						KeyTwo:    proto.String("1"),
+						Operation: lpb.Compare_CMP_GT.Enum(),
+					},
+				},
+			},
+		},
+		{
+			desc: "Unknown operator",
+			pred: &lpb.Predicate{
+				Test: &lpb.Predicate_Comp{
+					Comp: &lpb.Compare{
+						KeyOne:    proto.String("gold"),
+						KeyTwo:    proto.String("1"),
+						Operation: lpb.Compare_Op(99).Enum(),
+					},
+				},
+			},
+		},
+	}
+
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			if _, err := Compile(cc.pred); err == nil {
+				t.Errorf("%s: Compile() => nil, want error", cc.desc)
+			}
+		})
+	}
+}
+
+// benchPredicate is typical of an action condition: a few
+// comparisons with scoped keys, an expression, and literals.
+const benchPredicate = "all(gold + silver/10 >= 9, ogre.strength < 20, any(class == 'fighter', 'rope' in inventory), class in ['rogue', 'mage', 'priest'])"
+
+func benchSetup(b *testing.B) (*lpb.Predicate, Lookup) {
+	b.Helper()
+	lookup := NewTestLookup().
+		WithInt("gold", 7).
+		WithInt("silver", 25).
+		WithStr("class", "rogue").
+		WithStrArr("inventory", []string{"rope", "lockpicks"})
+	lookup.SetScope("ogre", NewTestLookup().WithInt("strength", 12))
+	pred, err := Parse(benchPredicate)
+	if err != nil {
+		b.Fatalf("Parse(%q) => %v", benchPredicate, err)
+	}
+	return pred, lookup
+}
+
+func BenchmarkEval(b *testing.B) {
+	pred, lookup := benchSetup(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Eval(pred, lookup); err != nil {
+			b.Fatalf("Eval() => %v", err)
+		}
+	}
+}
+
+func BenchmarkCompiled(b *testing.B) {
+	pred, lookup := benchSetup(b)
+	prog, err := Compile(pred)
+	if err != nil {
+		b.Fatalf("Compile() => %v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := prog.Eval(lookup); err != nil {
+			b.Fatalf("Program.Eval() => %v", err)
+		}
+	}
+}
+
+func BenchmarkCompile(b *testing.B) {
+	pred, _ := benchSetup(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Compile(pred); err != nil {
+			b.Fatalf("Compile() => %v", err)
+		}
+	}
+}
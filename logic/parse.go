@@ -0,0 +1,473 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	lpb "github.com/kingofmen/cyoa-exploratory/logic/proto"
+)
+
+// The predicate text syntax is
+//
+//	predicate  := "true" | combinator | comparison
+//	combinator := ("all" | "any" | "none") "(" [predicate {"," predicate}] ")"
+//	comparison := operand operator operand
+//
+// The integer operators are >, <, >=, <=, == and !=, and their
+// operands are integer literals, lookup keys, or arithmetic
+// expressions. String equality is written == when either side is
+// a string literal such as 'fighter', and eq otherwise. The in
+// operator tests whether a string is in an array, which may be a
+// key or a literal such as ['apple', 'banana', fruit]. Inside a
+// string literal, a backslash escapes the following character.
+// For example:
+//
+//	all(gold >= 10, any(class == 'fighter', 'sword' in inventory))
+
+// ParseError describes a syntax error in predicate text.
+type ParseError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (pe *ParseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", pe.Line, pe.Column, pe.Msg)
+}
+
+var (
+	combinators = map[string]lpb.Combine_Op{
+		"all":  lpb.Combine_IF_ALL,
+		"any":  lpb.Combine_IF_ANY,
+		"none": lpb.Combine_IF_NONE,
+	}
+	intOperators = map[string]lpb.Compare_Op{
+		">":  lpb.Compare_CMP_GT,
+		"<":  lpb.Compare_CMP_LT,
+		"==": lpb.Compare_CMP_EQ,
+		">=": lpb.Compare_CMP_GTE,
+		"<=": lpb.Compare_CMP_LTE,
+		"!=": lpb.Compare_CMP_NEQ,
+	}
+)
+
+// operandKind distinguishes the syntactic forms of operands.
+type operandKind int
+
+const (
+	intOperand operandKind = iota
+	keyOperand
+	strOperand
+	arrOperand
+)
+
+// operand is a parsed comparison operand.
+type operand struct {
+	kind operandKind
+	key  string
+	pos  int
+}
+
+// predParser parses predicate text.
+type predParser struct {
+	text string
+	pos  int
+}
+
+// Parse returns the predicate described by the text.
+func Parse(text string) (*lpb.Predicate, error) {
+	p := &predParser{text: text}
+	pred, err := p.predicate()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.text) {
+		return nil, p.errorf(p.pos, "unexpected %q after predicate", p.text[p.pos])
+	}
+	return pred, nil
+}
+
+// errorf returns a ParseError located at the byte offset.
+func (p *predParser) errorf(pos int, format string, args ...any) error {
+	line, col := 1, 1
+	for _, c := range p.text[:pos] {
+		if c == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return &ParseError{Line: line, Column: col, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *predParser) skipSpace() {
+	for p.pos < len(p.text) && strings.IndexByte(" \t\r\n", p.text[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space character, or 0 at the end of input.
+func (p *predParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.text) {
+		return 0
+	}
+	return p.text[p.pos]
+}
+
+// word returns the key-like word at the current position without consuming it.
+func (p *predParser) word() string {
+	p.skipSpace()
+	end := p.pos
+	if end < len(p.text) && isWordStart(p.text[end]) {
+		for end < len(p.text) && isWordChar(p.text[end]) {
+			end++
+		}
+	}
+	return p.text[p.pos:end]
+}
+
+// expect consumes the character c or returns an error.
+func (p *predParser) expect(c byte) error {
+	if got := p.peek(); got != c {
+		if got == 0 {
+			return p.errorf(p.pos, "expected %q, found end of input", c)
+		}
+		return p.errorf(p.pos, "expected %q, found %q", c, got)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *predParser) predicate() (*lpb.Predicate, error) {
+	word := p.word()
+	start := p.pos
+	p.pos += len(word)
+	next := p.peek()
+	if op, ok := combinators[word]; ok && next == '(' {
+		return p.combination(op)
+	}
+	if word == "true" && (next == 0 || next == ',' || next == ')') {
+		return &lpb.Predicate{}, nil
+	}
+	p.pos = start
+	return p.comparison()
+}
+
+func (p *predParser) combination(op lpb.Combine_Op) (*lpb.Predicate, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	comb := &lpb.Combine{
+		Operation: op.Enum(),
+	}
+	for p.peek() != ')' {
+		if len(comb.Operands) > 0 {
+			if err := p.expect(','); err != nil {
+				return nil, err
+			}
+		}
+		if p.peek() == 0 {
+			return nil, p.errorf(p.pos, "unexpected end of input in %s()", combinatorName(op))
+		}
+		sub, err := p.predicate()
+		if err != nil {
+			return nil, err
+		}
+		comb.Operands = append(comb.Operands, sub)
+	}
+	p.pos++
+	return &lpb.Predicate{
+		Test: &lpb.Predicate_Comb{
+			Comb: comb,
+		},
+	}, nil
+}
+
+func (p *predParser) comparison() (*lpb.Predicate, error) {
+	one, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	opPos := p.pos
+	opText := p.operator()
+	if len(opText) == 0 {
+		if p.pos >= len(p.text) {
+			return nil, p.errorf(opPos, "expected comparison operator, found end of input")
+		}
+		return nil, p.errorf(opPos, "expected comparison operator, found %q", p.text[opPos])
+	}
+	two, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	var op lpb.Compare_Op
+	switch {
+	case opText == "in":
+		if one.kind == arrOperand {
+			return nil, p.errorf(one.pos, "left side of 'in' must be a string")
+		}
+		if two.kind != arrOperand && two.kind != keyOperand {
+			return nil, p.errorf(two.pos, "right side of 'in' must be an array or key")
+		}
+		op = lpb.Compare_CMP_STRIN
+	case opText == "eq" || (opText == "==" && (one.kind == strOperand || two.kind == strOperand)):
+		for _, opnd := range []*operand{one, two} {
+			if opnd.kind == arrOperand || opnd.kind == intOperand {
+				return nil, p.errorf(opnd.pos, "string comparison needs a string literal or key")
+			}
+		}
+		op = lpb.Compare_CMP_STREQ
+	default:
+		for _, opnd := range []*operand{one, two} {
+			if opnd.kind == arrOperand || opnd.kind == strOperand {
+				return nil, p.errorf(opnd.pos, "operator %s needs integer operands", opText)
+			}
+		}
+		op = intOperators[opText]
+	}
+
+	return &lpb.Predicate{
+		Test: &lpb.Predicate_Comp{
+			Comp: &lpb.Compare{
+				KeyOne:    proto.String(one.key),
+				KeyTwo:    proto.String(two.key),
+				Operation: op.Enum(),
+			},
+		},
+	}, nil
+}
+
+// operator consumes and returns a comparison operator, or returns
+// the empty string if there is none.
+func (p *predParser) operator() string {
+	for _, op := range []string{">=", "<=", "==", "!=", ">", "<"} {
+		if strings.HasPrefix(p.text[p.pos:], op) {
+			p.pos += len(op)
+			return op
+		}
+	}
+	if word := p.word(); word == "in" || word == "eq" {
+		p.pos += len(word)
+		return word
+	}
+	return ""
+}
+
+func (p *predParser) operand() (*operand, error) {
+	switch p.peek() {
+	case 0:
+		return nil, p.errorf(p.pos, "expected operand, found end of input")
+	case '\'':
+		return p.stringLiteral()
+	case '[':
+		return p.arrayLiteral()
+	}
+	return p.expression()
+}
+
+// stringLiteral parses a quoted string into the "'content" key form.
+func (p *predParser) stringLiteral() (*operand, error) {
+	start := p.pos
+	p.pos++
+	var buf strings.Builder
+	for p.pos < len(p.text) {
+		c := p.text[p.pos]
+		p.pos++
+		switch c {
+		case '\\':
+			if p.pos >= len(p.text) {
+				return nil, p.errorf(start, "unterminated string literal")
+			}
+			buf.WriteByte(p.text[p.pos])
+			p.pos++
+		case '\'':
+			return &operand{kind: strOperand, key: "'" + buf.String(), pos: start}, nil
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return nil, p.errorf(start, "unterminated string literal")
+}
+
+// arrayLiteral parses a bracketed list into the "[a, b]" key form.
+func (p *predParser) arrayLiteral() (*operand, error) {
+	start := p.pos
+	p.pos++
+	entries := []string{}
+	for p.peek() != ']' {
+		if len(entries) > 0 {
+			if err := p.expect(','); err != nil {
+				return nil, err
+			}
+		}
+		entryPos := p.pos
+		switch c := p.peek(); {
+		case c == 0:
+			return nil, p.errorf(start, "unterminated array literal")
+		case c == '\'':
+			entry, err := p.stringLiteral()
+			if err != nil {
+				return nil, err
+			}
+			if strings.ContainsAny(entry.key, ",]") {
+				return nil, p.errorf(entryPos, "array entries cannot contain ',' or ']'")
+			}
+			entries = append(entries, entry.key)
+		default:
+			word := p.word()
+			if len(word) == 0 {
+				return nil, p.errorf(p.pos, "expected string literal or key in array, found %q", c)
+			}
+			p.pos += len(word)
+			entries = append(entries, word)
+		}
+	}
+	p.pos++
+	return &operand{
+		kind: arrOperand,
+		key:  "[" + strings.Join(entries, ", ") + "]",
+		pos:  start,
+	}, nil
+}
+
+// expression consumes text up to the next operator, comma, or
+// unbalanced parenthesis, and checks that it is a key or a valid
+// integer expression.
+func (p *predParser) expression() (*operand, error) {
+	start := p.pos
+	depth := 0
+scan:
+	for p.pos < len(p.text) {
+		c := p.text[p.pos]
+		switch {
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth == 0 {
+				break scan
+			}
+			depth--
+		case c == ',' && depth == 0:
+			break scan
+		case strings.IndexByte("<>=!", c) >= 0:
+			break scan
+		case isWordStart(c):
+			word := p.word()
+			if word == "in" || word == "eq" {
+				break scan
+			}
+			p.pos += len(word)
+			continue
+		}
+		p.pos++
+	}
+	raw := strings.TrimRight(p.text[start:p.pos], " \t\r\n")
+	if len(raw) == 0 {
+		return nil, p.errorf(start, "expected operand")
+	}
+	if !isExpression(raw) {
+		return &operand{kind: keyOperand, key: raw, pos: start}, nil
+	}
+	if strings.ContainsAny(raw, "\r\n") {
+		return nil, p.errorf(start, "integer expression %q spans lines", raw)
+	}
+	ep := &exprParser{text: raw}
+	if _, err := ep.parse(); err != nil {
+		return nil, p.errorf(start+min(ep.pos, len(raw)), "bad integer expression %q: %v", raw, err)
+	}
+	return &operand{kind: intOperand, key: raw, pos: start}, nil
+}
+
+// Format returns the text form of the predicate, such that
+// Parse(Format(pred)) reproduces it.
+func Format(pred *lpb.Predicate) string {
+	var buf strings.Builder
+	format(pred, &buf)
+	return buf.String()
+}
+
+func format(pred *lpb.Predicate, buf *strings.Builder) {
+	if comb := pred.GetComb(); comb != nil {
+		buf.WriteString(combinatorName(comb.GetOperation()))
+		buf.WriteString("(")
+		for idx, sub := range comb.GetOperands() {
+			if idx > 0 {
+				buf.WriteString(", ")
+			}
+			format(sub, buf)
+		}
+		buf.WriteString(")")
+		return
+	}
+	comp := pred.GetComp()
+	if comp == nil {
+		buf.WriteString("true")
+		return
+	}
+
+	one, two := comp.GetKeyOne(), comp.GetKeyTwo()
+	switch op := comp.GetOperation(); op {
+	case lpb.Compare_CMP_STREQ:
+		opText := " eq "
+		if isStrLiteral(one) || isStrLiteral(two) {
+			opText = " == "
+		}
+		buf.WriteString(formatStr(one) + opText + formatStr(two))
+	case lpb.Compare_CMP_STRIN:
+		buf.WriteString(formatStr(one) + " in " + formatArr(two))
+	default:
+		for text, iop := range intOperators {
+			if iop == op {
+				buf.WriteString(one + " " + text + " " + two)
+				return
+			}
+		}
+		buf.WriteString(fmt.Sprintf("%s %v %s", one, op, two))
+	}
+}
+
+// combinatorName returns the text form of the combination operator.
+func combinatorName(op lpb.Combine_Op) string {
+	for name, cop := range combinators {
+		if cop == op {
+			return name
+		}
+	}
+	return op.String()
+}
+
+func isStrLiteral(key string) bool {
+	return strings.HasPrefix(key, "'")
+}
+
+// formatStr returns the text form of a string literal or key.
+func formatStr(key string) string {
+	if !isStrLiteral(key) {
+		return key
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(key[1:])
+	return "'" + escaped + "'"
+}
+
+// formatArr returns the text form of an array literal or key.
+func formatArr(key string) string {
+	literal, ok := strings.CutPrefix(key, "[")
+	if !ok {
+		return key
+	}
+	literal, ok = strings.CutSuffix(literal, "]")
+	if !ok {
+		return key
+	}
+	entries := strings.Split(literal, ",")
+	for idx, entry := range entries {
+		entries[idx] = formatStr(strings.Trim(entry, " "))
+	}
+	return "[" + strings.Join(entries, ", ") + "]"
+}
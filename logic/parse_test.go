@@ -0,0 +1,203 @@
+package logic
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	lpb "github.com/kingofmen/cyoa-exploratory/logic/proto"
+)
+
+func comp(one string, op lpb.Compare_Op, two string) *lpb.Predicate {
+	return &lpb.Predicate{
+		Test: &lpb.Predicate_Comp{
+			Comp: &lpb.Compare{
+				KeyOne:    proto.String(one),
+				KeyTwo:    proto.String(two),
+				Operation: op.Enum(),
+			},
+		},
+	}
+}
+
+func comb(op lpb.Combine_Op, preds ...*lpb.Predicate) *lpb.Predicate {
+	return &lpb.Predicate{
+		Test: &lpb.Predicate_Comb{
+			Comb: &lpb.Combine{
+				Operands:  preds,
+				Operation: op.Enum(),
+			},
+		},
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		desc string
+		text string
+		want *lpb.Predicate
+		// Canonical form returned by Format, if different from text.
+		canon string
+	}{
+		{
+			desc: "Unconditional",
+			text: "true",
+			want: &lpb.Predicate{},
+		},
+		{
+			desc: "Integer comparison",
+			text: "gold >= 10",
+			want: comp("gold", lpb.Compare_CMP_GTE, "10"),
+		},
+		{
+			desc: "Arithmetic",
+			text: "gold + silver/10 >= 50",
+			want: comp("gold + silver/10", lpb.Compare_CMP_GTE, "50"),
+		},
+		{
+			desc:  "Scoped keys and functions",
+			text:  "strength>max(2*ogre.strength, 5)",
+			want:  comp("strength", lpb.Compare_CMP_GT, "max(2*ogre.strength, 5)"),
+			canon: "strength > max(2*ogre.strength, 5)",
+		},
+		{
+			desc: "Dice",
+			text: "2d6 + dexterity > 1d100",
+			want: comp("2d6 + dexterity", lpb.Compare_CMP_GT, "1d100"),
+		},
+		{
+			desc: "String literal equality",
+			text: "class == 'fighter'",
+			want: comp("class", lpb.Compare_CMP_STREQ, "'fighter"),
+		},
+		{
+			desc: "String key equality",
+			text: "class eq guild.class",
+			want: comp("class", lpb.Compare_CMP_STREQ, "guild.class"),
+		},
+		{
+			desc: "Escaped quote",
+			text: `name == 'O\'Brien'`,
+			want: comp("name", lpb.Compare_CMP_STREQ, "'O'Brien"),
+		},
+		{
+			desc: "String in key",
+			text: "'sword' in inventory",
+			want: comp("'sword", lpb.Compare_CMP_STRIN, "inventory"),
+		},
+		{
+			desc: "String in array literal",
+			text: "class in ['fighter', 'rogue', guild.class]",
+			want: comp("class", lpb.Compare_CMP_STRIN, "['fighter, 'rogue, guild.class]"),
+		},
+		{
+			desc: "Nested combination",
+			text: "all(gold >= 10, any(class == 'fighter', 'sword' in inventory))",
+			want: comb(lpb.Combine_IF_ALL,
+				comp("gold", lpb.Compare_CMP_GTE, "10"),
+				comb(lpb.Combine_IF_ANY,
+					comp("class", lpb.Compare_CMP_STREQ, "'fighter"),
+					comp("'sword", lpb.Compare_CMP_STRIN, "inventory"),
+				),
+			),
+		},
+		{
+			desc:  "Multi-line with none",
+			text:  "none(\n  ogre_defeated > 0,\n  player_killed != 0\n)",
+			want:  comb(lpb.Combine_IF_NONE, comp("ogre_defeated", lpb.Compare_CMP_GT, "0"), comp("player_killed", lpb.Compare_CMP_NEQ, "0")),
+			canon: "none(ogre_defeated > 0, player_killed != 0)",
+		},
+		{
+			desc: "Empty combination",
+			text: "any()",
+			want: comb(lpb.Combine_IF_ANY),
+		},
+		{
+			desc: "Variable named like a keyword",
+			text: "all > true",
+			want: comp("all", lpb.Compare_CMP_GT, "true"),
+		},
+	}
+
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			got, err := Parse(cc.text)
+			if err != nil {
+				t.Fatalf("%s: Parse(%q) => %v, want nil", cc.desc, cc.text, err)
+			}
+			if diff := cmp.Diff(got, cc.want, protocmp.Transform()); diff != "" {
+				t.Errorf("%s: Parse(%q) => %s, want %s, diff %s", cc.desc, cc.text, prototext.Format(got), prototext.Format(cc.want), diff)
+			}
+			canon := cc.canon
+			if len(canon) == 0 {
+				canon = cc.text
+			}
+			text := Format(got)
+			if text != canon {
+				t.Errorf("%s: Format() => %q, want %q", cc.desc, text, canon)
+			}
+			again, err := Parse(text)
+			if err != nil {
+				t.Fatalf("%s: Parse(Format()) => %v, want nil", cc.desc, err)
+			}
+			if diff := cmp.Diff(again, got, protocmp.Transform()); diff != "" {
+				t.Errorf("%s: Parse(Format()) did not round-trip, diff %s", cc.desc, diff)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		desc string
+		text string
+		line int
+		col  int
+	}{
+		{desc: "Empty", text: "", line: 1, col: 1},
+		{desc: "Missing operator", text: "gold 10", line: 1, col: 6},
+		{desc: "Missing operand", text: "gold >=", line: 1, col: 8},
+		{desc: "Unterminated string", text: "class == 'fighter", line: 1, col: 10},
+		{desc: "Unclosed combination", text: "all(gold > 1", line: 1, col: 13},
+		{desc: "Missing comma", text: "any(a > 1 b > 2)", line: 1, col: 11},
+		{desc: "String with integer operator", text: "class > 'fighter'", line: 1, col: 9},
+		{desc: "Bad expression", text: "all(\n  gold > 1,\n  gold + * 2 > 3)", line: 3, col: 10},
+		{desc: "In needs array", text: "'sword' in 'shield'", line: 1, col: 12},
+		{desc: "Trailing text", text: "gold > 1)", line: 1, col: 9},
+	}
+
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			_, err := Parse(cc.text)
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("%s: Parse(%q) => %v, want ParseError", cc.desc, cc.text, err)
+			}
+			if perr.Line != cc.line || perr.Column != cc.col {
+				t.Errorf("%s: Parse(%q) => error at %d:%d (%v), want %d:%d", cc.desc, cc.text, perr.Line, perr.Column, err, cc.line, cc.col)
+			}
+		})
+	}
+}
+
+func TestFormatEval(t *testing.T) {
+	lookup := NewTestLookup().
+		WithInt("gold", 12).
+		WithStr("class", "rogue").
+		WithStrArr("inventory", []string{"sword", "rope"})
+	pred, err := Parse("all(gold >= 10, any(class == 'fighter', 'sword' in inventory))")
+	if err != nil {
+		t.Fatalf("Parse() => %v, want nil", err)
+	}
+	got, err := Eval(pred, lookup)
+	if err != nil {
+		t.Fatalf("Eval() => %v, want nil", err)
+	}
+	if !got {
+		t.Errorf("Eval(%s) => false, want true", Format(pred))
+	}
+}
@@ -0,0 +1,38 @@
+package logic
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Roller is a source of randomness for dice. A Lookup which also
+// implements Roller can evaluate expressions that roll dice.
+type Roller interface {
+	// Roll returns a uniformly random integer from 1 to sides.
+	Roll(sides int64) (int64, error)
+}
+
+// RandRoller rolls dice from a seeded pseudo-random source, so
+// that a sequence of rolls can be replayed exactly.
+type RandRoller struct {
+	rng *rand.Rand
+}
+
+// NewRandRoller returns a roller seeded with the given value.
+func NewRandRoller(seed int64) *RandRoller {
+	return &RandRoller{
+		rng: rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (r *RandRoller) Roll(sides int64) (int64, error) {
+	if sides < 1 {
+		return 0, fmt.Errorf("cannot roll a die with %d sides", sides)
+	}
+	return r.rng.Int63n(sides) + 1, nil
+}
+
+// NextSeed draws a seed for a later roller from the source.
+func (r *RandRoller) NextSeed() int64 {
+	return r.rng.Int63()
+}
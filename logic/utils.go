@@ -7,6 +7,7 @@ import (
 // TestLookup implements Lookup in memory, for easy testing.
 type TestLookup struct {
 	Scoper
+	roller  Roller
 	ints    map[string]int64
 	strs    map[string]string
 	strarrs map[string][]string
@@ -77,3 +78,19 @@ func (tl *TestLookup) WithStrArr(key string, val []string) *TestLookup {
 	tl.strarrs[key] = val
 	return tl
 }
+
+// WithRoller sets the source of randomness for dice.
+func (tl *TestLookup) WithRoller(r Roller) *TestLookup {
+	if tl == nil {
+		tl = NewTestLookup()
+	}
+	tl.roller = r
+	return tl
+}
+
+func (tl *TestLookup) Roll(sides int64) (int64, error) {
+	if tl == nil || tl.roller == nil {
+		return 0, fmt.Errorf("no roller set")
+	}
+	return tl.roller.Roll(sides)
+}
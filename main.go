@@ -18,16 +18,21 @@ import (
 	"github.com/kingofmen/cyoa-exploratory/db"
 	"github.com/kingofmen/cyoa-exploratory/frontend"
 	"github.com/kingofmen/cyoa-exploratory/narrate"
+	"github.com/kingofmen/cyoa-exploratory/story"
 	"github.com/soheilhy/cmux"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/reflection"
 
 	spb "github.com/kingofmen/cyoa-exploratory/backend/proto"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 var dbPool *sql.DB // Global variable to hold the connection pool
 
 // FakeClient implements CyoaClient by just calling the handlers
-// library directly.
+// library directly, for running the frontend in-process.
 type FakeClient struct {
 	root *handlers.Server
 }
@@ -161,71 +166,97 @@ func (fc *FakeClient) GameState(ctx context.Context, in *spb.GameStateRequest, o
 	return fc.root.GameState(ctx, in)
 }
 
-func main() {
-	// Read connection config from environment.
-	user := os.Getenv("CYOA_DB_USER")
-	network := os.Getenv("CYOA_DB_CONN_TYPE")
-	instance := os.Getenv("CYOA_DB_INSTANCE")
-	dbname := os.Getenv("CYOA_DB_NAME")
+func (fc *FakeClient) GetGameHistory(ctx context.Context, in *spb.GetGameHistoryRequest, opts ...grpc.CallOption) (*spb.GetGameHistoryResponse, error) {
+	if err := fc.validate(); err != nil {
+		return nil, err
+	}
+	return fc.root.GetGameHistory(ctx, in)
+}
 
-	// For local testing, do not expose in prod!
-	passwd := os.Getenv("CYOA_DB_PASSWD")
-	dbport := os.Getenv("CYOA_DB_PORT")
-	grokApiKey := os.Getenv("CYOA_GROK_SECRET")
+func (fc *FakeClient) RewindGame(ctx context.Context, in *spb.RewindGameRequest, opts ...grpc.CallOption) (*spb.RewindGameResponse, error) {
+	if err := fc.validate(); err != nil {
+		return nil, err
+	}
+	return fc.root.RewindGame(ctx, in)
+}
 
-	dbcfg, err := initialize.FromEnv(user, passwd, network, instance, dbport, dbname)
-	if err != nil {
-		log.Fatalf("Could not initialize DB configuration: %v", err)
+func (fc *FakeClient) ForkGame(ctx context.Context, in *spb.ForkGameRequest, opts ...grpc.CallOption) (*spb.ForkGameResponse, error) {
+	if err := fc.validate(); err != nil {
+		return nil, err
 	}
+	return fc.root.ForkGame(ctx, in)
+}
 
-	// TODO: Fetch AI API keys from SecretManager here.
+// options are the settings main reads from the environment.
+type options struct {
+	user, network, instance, dbname string
+	// For local testing, do not expose in prod!
+	passwd, dbport string
+	port           string
+	grokApiKey     string
+	verbose        bool
+	// If set, the frontend calls the backend directly instead of over gRPC.
+	inProcess bool
+	// If set, content is kept in memory and lost on shutdown.
+	inMemory bool
+	// If set, anyone can see the condition traces of any playthrough.
+	// There is no authentication, so do not set it in prod.
+	authors bool
+}
 
-	ctx := context.Background()
-	dbPool, cleanup, err := initialize.ConnectionPool(ctx, dbcfg)
-	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
-	}
-	if cleanup != nil {
-		defer cleanup() // Ensure Cloud SQL connector resources are cleaned up
+// optionsFromEnv reads the connection config from the environment.
+// For a local SQLite database, set the connection type to "sqlite"
+// and the instance to the database file.
+func optionsFromEnv() *options {
+	return &options{
+		user:       os.Getenv("CYOA_DB_USER"),
+		network:    os.Getenv("CYOA_DB_CONN_TYPE"),
+		instance:   os.Getenv("CYOA_DB_INSTANCE"),
+		dbname:     os.Getenv("CYOA_DB_NAME"),
+		passwd:     os.Getenv("CYOA_DB_PASSWD"),
+		dbport:     os.Getenv("CYOA_DB_PORT"),
+		port:       os.Getenv("PORT"),
+		grokApiKey: os.Getenv("CYOA_GROK_SECRET"),
+		verbose:    len(os.Getenv("CYOA_VERBOSE")) > 0,
+		inProcess:  len(os.Getenv("CYOA_IN_PROCESS")) > 0,
+		inMemory:   len(os.Getenv("CYOA_IN_MEMORY")) > 0,
+		authors:    len(os.Getenv("CYOA_AUTHOR_MODE")) > 0,
 	}
-	defer dbPool.Close() // Close the connection pool on shutdown
+}
 
-	addr := fmt.Sprintf(":%s", os.Getenv("PORT"))
-	if len(addr) < 2 {
-		addr = ":8080" // Default Cloud Run port.
+// openStore returns the store the options ask for, and a function
+// which closes it.
+func openStore(ctx context.Context, opts *options) (handlers.Store, func(), error) {
+	if opts.inMemory {
+		log.Println("Keeping content in memory")
+		return handlers.NewMemoryStore(), func() {}, nil
 	}
-	// --- Main Listener ---
-	lis, err := net.Listen("tcp", addr)
+	dbcfg, err := initialize.FromEnv(opts.user, opts.passwd, opts.network, opts.instance, opts.dbport, opts.dbname)
 	if err != nil {
-		log.Fatalf("Failed to listen on port %s: %v", addr, err)
+		return nil, nil, fmt.Errorf("could not initialize DB configuration: %w", err)
 	}
-	log.Printf("Listening on %s", addr)
-
-	// --- Multiplexer Setup (cmux) ---
-	m := cmux.New(lis)
-
-	// Match gRPC requests (HTTP/2 with specific header)
-	//grpcL := m.MatchWithWriters(cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"))
-	//log.Println("Matcher created for gRPC")
-
-	// Match HTTP/1.1 requests
-	httpL := m.Match(cmux.HTTP1Fast())
-	log.Println("Matcher created for HTTP/1.1")
-
-	// --- gRPC Server Setup ---
-	beRoot := handlers.New(dbPool).
-		WithNarrator("grok", narrate.NewGrokker(grokApiKey)).
-		WithNarrator("debug_grok", narrate.DebugGrokker())
-
-	// TODO: Set up as actual gRPC server with muxer instead of this fakery.
-	fcli := &FakeClient{
-		root: beRoot,
+	dbPool, cleanup, err := initialize.ConnectionPool(ctx, dbcfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	dialect := handlers.MySQL
+	if dbcfg.Net == initialize.SQLiteNet {
+		dialect = handlers.SQLite
 	}
+	closer := func() {
+		dbPool.Close() // Close the connection pool on shutdown
+		if cleanup != nil {
+			cleanup() // Ensure Cloud SQL connector resources are cleaned up
+		}
+	}
+	return handlers.NewSQLStore(dbPool, dialect), closer, nil
+}
 
-	// --- HTTP Server Setup ---
+// frontendHandler serves the frontend pages, which call the backend
+// through the client.
+func frontendHandler(cli spb.CyoaClient) http.Handler {
 	httpMux := http.NewServeMux()
-	// Frontend server.
-	feRoot := server.NewHandler(fcli)
+	feRoot := server.NewHandler(cli)
 	httpMux.HandleFunc(server.CreateLocationURL, feRoot.CreateLocation)
 	httpMux.HandleFunc(server.UpdateLocationURL, feRoot.UpdateLocationHandler)
 	httpMux.HandleFunc(server.CreateOrUpdateStoryURL, feRoot.CreateOrUpdateStoryHandler)
@@ -233,21 +264,101 @@ func main() {
 	httpMux.HandleFunc(server.DeleteStoryURL, feRoot.DeleteStoryHandler)
 	httpMux.HandleFunc(server.CreateGameURL, feRoot.CreatePlaythroughHandler)
 	httpMux.HandleFunc(server.PlayGameURL, feRoot.PlayGameHandler)
+	httpMux.HandleFunc(server.UndoTurnURL, feRoot.UndoTurnHandler)
+	httpMux.HandleFunc(server.ForkGameURL, feRoot.ForkGameHandler)
 	httpMux.HandleFunc(server.ArchiveGameURL, feRoot.ArchiveGameHandler)
+	httpMux.HandleFunc(server.ParsePredicateURL, feRoot.ParsePredicateHandler)
+	httpMux.HandleFunc(server.FormatPredicateURL, feRoot.FormatPredicateHandler)
 	httpMux.Handle("/", feRoot)
 
 	// For loading internal files e.g. JavaScript.
 	fs := http.FileServer(http.Dir("frontend/story_editor_app/dist"))
 	httpMux.Handle("/static/", http.StripPrefix("/static/", fs))
+	return httpMux
+}
+
+// app is the gRPC backend and the HTTP frontend, sharing a listener.
+type app struct {
+	lis     net.Listener
+	mux     cmux.CMux
+	grpcS   *grpc.Server
+	healthS *health.Server
+	httpS   *http.Server
+	grpcL   net.Listener
+	httpL   net.Listener
+	// conn is the frontend's connection to the backend, unless it
+	// calls the backend in-process.
+	conn *grpc.ClientConn
+}
+
+// newApp sets up the servers on the listener. The frontend gets a
+// client which calls the backend in-process or over gRPC, as the
+// options ask.
+func newApp(lis net.Listener, store handlers.Store, opts *options, frontend func(spb.CyoaClient) http.Handler) (*app, error) {
+	a := &app{lis: lis}
+	// --- Multiplexer Setup (cmux) ---
+	a.mux = cmux.New(lis)
+
+	// Match gRPC requests (HTTP/2 with specific header)
+	a.grpcL = a.mux.MatchWithWriters(cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"))
+	log.Println("Matcher created for gRPC")
+
+	// Match HTTP/1.1 requests
+	a.httpL = a.mux.Match(cmux.HTTP1Fast())
+	log.Println("Matcher created for HTTP/1.1")
 
-	httpS := &http.Server{
-		Handler: httpMux,
+	// --- gRPC Server Setup ---
+	beRoot := handlers.New(store).
+		WithNarrator("grok", narrate.NewGrokker(opts.grokApiKey)).
+		WithNarrator("debug_grok", narrate.DebugGrokker()).
+		WithAuthors(opts.authors)
+
+	a.grpcS = grpc.NewServer()
+	spb.RegisterCyoaServer(a.grpcS, beRoot)
+	a.healthS = health.NewServer()
+	a.healthS.SetServingStatus(spb.Cyoa_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(a.grpcS, a.healthS)
+	// Lets grpcurl discover the service.
+	reflection.Register(a.grpcS)
+	log.Println("gRPC server configured")
+
+	var cli spb.CyoaClient
+	if opts.inProcess {
+		log.Println("Frontend calling backend in-process")
+		cli = &FakeClient{
+			root: beRoot,
+		}
+	} else {
+		target := fmt.Sprintf("localhost:%d", lis.Addr().(*net.TCPAddr).Port)
+		conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gRPC client for %s: %w", target, err)
+		}
+		a.conn = conn
+		cli = spb.NewCyoaClient(conn)
+	}
+
+	// --- HTTP Server Setup ---
+	a.httpS = &http.Server{
+		Handler: frontend(cli),
 	}
 	log.Println("HTTP server configured")
+	return a, nil
+}
+
+// serve starts the servers in the background.
+func (a *app) serve() {
+	go func() {
+		log.Println("Starting gRPC server...")
+		if err := a.grpcS.Serve(a.grpcL); err != nil && err != grpc.ErrServerStopped && err != cmux.ErrListenerClosed && err != cmux.ErrServerClosed {
+			log.Fatalf("gRPC server error: %v", err)
+		}
+		log.Println("gRPC server stopped.")
+	}()
 
 	go func() {
 		log.Println("Starting HTTP server...")
-		if err := httpS.Serve(httpL); err != nil && err != http.ErrServerClosed && err != cmux.ErrListenerClosed {
+		if err := a.httpS.Serve(a.httpL); err != nil && err != http.ErrServerClosed && err != cmux.ErrListenerClosed && err != cmux.ErrServerClosed {
 			log.Fatalf("HTTP server error: %v", err)
 		}
 		log.Println("HTTP server stopped.")
@@ -256,11 +367,65 @@ func main() {
 	// --- Start Multiplexer ---
 	log.Println("Starting cmux server...")
 	go func() {
-		if err := m.Serve(); err != nil && !strings.Contains(err.Error(), "use of closed network connection") {
+		if err := a.mux.Serve(); err != nil && !strings.Contains(err.Error(), "use of closed network connection") {
 			log.Fatalf("cmux Serve error: %v", err)
 		}
 		log.Println("cmux server stopped.")
 	}()
+}
+
+// shutdown stops the servers, waiting until the context is done for
+// HTTP requests to finish.
+func (a *app) shutdown(ctx context.Context) {
+	if a.conn != nil {
+		a.conn.Close()
+	}
+
+	// Gracefully stop gRPC server
+	a.healthS.Shutdown()
+	a.grpcS.GracefulStop()
+	log.Println("gRPC server gracefully stopped.")
+
+	// Gracefully stop HTTP server
+	if err := a.httpS.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown error: %v", err)
+	} else {
+		log.Println("HTTP server gracefully stopped.")
+	}
+
+	// Closing the main listener stops cmux.
+	a.lis.Close()
+}
+
+func main() {
+	opts := optionsFromEnv()
+	story.Verbose = opts.verbose
+
+	// TODO: Fetch AI API keys from SecretManager here.
+
+	ctx := context.Background()
+	store, closeStore, err := openStore(ctx, opts)
+	if err != nil {
+		log.Fatalf("Could not open store: %v", err)
+	}
+	defer closeStore()
+
+	addr := fmt.Sprintf(":%s", opts.port)
+	if len(addr) < 2 {
+		addr = ":8080" // Default Cloud Run port.
+	}
+	// --- Main Listener ---
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("Failed to listen on port %s: %v", addr, err)
+	}
+	log.Printf("Listening on %s", addr)
+
+	a, err := newApp(lis, store, opts, frontendHandler)
+	if err != nil {
+		log.Fatalf("Could not set up servers: %v", err)
+	}
+	a.serve()
 
 	// --- Graceful Shutdown Handling ---
 	quit := make(chan os.Signal, 1)
@@ -270,23 +435,9 @@ func main() {
 	<-quit // Block until signal received
 
 	log.Println("Shutdown signal received, initiating graceful shutdown...")
-
-	// Gracefully stop gRPC server
-	//grpcS.GracefulStop()
-	//log.Println("gRPC server gracefully stopped.")
-
-	// Gracefully stop HTTP server
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second) // 10-second timeout
 	defer cancel()
-	if err := httpS.Shutdown(ctx); err != nil {
-		log.Printf("HTTP server shutdown error: %v", err)
-	} else {
-		log.Println("HTTP server gracefully stopped.")
-	}
-
-	// Close the main listener (implicitly closes cmux listeners)
-	// No need to explicitly close m or sub-listeners if lis is closed.
-	// lis.Close() // Closing the listener might happen automatically via cmux shutdown or signal handling
+	a.shutdown(ctx)
 
 	log.Println("Application shut down gracefully.")
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	spb "github.com/kingofmen/cyoa-exploratory/backend/proto"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+)
+
+func TestServe(t *testing.T) {
+	for _, inProcess := range []bool{false, true} {
+		t.Run(map[bool]string{false: "over gRPC", true: "in-process"}[inProcess], func(t *testing.T) {
+			t.Setenv("CYOA_IN_MEMORY", "1")
+			t.Setenv("CYOA_IN_PROCESS", map[bool]string{false: "", true: "1"}[inProcess])
+			opts := optionsFromEnv()
+			if !opts.inMemory || opts.inProcess != inProcess {
+				t.Fatalf("optionsFromEnv() => in memory %v, in-process %v, want true, %v", opts.inMemory, opts.inProcess, inProcess)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			store, closeStore, err := openStore(ctx, opts)
+			if err != nil {
+				t.Fatalf("openStore() => %v", err)
+			}
+			defer closeStore()
+
+			lis, err := net.Listen("tcp", "localhost:0")
+			if err != nil {
+				t.Fatalf("Listen() => %v", err)
+			}
+			// The frontend is replaced by one which uses the client it is
+			// given to list the stories.
+			var cli spb.CyoaClient
+			frontend := func(c spb.CyoaClient) http.Handler {
+				cli = c
+				return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					resp, err := cli.ListStories(req.Context(), &spb.ListStoriesRequest{})
+					if err != nil {
+						http.Error(w, err.Error(), http.StatusInternalServerError)
+						return
+					}
+					fmt.Fprintf(w, "%d stories", len(resp.GetStories()))
+				})
+			}
+			a, err := newApp(lis, store, opts, frontend)
+			if err != nil {
+				t.Fatalf("newApp() => %v", err)
+			}
+			a.serve()
+			defer a.shutdown(ctx)
+			if _, ok := cli.(*FakeClient); ok != inProcess {
+				t.Errorf("newApp() gave the frontend a %T, want in-process %v", cli, inProcess)
+			}
+
+			// HTTP/1.1 goes to the frontend.
+			hresp, err := http.Get("http://" + lis.Addr().String() + "/")
+			if err != nil {
+				t.Fatalf("GET / => %v", err)
+			}
+			body, err := io.ReadAll(hresp.Body)
+			hresp.Body.Close()
+			if err != nil || hresp.StatusCode != http.StatusOK || string(body) != "0 stories" {
+				t.Errorf("GET / => %d %q, %v, want %d %q", hresp.StatusCode, body, err, http.StatusOK, "0 stories")
+			}
+
+			// gRPC goes to the backend.
+			conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatalf("NewClient() => %v", err)
+			}
+			defer conn.Close()
+			hc, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: spb.Cyoa_ServiceDesc.ServiceName})
+			if err != nil {
+				t.Fatalf("Check() => %v", err)
+			}
+			if hc.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+				t.Errorf("Check() => %v, want %v", hc.GetStatus(), healthpb.HealthCheckResponse_SERVING)
+			}
+			lresp, err := spb.NewCyoaClient(conn).ListStories(ctx, &spb.ListStoriesRequest{})
+			if err != nil {
+				t.Fatalf("ListStories() => %v", err)
+			}
+			if got := len(lresp.GetStories()); got != 0 {
+				t.Errorf("ListStories() => %d stories, want none", got)
+			}
+
+			// Reflection lists the service.
+			stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+			if err != nil {
+				t.Fatalf("ServerReflectionInfo() => %v", err)
+			}
+			if err := stream.Send(&reflectionpb.ServerReflectionRequest{
+				MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+			}); err != nil {
+				t.Fatalf("Send() => %v", err)
+			}
+			rresp, err := stream.Recv()
+			if err != nil {
+				t.Fatalf("Recv() => %v", err)
+			}
+			stream.CloseSend()
+			found := false
+			for _, svc := range rresp.GetListServicesResponse().GetService() {
+				found = found || svc.GetName() == spb.Cyoa_ServiceDesc.ServiceName
+			}
+			if !found {
+				t.Errorf("ListServices() => %v, want %s", rresp.GetListServicesResponse().GetService(), spb.Cyoa_ServiceDesc.ServiceName)
+			}
+			conn.Close()
+		})
+	}
+}
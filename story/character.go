@@ -0,0 +1,187 @@
+package story
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/kingofmen/cyoa-exploratory/logic"
+	"google.golang.org/protobuf/proto"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+const (
+	// CharacterScope is the predicate scope of the player character.
+	CharacterScope = "char"
+	// CustomCharacterId is the ID given to player-defined characters.
+	CustomCharacterId = "custom"
+)
+
+// character implements logic.Lookup over the player character.
+// Attributes the character lacks are zero or empty.
+type character struct {
+	logic.Scoper
+	char *storypb.Character
+}
+
+func (c *character) GetInt(key string) (int64, error) {
+	return c.char.GetValues()[key], nil
+}
+
+func (c *character) GetStr(key string) (string, error) {
+	return c.char.GetStrings()[key], nil
+}
+
+func (c *character) GetStrArr(key string) ([]string, error) {
+	return nil, fmt.Errorf("character attribute %q is not a string array", key)
+}
+
+// CheckCharacters returns an error if the story's precreated
+// characters or custom-character rules are inconsistent.
+func CheckCharacters(str *storypb.Story) error {
+	var errs []error
+	seen := map[string]bool{CustomCharacterId: true}
+	for idx, char := range str.GetCharacters() {
+		cid := char.GetId()
+		if len(cid) == 0 || seen[cid] {
+			errs = append(errs, fmt.Errorf("character %d (%s) has missing, reserved or duplicate ID %q", idx, char.GetName(), cid))
+		}
+		seen[cid] = true
+		for key := range char.GetValues() {
+			if !validName(key) {
+				errs = append(errs, fmt.Errorf("character %q has invalid attribute name %q", cid, key))
+			}
+		}
+		for key := range char.GetStrings() {
+			if !validName(key) {
+				errs = append(errs, fmt.Errorf("character %q has invalid attribute name %q", cid, key))
+			}
+		}
+	}
+	rules := str.GetCharacterRules()
+	if _, err := Schema(&storypb.Story{Variables: rules.GetAttributes()}); err != nil {
+		errs = append(errs, fmt.Errorf("bad custom character attributes: %w", err))
+	}
+	for _, attr := range rules.GetAttributes() {
+		if attr.GetType() == storypb.Variable_VT_STRING_ARRAY {
+			errs = append(errs, fmt.Errorf("custom character attribute %q cannot be a string array", attr.GetName()))
+		}
+		if ch := attr.GetChoices(); len(ch) > 0 && !slices.Contains(ch, attr.GetDefaultStr()) {
+			errs = append(errs, fmt.Errorf("custom character attribute %q has default %q outside its choices", attr.GetName(), attr.GetDefaultStr()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CharacterSchema declares the attributes of the story's precreated
+// and custom characters, for checking predicates.
+func CharacterSchema(str *storypb.Story) *logic.Schema {
+	schema := logic.NewSchema()
+	for _, char := range str.GetCharacters() {
+		for key := range char.GetValues() {
+			schema.WithVar(key, logic.IntVar)
+		}
+		for key := range char.GetStrings() {
+			schema.WithVar(key, logic.StrVar)
+		}
+	}
+	for _, attr := range str.GetCharacterRules().GetAttributes() {
+		schema.WithVar(attr.GetName(), varTypes[attr.GetType()])
+	}
+	return schema
+}
+
+// ChooseCharacter returns the character a new playthrough of the
+// story will play: the precreated character with the given ID, or
+// the custom character with defaults filled in, if it obeys the
+// story's rules. Stories without characters need neither.
+func ChooseCharacter(str *storypb.Story, cid string, custom *storypb.Character) (*storypb.Character, error) {
+	if len(cid) > 0 && custom != nil {
+		return nil, fmt.Errorf("cannot choose both character %q and a custom character", cid)
+	}
+	if len(cid) > 0 {
+		for _, char := range str.GetCharacters() {
+			if char.GetId() == cid {
+				return proto.Clone(char).(*storypb.Character), nil
+			}
+		}
+		return nil, fmt.Errorf("story %d has no character %q", str.GetId(), cid)
+	}
+	rules := str.GetCharacterRules()
+	if custom == nil {
+		if len(str.GetCharacters()) > 0 || rules.GetAllowCustom() {
+			return nil, fmt.Errorf("story %d requires choosing a character", str.GetId())
+		}
+		return nil, nil
+	}
+	if !rules.GetAllowCustom() {
+		return nil, fmt.Errorf("story %d does not allow custom characters", str.GetId())
+	}
+	return customCharacter(rules, custom)
+}
+
+// customCharacter validates the custom character against the rules.
+func customCharacter(rules *storypb.CharacterRules, custom *storypb.Character) (*storypb.Character, error) {
+	if len(custom.GetName()) == 0 {
+		return nil, fmt.Errorf("custom character needs a name")
+	}
+	attrs := make(map[string]*storypb.Variable)
+	for _, attr := range rules.GetAttributes() {
+		attrs[attr.GetName()] = attr
+	}
+	var errs []error
+	for key := range custom.GetValues() {
+		if attrs[key] == nil || attrs[key].GetType() != storypb.Variable_VT_INT {
+			errs = append(errs, fmt.Errorf("%q is not an integer attribute of custom characters", key))
+		}
+	}
+	for key := range custom.GetStrings() {
+		if attrs[key] == nil || attrs[key].GetType() != storypb.Variable_VT_STRING {
+			errs = append(errs, fmt.Errorf("%q is not a string attribute of custom characters", key))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	char := &storypb.Character{
+		Id:          proto.String(CustomCharacterId),
+		Name:        proto.String(custom.GetName()),
+		Description: custom.Description,
+		Values:      make(map[string]int64),
+		Strings:     make(map[string]string),
+	}
+	var total int64
+	for _, attr := range rules.GetAttributes() {
+		name := attr.GetName()
+		switch attr.GetType() {
+		case storypb.Variable_VT_INT:
+			val, ok := custom.GetValues()[name]
+			if !ok {
+				val = attr.GetDefaultInt()
+			}
+			if (attr.Min != nil && val < attr.GetMin()) || (attr.Max != nil && val > attr.GetMax()) {
+				errs = append(errs, fmt.Errorf("%s %d is outside the range %d to %d", name, val, attr.GetMin(), attr.GetMax()))
+			}
+			char.Values[name] = val
+			total += val
+		case storypb.Variable_VT_STRING:
+			val, ok := custom.GetStrings()[name]
+			if !ok {
+				val = attr.GetDefaultStr()
+			}
+			if ch := attr.GetChoices(); len(ch) > 0 && !slices.Contains(ch, val) {
+				errs = append(errs, fmt.Errorf("%s %q is not one of %q", name, val, ch))
+			}
+			char.Strings[name] = val
+		}
+	}
+	if budget := rules.GetPointBudget(); budget > 0 && total > budget {
+		errs = append(errs, fmt.Errorf("attributes total %d, more than the budget of %d", total, budget))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return char, nil
+}
@@ -0,0 +1,233 @@
+package story
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kingofmen/cyoa-exploratory/logic"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+func TestChooseCharacter(t *testing.T) {
+	conan := &storypb.Character{
+		Id:      proto.String("conan"),
+		Name:    proto.String("Conan"),
+		Values:  map[string]int64{"strength": 9},
+		Strings: map[string]string{"class": "fighter"},
+	}
+	rules := &storypb.CharacterRules{
+		AllowCustom: proto.Bool(true),
+		PointBudget: proto.Int64(10),
+		Attributes: []*storypb.Variable{
+			&storypb.Variable{Name: proto.String("strength"), DefaultInt: proto.Int64(3), Min: proto.Int64(1), Max: proto.Int64(9)},
+			&storypb.Variable{Name: proto.String("wits"), DefaultInt: proto.Int64(3), Min: proto.Int64(1), Max: proto.Int64(9)},
+			&storypb.Variable{
+				Name:       proto.String("class"),
+				Type:       storypb.Variable_VT_STRING.Enum(),
+				DefaultStr: proto.String("fighter"),
+				Choices:    []string{"fighter", "rogue"},
+			},
+		},
+	}
+	custom := func(values map[string]int64, strs map[string]string) *storypb.Character {
+		return &storypb.Character{Name: proto.String("Bob"), Values: values, Strings: strs}
+	}
+
+	cases := []struct {
+		desc    string
+		str     *storypb.Story
+		cid     string
+		custom  *storypb.Character
+		want    *storypb.Character
+		wantErr bool
+	}{
+		{
+			desc: "No characters",
+			str:  &storypb.Story{},
+		},
+		{
+			desc: "Precreated",
+			str:  &storypb.Story{Characters: []*storypb.Character{conan}},
+			cid:  "conan",
+			want: conan,
+		},
+		{
+			desc:    "Unknown precreated",
+			str:     &storypb.Story{Characters: []*storypb.Character{conan}},
+			cid:     "elric",
+			wantErr: true,
+		},
+		{
+			desc:    "Choice required",
+			str:     &storypb.Story{Characters: []*storypb.Character{conan}},
+			wantErr: true,
+		},
+		{
+			desc:    "Both chosen",
+			str:     &storypb.Story{Characters: []*storypb.Character{conan}, CharacterRules: rules},
+			cid:     "conan",
+			custom:  custom(nil, nil),
+			wantErr: true,
+		},
+		{
+			desc:    "Custom not allowed",
+			str:     &storypb.Story{Characters: []*storypb.Character{conan}},
+			custom:  custom(nil, nil),
+			wantErr: true,
+		},
+		{
+			desc:   "Custom with defaults",
+			str:    &storypb.Story{CharacterRules: rules},
+			custom: custom(map[string]int64{"strength": 6}, nil),
+			want: &storypb.Character{
+				Id:      proto.String(CustomCharacterId),
+				Name:    proto.String("Bob"),
+				Values:  map[string]int64{"strength": 6, "wits": 3},
+				Strings: map[string]string{"class": "fighter"},
+			},
+		},
+		{
+			desc:    "Custom without name",
+			str:     &storypb.Story{CharacterRules: rules},
+			custom:  &storypb.Character{},
+			wantErr: true,
+		},
+		{
+			desc:    "Custom out of bounds",
+			str:     &storypb.Story{CharacterRules: rules},
+			custom:  custom(map[string]int64{"strength": 0}, nil),
+			wantErr: true,
+		},
+		{
+			desc:    "Custom over budget",
+			str:     &storypb.Story{CharacterRules: rules},
+			custom:  custom(map[string]int64{"strength": 6, "wits": 6}, nil),
+			wantErr: true,
+		},
+		{
+			desc:    "Custom bad choice",
+			str:     &storypb.Story{CharacterRules: rules},
+			custom:  custom(nil, map[string]string{"class": "wizard"}),
+			wantErr: true,
+		},
+		{
+			desc:    "Custom undeclared attribute",
+			str:     &storypb.Story{CharacterRules: rules},
+			custom:  custom(map[string]int64{"charm": 1}, nil),
+			wantErr: true,
+		},
+	}
+
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			got, err := ChooseCharacter(cc.str, cc.cid, cc.custom)
+			if cc.wantErr {
+				if err == nil {
+					t.Errorf("%s: ChooseCharacter(%q, %s) => %s, want error", cc.desc, cc.cid, prototext.Format(cc.custom), prototext.Format(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s: ChooseCharacter(%q, %s) => %v, want nil", cc.desc, cc.cid, prototext.Format(cc.custom), err)
+			}
+			if diff := cmp.Diff(cc.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("%s: ChooseCharacter(%q, %s) => %s, want %s, diff %s", cc.desc, cc.cid, prototext.Format(cc.custom), prototext.Format(got), prototext.Format(cc.want), diff)
+			}
+		})
+	}
+}
+
+func TestCharacterPredicates(t *testing.T) {
+	state := newGameState(&storypb.GameEvent{
+		Character: &storypb.Character{
+			Values:  map[string]int64{"strength": 7},
+			Strings: map[string]string{"class": "rogue"},
+		},
+	})
+	cases := map[string]bool{
+		"char.strength > 5":        true,
+		"char.wits > 0":            false,
+		"char.class == 'rogue'":    true,
+		"char.strength + 1d1 >= 8": true,
+	}
+	for text, want := range cases {
+		pred, err := logic.Parse(text)
+		if err != nil {
+			t.Fatalf("Parse(%q) => %v, want nil", text, err)
+		}
+		got, err := logic.Eval(pred, state)
+		if err != nil {
+			t.Errorf("Eval(%q) => %v, want nil", text, err)
+		}
+		if got != want {
+			t.Errorf("Eval(%q) => %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestCheckCharacters(t *testing.T) {
+	cases := []struct {
+		desc  string
+		str   *storypb.Story
+		valid bool
+	}{
+		{
+			desc: "Good",
+			str: &storypb.Story{
+				Characters: []*storypb.Character{
+					&storypb.Character{Id: proto.String("conan"), Values: map[string]int64{"strength": 9}},
+				},
+				CharacterRules: &storypb.CharacterRules{
+					Attributes: []*storypb.Variable{&storypb.Variable{Name: proto.String("strength")}},
+				},
+			},
+			valid: true,
+		},
+		{
+			desc: "Duplicate ID",
+			str: &storypb.Story{Characters: []*storypb.Character{
+				&storypb.Character{Id: proto.String("conan")},
+				&storypb.Character{Id: proto.String("conan")},
+			}},
+		},
+		{
+			desc: "Reserved ID",
+			str: &storypb.Story{Characters: []*storypb.Character{
+				&storypb.Character{Id: proto.String(CustomCharacterId)},
+			}},
+		},
+		{
+			desc: "Bad attribute name",
+			str: &storypb.Story{Characters: []*storypb.Character{
+				&storypb.Character{Id: proto.String("conan"), Values: map[string]int64{"str ength": 9}},
+			}},
+		},
+		{
+			desc: "Array attribute",
+			str: &storypb.Story{CharacterRules: &storypb.CharacterRules{
+				Attributes: []*storypb.Variable{
+					&storypb.Variable{Name: proto.String("bag"), Type: storypb.Variable_VT_STRING_ARRAY.Enum()},
+				},
+			}},
+		},
+		{
+			desc: "Default outside choices",
+			str: &storypb.Story{CharacterRules: &storypb.CharacterRules{
+				Attributes: []*storypb.Variable{
+					&storypb.Variable{Name: proto.String("class"), Type: storypb.Variable_VT_STRING.Enum(), Choices: []string{"rogue"}},
+				},
+			}},
+		},
+	}
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			if err := CheckCharacters(cc.str); (err == nil) != cc.valid {
+				t.Errorf("%s: CheckCharacters(%s) => %v, want valid %v", cc.desc, prototext.Format(cc.str), err, cc.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package story
+
+import (
+	"fmt"
+
+	"github.com/kingofmen/cyoa-exploratory/logic"
+	"google.golang.org/protobuf/proto"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+// GameScope is the predicate scope of the engine's reserved keys,
+// for example "game.turn >= 10" or "game.hour < 6".
+const GameScope = "game"
+
+// Reserved keys of the game scope.
+const (
+	// TurnKey counts the actions taken, including the current one.
+	TurnKey = "turn"
+	// MinutesKey counts the minutes elapsed on the game clock.
+	MinutesKey = "minutes"
+	// DayKey, HourKey and MinuteKey give the clock time.
+	DayKey    = "day"
+	HourKey   = "hour"
+	MinuteKey = "minute"
+)
+
+const kMinutesPerDay = 24 * 60
+
+// clock implements logic.Lookup over the turn counter and clock.
+type clock struct {
+	logic.Scoper
+	game *storypb.GameEvent
+}
+
+func (c *clock) GetInt(key string) (int64, error) {
+	if c == nil || c.game == nil {
+		return 0, fmt.Errorf("game clock not initialized")
+	}
+	now := c.game.GetStory().GetClock().GetStartMinute() + c.game.GetMinutes()
+	switch key {
+	case TurnKey:
+		return c.game.GetTurn(), nil
+	case MinutesKey:
+		return c.game.GetMinutes(), nil
+	case DayKey:
+		return now / kMinutesPerDay, nil
+	case HourKey:
+		return now % kMinutesPerDay / 60, nil
+	case MinuteKey:
+		return now % 60, nil
+	}
+	return 0, fmt.Errorf("unknown game key %q", key)
+}
+
+func (c *clock) GetStr(key string) (string, error) {
+	return "", fmt.Errorf("game key %q is not a string", key)
+}
+
+func (c *clock) GetStrArr(key string) ([]string, error) {
+	return nil, fmt.Errorf("game key %q is not a string array", key)
+}
+
+// GameSchema declares the reserved keys of the game scope.
+func GameSchema() *logic.Schema {
+	schema := logic.NewSchema()
+	for _, key := range []string{TurnKey, MinutesKey, DayKey, HourKey, MinuteKey} {
+		schema.WithVar(key, logic.IntVar)
+	}
+	return schema
+}
+
+// advanceClock counts the action as a turn and moves the clock on
+// by its duration.
+func advanceClock(act *storypb.Action, nState *storypb.GameEvent) {
+	nState.Turn = proto.Int64(nState.GetTurn() + 1)
+	dur := nState.GetStory().GetClock().GetMinutesPerAction()
+	if act.Duration != nil {
+		dur = act.GetDuration()
+	}
+	if dur > 0 {
+		nState.Minutes = proto.Int64(nState.GetMinutes() + dur)
+	}
+}
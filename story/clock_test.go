@@ -0,0 +1,83 @@
+package story
+
+import (
+	"testing"
+
+	"github.com/kingofmen/cyoa-exploratory/logic"
+	"google.golang.org/protobuf/proto"
+
+	lpb "github.com/kingofmen/cyoa-exploratory/logic/proto"
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+func TestClock(t *testing.T) {
+	parse := func(text string) *lpb.Predicate {
+		pred, err := logic.Parse(text)
+		if err != nil {
+			t.Fatalf("Parse(%q) => %v, want nil", text, err)
+		}
+		return pred
+	}
+	wait := &storypb.Action{Id: proto.String("wait")}
+	sleep := &storypb.Action{Id: proto.String("sleep"), Duration: proto.Int64(8 * 60)}
+	loc := &storypb.Location{
+		Id: proto.String("bridge"),
+		PossibleActions: []*storypb.ActionCondition{
+			&storypb.ActionCondition{ActionId: proto.String("wait")},
+			&storypb.ActionCondition{ActionId: proto.String("sleep")},
+		},
+	}
+	str := &storypb.Story{
+		Clock: &storypb.Clock{
+			MinutesPerAction: proto.Int64(30),
+			StartMinute:      proto.Int64(23 * 60),
+		},
+		Events: []*storypb.TriggerAction{
+			&storypb.TriggerAction{
+				Condition: parse("game.turn >= 3"),
+				Effects: []*storypb.Effect{
+					&storypb.Effect{NewState: storypb.RunState_RS_COMPLETE.Enum()},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		act      *storypb.Action
+		turn     int64
+		minutes  int64
+		day      int64
+		hour     int64
+		minute   int64
+		complete bool
+	}{
+		{act: wait, turn: 1, minutes: 30, day: 0, hour: 23, minute: 30},
+		{act: sleep, turn: 2, minutes: 510, day: 1, hour: 7, minute: 30},
+		{act: wait, turn: 3, minutes: 540, day: 1, hour: 8, minute: 0, complete: true},
+	}
+	evt := &storypb.GameEvent{Story: str, Location: loc}
+	for idx, cc := range cases {
+		evt.PlayerAction = cc.act
+		got, err := HandleEvent(evt, NewStaticResolver(nil, nil))
+		if err != nil {
+			t.Fatalf("HandleEvent(%d: %s) => %v, want nil", idx, cc.act.GetId(), err)
+		}
+		scope := newGameState(got).GetScope(GameScope)
+		for key, want := range map[string]int64{TurnKey: cc.turn, MinutesKey: cc.minutes, DayKey: cc.day, HourKey: cc.hour, MinuteKey: cc.minute} {
+			if val, err := scope.GetInt(key); err != nil || val != want {
+				t.Errorf("HandleEvent(%d: %s) => game.%s %d (%v), want %d", idx, cc.act.GetId(), key, val, err, want)
+			}
+		}
+		if complete := got.GetState() == storypb.RunState_RS_COMPLETE; complete != cc.complete {
+			t.Errorf("HandleEvent(%d: %s) => state %v, want complete %v", idx, cc.act.GetId(), got.GetState(), cc.complete)
+		}
+		evt = got
+	}
+
+	schema := logic.NewSchema().WithScope(GameScope, GameSchema())
+	for text, ok := range map[string]bool{"game.hour < 6": true, "game.weather > 0": false} {
+		if err := logic.Check(parse(text), schema); (err == nil) != ok {
+			t.Errorf("Check(%q) => %v, want ok %v", text, err, ok)
+		}
+	}
+}
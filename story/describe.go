@@ -0,0 +1,168 @@
+package story
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kingofmen/cyoa-exploratory/logic"
+	"google.golang.org/protobuf/proto"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+// Delimiters of the variables interpolated into descriptions.
+const (
+	kOpenVar  = "{{"
+	kCloseVar = "}}"
+)
+
+// Render replaces the event's location, player action and candidate
+// actions with copies whose descriptions are rendered for the
+// current state: the first variant whose condition holds, or else
+// the plain description, with variables interpolated. Variables
+// which cannot be evaluated are left as written and reported in the
+// error.
+func Render(event *storypb.GameEvent) error {
+	state := newGameState(event)
+	var errs []error
+	if loc := event.GetLocation(); loc != nil {
+		nloc := proto.Clone(loc).(*storypb.Location)
+		progs := compileList(listKey{owner: loc.GetId(), list: "variants"}, loc.GetRevision(), loc.GetVariants())
+		desc, err := describe(loc.GetDescription(), loc.GetVariants(), progs, state)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("location %s (%s): %w", loc.GetId(), loc.GetTitle(), err))
+		}
+		nloc.Description = proto.String(desc)
+		event.Location = nloc
+	}
+	renderAction := func(act *storypb.Action) *storypb.Action {
+		nact := proto.Clone(act).(*storypb.Action)
+		progs := compileList(listKey{owner: act.GetId(), list: "variants"}, act.GetRevision(), act.GetVariants())
+		desc, err := describe(act.GetDescription(), act.GetVariants(), progs, state)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("action %s (%s): %w", act.GetId(), act.GetTitle(), err))
+		}
+		nact.Description = proto.String(desc)
+		return nact
+	}
+	if act := event.GetPlayerAction(); act != nil {
+		event.PlayerAction = renderAction(act)
+	}
+	cands := make([]*storypb.Action, 0, len(event.GetCandidateActions()))
+	for _, act := range event.GetCandidateActions() {
+		cands = append(cands, renderAction(act))
+	}
+	event.CandidateActions = cands
+	return errors.Join(errs...)
+}
+
+// describe returns the description chosen by the variants, with
+// variables interpolated. The programs are those of compileList for
+// the variants.
+func describe(desc string, variants []*storypb.DescriptionVariant, progs []logic.Program, state *gameState) (string, error) {
+	var errs []error
+	for idx, variant := range variants {
+		ok, err := evalAt(progs, idx, variant.GetCondition(), state)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not evaluate variant %d: %w", idx, err))
+			continue
+		}
+		if ok {
+			desc = variant.GetText()
+			break
+		}
+	}
+	text, err := interpolate(desc, state)
+	return text, errors.Join(append(errs, err)...)
+}
+
+// interpolate replaces each {{key}} in the text with the value of
+// the key, which may be an integer expression.
+func interpolate(text string, state *gameState) (string, error) {
+	var sb strings.Builder
+	var errs []error
+	for {
+		before, key, rest, ok := nextVar(text)
+		if !ok {
+			break
+		}
+		sb.WriteString(before)
+		val, err := renderKey(key, state)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not interpolate %q: %w", key, err))
+			val = text[len(before) : len(text)-len(rest)]
+		}
+		sb.WriteString(val)
+		text = rest
+	}
+	sb.WriteString(text)
+	return sb.String(), errors.Join(errs...)
+}
+
+// nextVar splits the text around its first {{key}}.
+func nextVar(text string) (before, key, rest string, ok bool) {
+	before, after, ok := strings.Cut(text, kOpenVar)
+	if !ok {
+		return "", "", "", false
+	}
+	key, rest, ok = strings.Cut(after, kCloseVar)
+	if !ok {
+		return "", "", "", false
+	}
+	return before, strings.TrimSpace(key), rest, true
+}
+
+// renderKey returns the value of the key as text. Keys holding
+// strings or string arrays are shown as such; anything else is
+// evaluated as an integer expression.
+func renderKey(key string, state *gameState) (string, error) {
+	if attr, ok := strings.CutPrefix(key, CharacterScope+"."); ok {
+		if val, ok := state.game.GetCharacter().GetStrings()[attr]; ok {
+			return val, nil
+		}
+	}
+	if vt, ok := varType(key, state.game); ok {
+		switch vt {
+		case storypb.Variable_VT_STRING:
+			return state.GetStr(key)
+		case storypb.Variable_VT_STRING_ARRAY:
+			arr, err := state.GetStrArr(key)
+			return strings.Join(arr, ", "), err
+		}
+	}
+	val, err := logic.EvalInt(key, state)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(val, 10), nil
+}
+
+// CheckDescription returns an error if the variant conditions or the
+// interpolated variables of the description do not match the schema.
+func CheckDescription(desc string, variants []*storypb.DescriptionVariant, schema *logic.Schema) error {
+	var errs []error
+	texts := []string{desc}
+	for idx, variant := range variants {
+		if err := logic.Check(variant.GetCondition(), schema); err != nil {
+			errs = append(errs, fmt.Errorf("variant %d: %w", idx, err))
+		}
+		texts = append(texts, variant.GetText())
+	}
+	for _, text := range texts {
+		for {
+			_, key, rest, ok := nextVar(text)
+			if !ok {
+				break
+			}
+			if _, err := schema.Lookup(key); err != nil {
+				if err := logic.CheckInt(key, schema); err != nil {
+					errs = append(errs, fmt.Errorf("interpolated %q: %w", key, err))
+				}
+			}
+			text = rest
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,118 @@
+package story
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kingofmen/cyoa-exploratory/logic"
+	"google.golang.org/protobuf/proto"
+
+	lpb "github.com/kingofmen/cyoa-exploratory/logic/proto"
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+func TestRender(t *testing.T) {
+	parse := func(text string) *lpb.Predicate {
+		pred, err := logic.Parse(text)
+		if err != nil {
+			t.Fatalf("Parse(%q) => %v, want nil", text, err)
+		}
+		return pred
+	}
+	lair := &storypb.Location{
+		Id:          proto.String("lair"),
+		Description: proto.String("A dragon sleeps on {{ gold }} coins."),
+		Variants: []*storypb.DescriptionVariant{
+			&storypb.DescriptionVariant{Condition: parse("dragon_hp <= 0"), Text: proto.String("The dragon lies dead, {{char.name}}.")},
+			&storypb.DescriptionVariant{Condition: parse("dragon_hp < 10"), Text: proto.String("The wounded dragon has {{dragon_hp}} hit points.")},
+		},
+	}
+	loot := &storypb.Action{
+		Id:          proto.String("loot"),
+		Description: proto.String("Fill your {{bag}} with {{gold / 2}} coins, {{class}}."),
+	}
+
+	cases := []struct {
+		desc     string
+		vals     map[string]int64
+		wantLoc  string
+		wantLoot string
+	}{
+		{
+			desc:     "Plain",
+			vals:     map[string]int64{"dragon_hp": 20, "gold": 100},
+			wantLoc:  "A dragon sleeps on 100 coins.",
+			wantLoot: "Fill your sack, pouch with 50 coins, thief.",
+		},
+		{
+			desc:     "Second variant",
+			vals:     map[string]int64{"dragon_hp": 5, "gold": 100},
+			wantLoc:  "The wounded dragon has 5 hit points.",
+			wantLoot: "Fill your sack, pouch with 50 coins, thief.",
+		},
+		{
+			desc:     "First variant",
+			vals:     map[string]int64{"dragon_hp": 0, "gold": 3},
+			wantLoc:  "The dragon lies dead, Bilbo.",
+			wantLoot: "Fill your sack, pouch with 1 coins, thief.",
+		},
+	}
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			evt := &storypb.GameEvent{
+				Location:         lair,
+				PlayerAction:     loot,
+				CandidateActions: []*storypb.Action{loot},
+				Values:           cc.vals,
+				Strings:          map[string]string{"class": "thief"},
+				Lists:            map[string]*storypb.StringList{"bag": &storypb.StringList{Values: []string{"sack", "pouch"}}},
+				Character:        &storypb.Character{Strings: map[string]string{"name": "Bilbo"}},
+			}
+			if err := Render(evt); err != nil {
+				t.Errorf("%s: Render() => %v, want nil", cc.desc, err)
+			}
+			if got := evt.GetLocation().GetDescription(); got != cc.wantLoc {
+				t.Errorf("%s: Render() => location %q, want %q", cc.desc, got, cc.wantLoc)
+			}
+			if got := evt.GetPlayerAction().GetDescription(); got != cc.wantLoot {
+				t.Errorf("%s: Render() => action %q, want %q", cc.desc, got, cc.wantLoot)
+			}
+			if got := evt.GetCandidateActions()[0].GetDescription(); got != cc.wantLoot {
+				t.Errorf("%s: Render() => candidate %q, want %q", cc.desc, got, cc.wantLoot)
+			}
+		})
+	}
+	if lair.GetDescription() != "A dragon sleeps on {{ gold }} coins." {
+		t.Errorf("Render() changed the original location: %q", lair.GetDescription())
+	}
+
+	evt := &storypb.GameEvent{
+		Location: &storypb.Location{Description: proto.String("Broken {{gold +}} and unclosed {{gold")},
+	}
+	err := Render(evt)
+	if err == nil {
+		t.Errorf("Render(bad expression) => nil, want error")
+	}
+	if got, want := evt.GetLocation().GetDescription(), "Broken {{gold +}} and unclosed {{gold"; got != want {
+		t.Errorf("Render(bad expression) => %q, want %q", got, want)
+	}
+}
+
+func TestCheckDescription(t *testing.T) {
+	schema := logic.NewSchema().WithVar("gold", logic.IntVar).WithVar("class", logic.StrVar)
+	cases := map[string]bool{
+		"You have {{gold}} coins, {{ class }}.": true,
+		"Half is {{gold / 2}}.":                 true,
+		"You have {{silver}} coins.":            false,
+		"No variables.":                         true,
+	}
+	for text, ok := range cases {
+		if err := CheckDescription(text, nil, schema); (err == nil) != ok {
+			t.Errorf("CheckDescription(%q) => %v, want ok %v", text, err, ok)
+		}
+	}
+	bad := []*storypb.DescriptionVariant{&storypb.DescriptionVariant{Text: proto.String("{{copper}}")}}
+	if err := CheckDescription("", bad, schema); err == nil || !strings.Contains(err.Error(), "copper") {
+		t.Errorf("CheckDescription(variant) => %v, want error about copper", err)
+	}
+}
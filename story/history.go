@@ -0,0 +1,36 @@
+package story
+
+import (
+	"google.golang.org/protobuf/proto"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+// RecordTurn returns the history of the turn which took the game
+// from before to after. Narration is left to the caller.
+func RecordTurn(before, after *storypb.GameEvent) *storypb.TurnRecord {
+	rec := &storypb.TurnRecord{
+		Turn:    proto.Int64(after.GetTurn()),
+		Effects: after.GetEffects(),
+	}
+	if act := after.GetPlayerAction(); act != nil {
+		rec.ActionId = proto.String(act.GetId())
+	}
+	diff := func(key string) {
+		old, cur := before.GetValues()[key], after.GetValues()[key]
+		if old == cur {
+			return
+		}
+		if rec.Values == nil {
+			rec.Values = make(map[string]*storypb.ValueDiff)
+		}
+		rec.Values[key] = &storypb.ValueDiff{Before: proto.Int64(old), After: proto.Int64(cur)}
+	}
+	for key := range before.GetValues() {
+		diff(key)
+	}
+	for key := range after.GetValues() {
+		diff(key)
+	}
+	return rec
+}
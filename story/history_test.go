@@ -0,0 +1,69 @@
+package story
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+func TestRecordTurn(t *testing.T) {
+	cases := []struct {
+		desc   string
+		before *storypb.GameEvent
+		after  *storypb.GameEvent
+		want   *storypb.TurnRecord
+	}{
+		{
+			desc:   "Start",
+			before: &storypb.GameEvent{},
+			after: &storypb.GameEvent{
+				Values:  map[string]int64{"gold": 5, "zero": 0},
+				Effects: []string{"You wake up."},
+			},
+			want: &storypb.TurnRecord{
+				Turn:    proto.Int64(0),
+				Effects: []string{"You wake up."},
+				Values: map[string]*storypb.ValueDiff{
+					"gold": &storypb.ValueDiff{Before: proto.Int64(0), After: proto.Int64(5)},
+				},
+			},
+		},
+		{
+			desc: "Action",
+			before: &storypb.GameEvent{
+				PlayerAction: &storypb.Action{Id: proto.String("dig")},
+				Values:       map[string]int64{"gold": 5, "luck": 1, "gone": 2},
+				Turn:         proto.Int64(3),
+			},
+			after: &storypb.GameEvent{
+				PlayerAction: &storypb.Action{Id: proto.String("dig")},
+				Values:       map[string]int64{"gold": 8, "luck": 1},
+				Effects:      []string{"You find gold."},
+				Turn:         proto.Int64(4),
+			},
+			want: &storypb.TurnRecord{
+				Turn:     proto.Int64(4),
+				ActionId: proto.String("dig"),
+				Effects:  []string{"You find gold."},
+				Values: map[string]*storypb.ValueDiff{
+					"gold": &storypb.ValueDiff{Before: proto.Int64(5), After: proto.Int64(8)},
+					"gone": &storypb.ValueDiff{Before: proto.Int64(2), After: proto.Int64(0)},
+				},
+			},
+		},
+	}
+
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			got := RecordTurn(cc.before, cc.after)
+			if diff := cmp.Diff(got, cc.want, protocmp.Transform()); diff != "" {
+				t.Errorf("%s: RecordTurn() => %s, want %s, diff %s", cc.desc, prototext.Format(got), prototext.Format(cc.want), diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package story
+
+import (
+	"fmt"
+
+	"github.com/kingofmen/cyoa-exploratory/logic"
+	"google.golang.org/protobuf/proto"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+// InventoryScope is the predicate scope in which item IDs evaluate
+// to the number carried, for example "inv.rope > 0".
+const InventoryScope = "inv"
+
+// inventory implements logic.Lookup over the items carried in a game.
+type inventory struct {
+	logic.Scoper
+	game *storypb.GameEvent
+}
+
+func (inv *inventory) GetInt(key string) (int64, error) {
+	if inv == nil || inv.game == nil {
+		return 0, fmt.Errorf("inventory not initialized")
+	}
+	return countItem(inv.game.GetInventory(), key), nil
+}
+
+func (inv *inventory) GetStr(key string) (string, error) {
+	return "", fmt.Errorf("inventory item %q is a count, not a string", key)
+}
+
+func (inv *inventory) GetStrArr(key string) ([]string, error) {
+	return nil, fmt.Errorf("inventory item %q is a count, not a string array", key)
+}
+
+// countItem returns the quantity of the item carried.
+func countItem(inv []*storypb.Item, id string) int64 {
+	for _, item := range inv {
+		if item.GetId() == id {
+			return item.GetQuantity()
+		}
+	}
+	return 0
+}
+
+// InventorySchema declares the count of each item in the
+// inventory scope, for checking predicates.
+func InventorySchema(items []*storypb.Item) *logic.Schema {
+	schema := logic.NewSchema()
+	for _, item := range items {
+		schema.WithVar(item.GetId(), logic.IntVar)
+	}
+	return schema
+}
+
+// CheckItems returns an error if any item has an ID which cannot
+// be used in predicates, or which is used twice.
+func CheckItems(items []*storypb.Item) error {
+	seen := make(map[string]bool)
+	for idx, item := range items {
+		id := item.GetId()
+		if !validName(id) {
+			return fmt.Errorf("item %d (%s) has invalid ID %q", idx, item.GetTitle(), id)
+		}
+		if seen[id] {
+			return fmt.Errorf("item ID %q used twice", id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// tweakInventory returns the inventory after the tweak, without
+// changing the original. Granted items are described from the
+// story's item definitions.
+func tweakInventory(inv, items []*storypb.Item, it *storypb.ItemTweak) ([]*storypb.Item, error) {
+	id := it.GetItemId()
+	quantity := int64(1)
+	if it.Quantity != nil {
+		quantity = it.GetQuantity()
+	}
+	op := it.GetOperation()
+	if quantity < 1 && op != storypb.ItemTweak_IT_DROP {
+		return nil, fmt.Errorf("non-positive quantity %d of item %q", quantity, id)
+	}
+	idx := -1
+	for i, item := range inv {
+		if item.GetId() == id {
+			idx = i
+			break
+		}
+	}
+
+	ret := make([]*storypb.Item, 0, len(inv)+1)
+	ret = append(ret, inv...)
+	switch op {
+	case storypb.ItemTweak_IT_GRANT:
+		if idx < 0 {
+			var def *storypb.Item
+			for _, item := range items {
+				if item.GetId() == id {
+					def = item
+					break
+				}
+			}
+			if def == nil {
+				return nil, fmt.Errorf("cannot grant unknown item %q", id)
+			}
+			granted := proto.Clone(def).(*storypb.Item)
+			granted.Quantity = proto.Int64(quantity)
+			return append(ret, granted), nil
+		}
+		held := proto.Clone(inv[idx]).(*storypb.Item)
+		held.Quantity = proto.Int64(held.GetQuantity() + quantity)
+		ret[idx] = held
+	case storypb.ItemTweak_IT_CONSUME:
+		if idx < 0 {
+			return nil, fmt.Errorf("cannot consume item %q, none carried", id)
+		}
+		have := countItem(inv, id)
+		if have < quantity {
+			return nil, fmt.Errorf("cannot consume %d of item %q, only %d carried", quantity, id, have)
+		}
+		if have == quantity {
+			return append(ret[:idx], ret[idx+1:]...), nil
+		}
+		held := proto.Clone(inv[idx]).(*storypb.Item)
+		held.Quantity = proto.Int64(have - quantity)
+		ret[idx] = held
+	case storypb.ItemTweak_IT_DROP:
+		if idx >= 0 {
+			return append(ret[:idx], ret[idx+1:]...), nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown item operation %v", op)
+	}
+	return ret, nil
+}
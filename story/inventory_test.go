@@ -0,0 +1,227 @@
+package story
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kingofmen/cyoa-exploratory/logic"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+func TestInventory(t *testing.T) {
+	item := func(id string, quantity int64) *storypb.Item {
+		return &storypb.Item{Id: proto.String(id), Title: proto.String("The " + id), Quantity: proto.Int64(quantity)}
+	}
+	tweak := func(id string, op storypb.ItemTweak_Op, quantity int64) *storypb.ItemTweak {
+		it := &storypb.ItemTweak{ItemId: proto.String(id), Operation: op.Enum()}
+		if quantity > 0 {
+			it.Quantity = proto.Int64(quantity)
+		}
+		return it
+	}
+	// exactly sets the quantity even if it is not positive.
+	exactly := func(id string, op storypb.ItemTweak_Op, quantity int64) *storypb.ItemTweak {
+		it := tweak(id, op, 0)
+		it.Quantity = proto.Int64(quantity)
+		return it
+	}
+	items := []*storypb.Item{
+		&storypb.Item{Id: proto.String("rope"), Title: proto.String("The rope")},
+		&storypb.Item{Id: proto.String("arrow"), Title: proto.String("The arrow")},
+	}
+
+	cases := []struct {
+		desc    string
+		inv     []*storypb.Item
+		tweaks  []*storypb.ItemTweak
+		wantErr bool
+		want    []*storypb.Item
+	}{
+		{
+			desc:   "Grant new item",
+			tweaks: []*storypb.ItemTweak{tweak("rope", storypb.ItemTweak_IT_GRANT, 0)},
+			want:   []*storypb.Item{item("rope", 1)},
+		},
+		{
+			desc:   "Grant more",
+			inv:    []*storypb.Item{item("arrow", 5)},
+			tweaks: []*storypb.ItemTweak{tweak("arrow", storypb.ItemTweak_IT_GRANT, 10)},
+			want:   []*storypb.Item{item("arrow", 15)},
+		},
+		{
+			desc:   "Consume some",
+			inv:    []*storypb.Item{item("arrow", 5)},
+			tweaks: []*storypb.ItemTweak{tweak("arrow", storypb.ItemTweak_IT_CONSUME, 2)},
+			want:   []*storypb.Item{item("arrow", 3)},
+		},
+		{
+			desc:   "Consume all",
+			inv:    []*storypb.Item{item("rope", 1), item("arrow", 2)},
+			tweaks: []*storypb.ItemTweak{tweak("rope", storypb.ItemTweak_IT_CONSUME, 0)},
+			want:   []*storypb.Item{item("arrow", 2)},
+		},
+		{
+			desc:   "Drop",
+			inv:    []*storypb.Item{item("rope", 1), item("arrow", 20)},
+			tweaks: []*storypb.ItemTweak{tweak("arrow", storypb.ItemTweak_IT_DROP, 0)},
+			want:   []*storypb.Item{item("rope", 1)},
+		},
+		{
+			desc:   "Drop absent item",
+			inv:    []*storypb.Item{item("rope", 1)},
+			tweaks: []*storypb.ItemTweak{tweak("arrow", storypb.ItemTweak_IT_DROP, 0)},
+			want:   []*storypb.Item{item("rope", 1)},
+		},
+		{
+			desc:    "Consume too many",
+			inv:     []*storypb.Item{item("arrow", 2)},
+			tweaks:  []*storypb.ItemTweak{tweak("arrow", storypb.ItemTweak_IT_CONSUME, 3)},
+			wantErr: true,
+			want:    []*storypb.Item{item("arrow", 2)},
+		},
+		{
+			desc:    "Consume absent item",
+			inv:     []*storypb.Item{item("rope", 1)},
+			tweaks:  []*storypb.ItemTweak{tweak("arrow", storypb.ItemTweak_IT_CONSUME, 0)},
+			wantErr: true,
+			want:    []*storypb.Item{item("rope", 1)},
+		},
+		{
+			desc:    "Consume none of absent item",
+			inv:     []*storypb.Item{item("rope", 1)},
+			tweaks:  []*storypb.ItemTweak{exactly("arrow", storypb.ItemTweak_IT_CONSUME, 0)},
+			wantErr: true,
+			want:    []*storypb.Item{item("rope", 1)},
+		},
+		{
+			desc:    "Consume none of held item",
+			inv:     []*storypb.Item{item("arrow", 2)},
+			tweaks:  []*storypb.ItemTweak{exactly("arrow", storypb.ItemTweak_IT_CONSUME, 0)},
+			wantErr: true,
+			want:    []*storypb.Item{item("arrow", 2)},
+		},
+		{
+			desc:    "Consume negative of absent item",
+			inv:     []*storypb.Item{item("rope", 1)},
+			tweaks:  []*storypb.ItemTweak{exactly("arrow", storypb.ItemTweak_IT_CONSUME, -2)},
+			wantErr: true,
+			want:    []*storypb.Item{item("rope", 1)},
+		},
+		{
+			desc:    "Consume negative of held item",
+			inv:     []*storypb.Item{item("arrow", 2)},
+			tweaks:  []*storypb.ItemTweak{exactly("arrow", storypb.ItemTweak_IT_CONSUME, -2)},
+			wantErr: true,
+			want:    []*storypb.Item{item("arrow", 2)},
+		},
+		{
+			desc:    "Grant none",
+			inv:     []*storypb.Item{item("arrow", 2)},
+			tweaks:  []*storypb.ItemTweak{exactly("rope", storypb.ItemTweak_IT_GRANT, 0)},
+			wantErr: true,
+			want:    []*storypb.Item{item("arrow", 2)},
+		},
+		{
+			desc:    "Grant negative of held item",
+			inv:     []*storypb.Item{item("arrow", 2)},
+			tweaks:  []*storypb.ItemTweak{exactly("arrow", storypb.ItemTweak_IT_GRANT, -1)},
+			wantErr: true,
+			want:    []*storypb.Item{item("arrow", 2)},
+		},
+		{
+			desc: "Failure changes nothing",
+			inv:  []*storypb.Item{item("arrow", 2)},
+			tweaks: []*storypb.ItemTweak{
+				tweak("rope", storypb.ItemTweak_IT_GRANT, 0),
+				tweak("sword", storypb.ItemTweak_IT_GRANT, 0),
+			},
+			wantErr: true,
+			want:    []*storypb.Item{item("arrow", 2)},
+		},
+	}
+
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			nState := &storypb.GameEvent{Items: items, Inventory: cc.inv}
+			err := apply(&storypb.Effect{ItemTweaks: cc.tweaks}, nState, newGameState(nState))
+			if (err != nil) != cc.wantErr {
+				t.Errorf("%s: apply() => %v, want error %v", cc.desc, err, cc.wantErr)
+			}
+			got := &storypb.GameEvent{Inventory: nState.GetInventory()}
+			want := &storypb.GameEvent{Inventory: cc.want}
+			if diff := cmp.Diff(got, want, protocmp.Transform()); diff != "" {
+				t.Errorf("%s: apply() => %s, want %s, diff %s", cc.desc, prototext.Format(got), prototext.Format(want), diff)
+			}
+		})
+	}
+}
+
+func TestInventoryPredicates(t *testing.T) {
+	state := newGameState(&storypb.GameEvent{
+		Inventory: []*storypb.Item{
+			&storypb.Item{Id: proto.String("rope"), Quantity: proto.Int64(1)},
+			&storypb.Item{Id: proto.String("arrow"), Quantity: proto.Int64(12)},
+		},
+	})
+	cases := map[string]bool{
+		"inv.rope > 0":                      true,
+		"inv.sword > 0":                     false,
+		"inv.arrow >= 10":                   true,
+		"all(inv.rope == 1, inv.arrow < 5)": false,
+	}
+	for text, want := range cases {
+		pred, err := logic.Parse(text)
+		if err != nil {
+			t.Fatalf("Parse(%q) => %v, want nil", text, err)
+		}
+		got, err := logic.Eval(pred, state)
+		if err != nil {
+			t.Errorf("Eval(%q) => %v, want nil", text, err)
+		}
+		if got != want {
+			t.Errorf("Eval(%q) => %v, want %v", text, got, want)
+		}
+	}
+
+	schema := logic.NewSchema().WithScope(InventoryScope, InventorySchema([]*storypb.Item{
+		&storypb.Item{Id: proto.String("rope")},
+	}))
+	for text, ok := range map[string]bool{"inv.rope > 0": true, "inv.sword > 0": false} {
+		pred, err := logic.Parse(text)
+		if err != nil {
+			t.Fatalf("Parse(%q) => %v, want nil", text, err)
+		}
+		if err := logic.Check(pred, schema); (err == nil) != ok {
+			t.Errorf("Check(%q) => %v, want ok %v", text, err, ok)
+		}
+	}
+}
+
+func TestCheckItems(t *testing.T) {
+	cases := []struct {
+		desc  string
+		ids   []string
+		valid bool
+	}{
+		{desc: "Good", ids: []string{"rope", "magic-sword", "arrow_2"}, valid: true},
+		{desc: "Duplicate", ids: []string{"rope", "rope"}},
+		{desc: "Empty", ids: []string{""}},
+		{desc: "Scoped", ids: []string{"bag.rope"}},
+		{desc: "Expression", ids: []string{"rope+1"}},
+	}
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			var items []*storypb.Item
+			for _, id := range cc.ids {
+				items = append(items, &storypb.Item{Id: proto.String(id)})
+			}
+			if err := CheckItems(items); (err == nil) != cc.valid {
+				t.Errorf("%s: CheckItems(%v) => %v, want valid %v", cc.desc, cc.ids, err, cc.valid)
+			}
+		})
+	}
+}
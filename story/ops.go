@@ -0,0 +1,204 @@
+package story
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/kingofmen/cyoa-exploratory/logic"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+// runOps applies the operations in order to a copy of the state's
+// variables, and returns the copy for the caller to commit, so that
+// a failed operation changes nothing.
+func runOps(ops []*storypb.VariableOp, state *gameState) (*storypb.GameEvent, error) {
+	game := state.game
+	scratch := &storypb.GameEvent{
+		Story:     game.GetStory(),
+		Values:    maps.Clone(game.GetValues()),
+		Strings:   maps.Clone(game.GetStrings()),
+		Lists:     maps.Clone(game.GetLists()),
+		Inventory: game.GetInventory(),
+		Character: game.GetCharacter(),
+		Turn:      game.Turn,
+		Minutes:   game.Minutes,
+	}
+	if scratch.Values == nil {
+		scratch.Values = make(map[string]int64)
+	}
+	if scratch.Strings == nil {
+		scratch.Strings = make(map[string]string)
+	}
+	if scratch.Lists == nil {
+		scratch.Lists = make(map[string]*storypb.StringList)
+	}
+	sState := &gameState{game: scratch, roller: state.roller}
+	for idx, op := range ops {
+		if err := runOp(op, sState); err != nil {
+			return nil, fmt.Errorf("operation %d on %q: %w", idx, op.GetKey(), err)
+		}
+	}
+	return scratch, nil
+}
+
+// runOp applies a single operation to the state's variables.
+func runOp(op *storypb.VariableOp, state *gameState) error {
+	key, game := op.GetKey(), state.game
+	switch o := op.GetOp().(type) {
+	case *storypb.VariableOp_CopyFrom:
+		return copyVar(key, o.CopyFrom, state)
+	case *storypb.VariableOp_Delete:
+		if o.Delete {
+			delete(game.Values, key)
+			delete(game.Strings, key)
+			delete(game.Lists, key)
+		}
+		return nil
+	case nil:
+		return fmt.Errorf("no operation set")
+	}
+
+	if vt, ok := varType(key, game); ok && vt != storypb.Variable_VT_INT {
+		return fmt.Errorf("%q has type %v, used as integer", key, vt)
+	}
+	cur, err := state.GetInt(key)
+	if err != nil {
+		return err
+	}
+	switch o := op.GetOp().(type) {
+	case *storypb.VariableOp_SetExpr:
+		if cur, err = logic.EvalInt(o.SetExpr, state); err != nil {
+			return err
+		}
+	case *storypb.VariableOp_MultiplyExpr:
+		val, err := logic.EvalInt(o.MultiplyExpr, state)
+		if err != nil {
+			return err
+		}
+		if cur, err = logic.Arithmetic('*', cur, val); err != nil {
+			return err
+		}
+	case *storypb.VariableOp_DivideExpr:
+		val, err := logic.EvalInt(o.DivideExpr, state)
+		if err != nil {
+			return err
+		}
+		if cur, err = logic.Arithmetic('/', cur, val); err != nil {
+			return err
+		}
+	case *storypb.VariableOp_Clamp:
+		cur = min(max(cur, o.Clamp.GetMin()), o.Clamp.GetMax())
+	default:
+		return fmt.Errorf("unknown operation %T", o)
+	}
+	game.Values[key] = bounded(game.GetStory(), key, cur)
+	return nil
+}
+
+// copyVar sets the variable to the value of src, which may have any type.
+func copyVar(key, src string, state *gameState) error {
+	game := state.game
+	vt, ok := varType(src, game)
+	if !ok {
+		return fmt.Errorf("no variable %q to copy", src)
+	}
+	if _, err := state.declared(key, vt); err != nil {
+		return err
+	}
+	switch vt {
+	case storypb.Variable_VT_INT:
+		val, err := state.GetInt(src)
+		if err != nil {
+			return err
+		}
+		game.Values[key] = bounded(game.GetStory(), key, val)
+	case storypb.Variable_VT_STRING:
+		val, err := state.GetStr(src)
+		if err != nil {
+			return err
+		}
+		if err := checkChoice(game.GetStory(), key, val); err != nil {
+			return err
+		}
+		game.Strings[key] = val
+	case storypb.Variable_VT_STRING_ARRAY:
+		val, err := state.GetStrArr(src)
+		if err != nil {
+			return err
+		}
+		game.Lists[key] = &storypb.StringList{Values: val}
+	}
+	return nil
+}
+
+// varType returns the type of the variable, from its declaration
+// or else from the value it holds.
+func varType(key string, game *storypb.GameEvent) (storypb.Variable_Type, bool) {
+	if decl := declaration(game.GetStory(), key); decl != nil {
+		return decl.GetType(), true
+	}
+	if _, ok := game.GetValues()[key]; ok {
+		return storypb.Variable_VT_INT, true
+	}
+	if _, ok := game.GetStrings()[key]; ok {
+		return storypb.Variable_VT_STRING, true
+	}
+	if _, ok := game.GetLists()[key]; ok {
+		return storypb.Variable_VT_STRING_ARRAY, true
+	}
+	return storypb.Variable_VT_INT, false
+}
+
+// checkOps returns an error if the operations do not match the schema.
+func checkOps(ops []*storypb.VariableOp, schema *logic.Schema) error {
+	var errs []error
+	for idx, op := range ops {
+		if err := checkOp(op, schema); err != nil {
+			errs = append(errs, fmt.Errorf("operation %d on %q: %w", idx, op.GetKey(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func checkOp(op *storypb.VariableOp, schema *logic.Schema) error {
+	vt, err := schema.Lookup(op.GetKey())
+	if err != nil {
+		return err
+	}
+	intOp := func(ex string) error {
+		if vt != logic.IntVar && vt != logic.AnyVar {
+			return fmt.Errorf("%q has type %v, used as integer", op.GetKey(), vt)
+		}
+		if len(ex) == 0 {
+			return nil
+		}
+		return logic.CheckInt(ex, schema)
+	}
+	switch o := op.GetOp().(type) {
+	case *storypb.VariableOp_SetExpr:
+		return intOp(o.SetExpr)
+	case *storypb.VariableOp_MultiplyExpr:
+		return intOp(o.MultiplyExpr)
+	case *storypb.VariableOp_DivideExpr:
+		return intOp(o.DivideExpr)
+	case *storypb.VariableOp_Clamp:
+		if o.Clamp.GetMin() > o.Clamp.GetMax() {
+			return fmt.Errorf("clamp minimum %d above maximum %d", o.Clamp.GetMin(), o.Clamp.GetMax())
+		}
+		return intOp("")
+	case *storypb.VariableOp_CopyFrom:
+		svt, err := schema.Lookup(o.CopyFrom)
+		if err != nil {
+			return err
+		}
+		if svt != vt && svt != logic.AnyVar && vt != logic.AnyVar {
+			return fmt.Errorf("cannot copy %v %q to %v", svt, o.CopyFrom, vt)
+		}
+		return nil
+	case *storypb.VariableOp_Delete:
+		return nil
+	}
+	return fmt.Errorf("no operation set")
+}
@@ -0,0 +1,250 @@
+package story
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kingofmen/cyoa-exploratory/logic"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+func TestVariableOps(t *testing.T) {
+	set := func(key, ex string) *storypb.VariableOp {
+		return &storypb.VariableOp{Key: proto.String(key), Op: &storypb.VariableOp_SetExpr{SetExpr: ex}}
+	}
+	mul := func(key, ex string) *storypb.VariableOp {
+		return &storypb.VariableOp{Key: proto.String(key), Op: &storypb.VariableOp_MultiplyExpr{MultiplyExpr: ex}}
+	}
+	div := func(key, ex string) *storypb.VariableOp {
+		return &storypb.VariableOp{Key: proto.String(key), Op: &storypb.VariableOp_DivideExpr{DivideExpr: ex}}
+	}
+	clamp := func(key string, lo, hi int64) *storypb.VariableOp {
+		return &storypb.VariableOp{Key: proto.String(key), Op: &storypb.VariableOp_Clamp{Clamp: &storypb.Range{Min: proto.Int64(lo), Max: proto.Int64(hi)}}}
+	}
+	cp := func(key, src string) *storypb.VariableOp {
+		return &storypb.VariableOp{Key: proto.String(key), Op: &storypb.VariableOp_CopyFrom{CopyFrom: src}}
+	}
+	del := func(key string) *storypb.VariableOp {
+		return &storypb.VariableOp{Key: proto.String(key), Op: &storypb.VariableOp_Delete{Delete: true}}
+	}
+
+	start := func() *storypb.GameEvent {
+		return &storypb.GameEvent{
+			Values:  map[string]int64{"gold": 10, "silver": 7},
+			Strings: map[string]string{"class": "rogue"},
+			Lists:   map[string]*storypb.StringList{"bag": &storypb.StringList{Values: []string{"rope"}}},
+		}
+	}
+	cases := []struct {
+		desc    string
+		eff     *storypb.Effect
+		want    *storypb.GameEvent
+		wantErr bool
+	}{
+		{
+			desc: "Set to zero",
+			eff:  &storypb.Effect{Ops: []*storypb.VariableOp{set("gold", "0")}},
+			want: &storypb.GameEvent{
+				Values:  map[string]int64{"gold": 0, "silver": 7},
+				Strings: map[string]string{"class": "rogue"},
+				Lists:   map[string]*storypb.StringList{"bag": &storypb.StringList{Values: []string{"rope"}}},
+			},
+		},
+		{
+			desc: "Set from expression",
+			eff:  &storypb.Effect{Ops: []*storypb.VariableOp{set("gold", "gold + silver * 2")}},
+			want: &storypb.GameEvent{
+				Values:  map[string]int64{"gold": 24, "silver": 7},
+				Strings: map[string]string{"class": "rogue"},
+				Lists:   map[string]*storypb.StringList{"bag": &storypb.StringList{Values: []string{"rope"}}},
+			},
+		},
+		{
+			desc: "Multiply then divide",
+			eff:  &storypb.Effect{Ops: []*storypb.VariableOp{mul("gold", "3"), div("gold", "4")}},
+			want: &storypb.GameEvent{
+				Values:  map[string]int64{"gold": 7, "silver": 7},
+				Strings: map[string]string{"class": "rogue"},
+				Lists:   map[string]*storypb.StringList{"bag": &storypb.StringList{Values: []string{"rope"}}},
+			},
+		},
+		{
+			desc: "Clamp",
+			eff:  &storypb.Effect{Ops: []*storypb.VariableOp{clamp("gold", 0, 5), clamp("silver", 8, 9)}},
+			want: &storypb.GameEvent{
+				Values:  map[string]int64{"gold": 5, "silver": 8},
+				Strings: map[string]string{"class": "rogue"},
+				Lists:   map[string]*storypb.StringList{"bag": &storypb.StringList{Values: []string{"rope"}}},
+			},
+		},
+		{
+			desc: "Copy each type",
+			eff:  &storypb.Effect{Ops: []*storypb.VariableOp{cp("copper", "silver"), cp("title", "class"), cp("pack", "bag")}},
+			want: &storypb.GameEvent{
+				Values:  map[string]int64{"gold": 10, "silver": 7, "copper": 7},
+				Strings: map[string]string{"class": "rogue", "title": "rogue"},
+				Lists: map[string]*storypb.StringList{
+					"bag":  &storypb.StringList{Values: []string{"rope"}},
+					"pack": &storypb.StringList{Values: []string{"rope"}},
+				},
+			},
+		},
+		{
+			desc: "Delete",
+			eff:  &storypb.Effect{Ops: []*storypb.VariableOp{del("gold"), del("class"), del("bag")}},
+			want: &storypb.GameEvent{
+				Values:  map[string]int64{"silver": 7},
+				Strings: map[string]string{},
+				Lists:   map[string]*storypb.StringList{},
+			},
+		},
+		{
+			desc: "Ops before tweak",
+			eff: &storypb.Effect{
+				Ops:         []*storypb.VariableOp{set("gold", "0")},
+				TweakValue:  proto.String("gold"),
+				TweakAmount: proto.Int64(3),
+			},
+			want: &storypb.GameEvent{
+				Values:  map[string]int64{"gold": 3, "silver": 7},
+				Strings: map[string]string{"class": "rogue"},
+				Lists:   map[string]*storypb.StringList{"bag": &storypb.StringList{Values: []string{"rope"}}},
+			},
+		},
+		{
+			desc:    "Division by zero changes nothing",
+			eff:     &storypb.Effect{Ops: []*storypb.VariableOp{set("gold", "1"), div("silver", "gold - 1")}},
+			want:    start(),
+			wantErr: true,
+		},
+		{
+			desc:    "Copy of missing variable",
+			eff:     &storypb.Effect{Ops: []*storypb.VariableOp{cp("gold", "platinum")}},
+			want:    start(),
+			wantErr: true,
+		},
+		{
+			desc:    "Multiply a string",
+			eff:     &storypb.Effect{Ops: []*storypb.VariableOp{mul("class", "2")}},
+			want:    start(),
+			wantErr: true,
+		},
+		{
+			desc:    "No operation",
+			eff:     &storypb.Effect{Ops: []*storypb.VariableOp{&storypb.VariableOp{Key: proto.String("gold")}}},
+			want:    start(),
+			wantErr: true,
+		},
+	}
+
+	ignore := protocmp.IgnoreFields(&storypb.GameEvent{}, "effects")
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			nState := start()
+			err := apply(cc.eff, nState, newGameState(nState))
+			if (err != nil) != cc.wantErr {
+				t.Errorf("%s: apply() => %v, want error %v", cc.desc, err, cc.wantErr)
+			}
+			if diff := cmp.Diff(cc.want, nState, protocmp.Transform(), ignore); diff != "" {
+				t.Errorf("%s: apply() => %s, want %s, diff %s", cc.desc, prototext.Format(nState), prototext.Format(cc.want), diff)
+			}
+		})
+	}
+}
+
+func TestBoundedVariables(t *testing.T) {
+	str := &storypb.Story{
+		Variables: []*storypb.Variable{
+			&storypb.Variable{Name: proto.String("hp"), DefaultInt: proto.Int64(8), Min: proto.Int64(0), Max: proto.Int64(10)},
+			&storypb.Variable{Name: proto.String("gold"), DefaultInt: proto.Int64(50)},
+		},
+	}
+	set := func(ex string) *storypb.VariableOp {
+		return &storypb.VariableOp{Key: proto.String("hp"), Op: &storypb.VariableOp_SetExpr{SetExpr: ex}}
+	}
+	cases := []struct {
+		desc string
+		eff  *storypb.Effect
+		want int64
+	}{
+		{desc: "Tweak past max", eff: &storypb.Effect{TweakValue: proto.String("hp"), TweakAmount: proto.Int64(5)}, want: 10},
+		{desc: "Tweak past min", eff: &storypb.Effect{TweakValue: proto.String("hp"), TweakExpr: proto.String("-20")}, want: 0},
+		{desc: "Set past max", eff: &storypb.Effect{Ops: []*storypb.VariableOp{set("hp * 3")}}, want: 10},
+		{desc: "Clamped between ops", eff: &storypb.Effect{Ops: []*storypb.VariableOp{set("hp + 5"), set("hp - 4")}}, want: 6},
+		{
+			desc: "Copy past max",
+			eff:  &storypb.Effect{Ops: []*storypb.VariableOp{&storypb.VariableOp{Key: proto.String("hp"), Op: &storypb.VariableOp_CopyFrom{CopyFrom: "gold"}}}},
+			want: 10,
+		},
+		{desc: "Within bounds", eff: &storypb.Effect{TweakValue: proto.String("hp"), TweakAmount: proto.Int64(-3)}, want: 5},
+	}
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			nState := &storypb.GameEvent{Story: str}
+			state := newGameState(nState)
+			if err := initialValues(nState, state); err != nil {
+				t.Fatalf("%s: initialValues() => %v", cc.desc, err)
+			}
+			if err := apply(cc.eff, nState, state); err != nil {
+				t.Fatalf("%s: apply() => %v, want nil", cc.desc, err)
+			}
+			if got := nState.GetValues()["hp"]; got != cc.want {
+				t.Errorf("%s: apply() => hp %d, want %d", cc.desc, got, cc.want)
+			}
+		})
+	}
+}
+
+func TestCheckOps(t *testing.T) {
+	schema := logic.NewSchema().
+		WithVar("gold", logic.IntVar).
+		WithVar("silver", logic.IntVar).
+		WithVar("class", logic.StrVar)
+	cases := []struct {
+		desc  string
+		op    *storypb.VariableOp
+		valid bool
+	}{
+		{
+			desc:  "Set",
+			op:    &storypb.VariableOp{Key: proto.String("gold"), Op: &storypb.VariableOp_SetExpr{SetExpr: "silver * 2"}},
+			valid: true,
+		},
+		{
+			desc: "Set unknown",
+			op:   &storypb.VariableOp{Key: proto.String("gold"), Op: &storypb.VariableOp_SetExpr{SetExpr: "copper"}},
+		},
+		{
+			desc: "Set string",
+			op:   &storypb.VariableOp{Key: proto.String("class"), Op: &storypb.VariableOp_SetExpr{SetExpr: "1"}},
+		},
+		{
+			desc: "Bad clamp",
+			op:   &storypb.VariableOp{Key: proto.String("gold"), Op: &storypb.VariableOp_Clamp{Clamp: &storypb.Range{Min: proto.Int64(5), Max: proto.Int64(1)}}},
+		},
+		{
+			desc:  "Copy",
+			op:    &storypb.VariableOp{Key: proto.String("gold"), Op: &storypb.VariableOp_CopyFrom{CopyFrom: "silver"}},
+			valid: true,
+		},
+		{
+			desc: "Copy mismatch",
+			op:   &storypb.VariableOp{Key: proto.String("gold"), Op: &storypb.VariableOp_CopyFrom{CopyFrom: "class"}},
+		},
+		{
+			desc: "Delete undeclared",
+			op:   &storypb.VariableOp{Key: proto.String("copper"), Op: &storypb.VariableOp_Delete{Delete: true}},
+		},
+	}
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			if err := checkOps([]*storypb.VariableOp{cc.op}, schema); (err == nil) != cc.valid {
+				t.Errorf("%s: checkOps(%s) => %v, want valid %v", cc.desc, prototext.Format(cc.op), err, cc.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package story
+
+import (
+	"sync"
+
+	"github.com/kingofmen/cyoa-exploratory/logic"
+
+	lpb "github.com/kingofmen/cyoa-exploratory/logic/proto"
+)
+
+// kMaxCachedLists bounds the number of condition lists whose
+// programs are kept.
+const kMaxCachedLists = 4096
+
+// listKey identifies a list of conditions: its name, and the
+// location, action or region which holds it. Region IDs are only
+// unique within a story, and the story's own lists have no owner.
+type listKey struct {
+	story int64
+	owner string
+	list  string
+}
+
+// compiledList holds the programs of one revision of a list.
+type compiledList struct {
+	revision string
+	progs    []logic.Program
+}
+
+// programs caches compiled conditions. Stories, locations and
+// actions are loaded afresh for every request, but their revisions
+// only change when they are written.
+var programs = struct {
+	sync.RWMutex
+	lists map[listKey]*compiledList
+}{lists: make(map[listKey]*compiledList)}
+
+// condition is a message guarded by a predicate.
+type condition interface {
+	GetCondition() *lpb.Predicate
+}
+
+// compileList returns the programs for the conditions, which are the
+// given revision of the list, compiling them if they are not cached.
+// Conditions which do not compile have nil programs. Without a
+// revision nothing is compiled, and the result is nil.
+func compileList[T condition](key listKey, revision string, conds []T) []logic.Program {
+	if len(revision) == 0 || len(conds) == 0 {
+		return nil
+	}
+	programs.RLock()
+	cached, ok := programs.lists[key]
+	programs.RUnlock()
+	if ok && cached.revision == revision && len(cached.progs) == len(conds) {
+		return cached.progs
+	}
+
+	progs := make([]logic.Program, len(conds))
+	for idx, cond := range conds {
+		if prog, err := logic.Compile(cond.GetCondition()); err == nil {
+			progs[idx] = prog
+		}
+	}
+	programs.Lock()
+	defer programs.Unlock()
+	if _, ok := programs.lists[key]; !ok && len(programs.lists) >= kMaxCachedLists {
+		for old := range programs.lists {
+			delete(programs.lists, old)
+			break
+		}
+	}
+	programs.lists[key] = &compiledList{revision: revision, progs: progs}
+	return progs
+}
+
+// evalAt evaluates the predicate at the index of a list, with its
+// program if it has one.
+func evalAt(progs []logic.Program, idx int, pred *lpb.Predicate, lookup logic.Lookup) (bool, error) {
+	if idx < len(progs) && progs[idx] != nil {
+		return progs[idx].Eval(lookup)
+	}
+	return logic.Eval(pred, lookup)
+}
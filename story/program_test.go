@@ -0,0 +1,65 @@
+package story
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kingofmen/cyoa-exploratory/logic"
+	"google.golang.org/protobuf/proto"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+func TestCachedPrograms(t *testing.T) {
+	state := newGameState(&storypb.GameEvent{
+		Values:  map[string]int64{"gold": 12},
+		Strings: map[string]string{"class": "rogue"},
+		Seed:    proto.Int64(3),
+	})
+	var taps []*storypb.TriggerAction
+	for _, text := range []string{
+		"gold > 10",
+		"gold * 2 == 24",
+		"any(class == 'fighter', gold < 5)",
+		"none(class in ['fighter', 'wizard'])",
+		"silver > 1",
+	} {
+		pred, err := logic.Parse(text)
+		if err != nil {
+			t.Fatalf("Parse(%q) => %v, want nil", text, err)
+		}
+		taps = append(taps, &storypb.TriggerAction{Condition: pred})
+	}
+
+	key := listKey{owner: "cave", list: "enter"}
+	if progs := compileList(key, "", taps); progs != nil {
+		t.Errorf("compileList() without revision => %d programs, want none", len(progs))
+	}
+	first := compileList(key, "one", taps)
+	if len(first) != len(taps) {
+		t.Fatalf("compileList() => %d programs, want %d", len(first), len(taps))
+	}
+	for idx, tap := range taps {
+		want, wantErr := logic.Eval(tap.GetCondition(), state)
+		got, err := evalAt(first, idx, tap.GetCondition(), state)
+		if got != want || (err != nil) != (wantErr != nil) {
+			t.Errorf("evalAt(%d) => %v, %v, want %v, %v", idx, got, err, want, wantErr)
+		}
+	}
+	if again := compileList(key, "one", taps); &again[0] != &first[0] {
+		t.Errorf("compileList() of the same revision compiled again")
+	}
+	if next := compileList(key, "two", taps); &next[0] == &first[0] {
+		t.Errorf("compileList() of a new revision used the old programs")
+	}
+
+	// The cache does not grow past its bound.
+	for idx := range kMaxCachedLists + 10 {
+		compileList(listKey{owner: fmt.Sprintf("loc%d", idx), list: "enter"}, "one", taps[:1])
+	}
+	programs.RLock()
+	defer programs.RUnlock()
+	if got := len(programs.lists); got > kMaxCachedLists {
+		t.Errorf("compileList() cached %d lists, want at most %d", got, kMaxCachedLists)
+	}
+}
@@ -0,0 +1,102 @@
+package story
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kingofmen/cyoa-exploratory/logic"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+// ActionConditions returns the actions possible in the location,
+// with their conditions: first the location's own, then those of
+// its regions, then the story's global actions. If an action is
+// listed more than once, only its first condition counts.
+func ActionConditions(str *storypb.Story, loc *storypb.Location) []*storypb.ActionCondition {
+	offs := offers(str, loc)
+	ret := make([]*storypb.ActionCondition, 0, len(offs))
+	for _, off := range offs {
+		ret = append(ret, off.ActionCondition)
+	}
+	return ret
+}
+
+// offer is an action condition with its compiled program, if any.
+type offer struct {
+	*storypb.ActionCondition
+	prog logic.Program
+}
+
+// eval evaluates the condition, with its program if it has one.
+func (o offer) eval(lookup logic.Lookup) (bool, error) {
+	if o.prog != nil {
+		return o.prog.Eval(lookup)
+	}
+	return logic.Eval(o.GetCondition(), lookup)
+}
+
+// offers returns the ActionConditions with their programs.
+func offers(str *storypb.Story, loc *storypb.Location) []offer {
+	regions := make(map[string]*storypb.Region, len(str.GetRegions()))
+	for _, reg := range str.GetRegions() {
+		regions[reg.GetId()] = reg
+	}
+	type source struct {
+		conds []*storypb.ActionCondition
+		progs []logic.Program
+	}
+	sources := []source{{
+		conds: loc.GetPossibleActions(),
+		progs: compileList(listKey{owner: loc.GetId(), list: "actions"}, loc.GetRevision(), loc.GetPossibleActions()),
+	}}
+	for _, rid := range loc.GetRegionIds() {
+		conds := regions[rid].GetPossibleActions()
+		sources = append(sources, source{
+			conds: conds,
+			progs: compileList(listKey{story: str.GetId(), owner: rid, list: "actions"}, str.GetRevision(), conds),
+		})
+	}
+	sources = append(sources, source{
+		conds: str.GetGlobalActions(),
+		progs: compileList(listKey{story: str.GetId(), list: "actions"}, str.GetRevision(), str.GetGlobalActions()),
+	})
+
+	seen := make(map[string]bool)
+	ret := make([]offer, 0, len(loc.GetPossibleActions()))
+	for _, src := range sources {
+		for idx, pact := range src.conds {
+			if aid := pact.GetActionId(); !seen[aid] {
+				seen[aid] = true
+				off := offer{ActionCondition: pact}
+				if idx < len(src.progs) {
+					off.prog = src.progs[idx]
+				}
+				ret = append(ret, off)
+			}
+		}
+	}
+	return ret
+}
+
+// CheckRegions returns an error if the story's regions do not have
+// unique IDs or the locations name regions that do not exist.
+func CheckRegions(str *storypb.Story, locs []*storypb.Location) error {
+	var errs []error
+	rids := make(map[string]bool)
+	for idx, reg := range str.GetRegions() {
+		rid := reg.GetId()
+		if len(rid) == 0 || rids[rid] {
+			errs = append(errs, fmt.Errorf("region %d (%s) has missing or duplicate ID %q", idx, reg.GetTitle(), rid))
+		}
+		rids[rid] = true
+	}
+	for _, loc := range locs {
+		for _, rid := range loc.GetRegionIds() {
+			if !rids[rid] {
+				errs = append(errs, fmt.Errorf("location %q is in unknown region %q", loc.GetTitle(), rid))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
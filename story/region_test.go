@@ -0,0 +1,168 @@
+package story
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kingofmen/cyoa-exploratory/logic"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+func TestRegionActions(t *testing.T) {
+	cond := func(aid, text string) *storypb.ActionCondition {
+		ac := &storypb.ActionCondition{ActionId: proto.String(aid)}
+		if len(text) > 0 {
+			pred, err := logic.Parse(text)
+			if err != nil {
+				t.Fatalf("Parse(%q) => %v, want nil", text, err)
+			}
+			ac.Condition = pred
+		}
+		return ac
+	}
+	act := func(aid string) *storypb.Action {
+		return &storypb.Action{Id: proto.String(aid), Title: proto.String(aid)}
+	}
+	// The revisions make the conditions compile.
+	str := &storypb.Story{
+		Id:       proto.Int64(1),
+		Revision: proto.String("1"),
+		GlobalActions: []*storypb.ActionCondition{
+			cond("rest", ""),
+			cond("pray", "faith > 0"),
+			cond("look", ""),
+		},
+		Regions: []*storypb.Region{
+			&storypb.Region{
+				Id:              proto.String("forest"),
+				PossibleActions: []*storypb.ActionCondition{cond("forage", ""), cond("rest", "1 > 2")},
+			},
+		},
+	}
+	glade := &storypb.Location{
+		Id:              proto.String("glade"),
+		Revision:        proto.String("1"),
+		RegionIds:       []string{"forest"},
+		PossibleActions: []*storypb.ActionCondition{cond("look", "")},
+	}
+	town := &storypb.Location{Id: proto.String("town")}
+	candidates := []*storypb.Action{act("rest"), act("pray"), act("look"), act("forage")}
+
+	cases := []struct {
+		desc string
+		loc  *storypb.Location
+		vals map[string]int64
+		want []string
+	}{
+		{
+			desc: "Global only",
+			loc:  town,
+			want: []string{"rest", "look"},
+		},
+		{
+			desc: "Global with condition",
+			loc:  town,
+			vals: map[string]int64{"faith": 1},
+			want: []string{"rest", "pray", "look"},
+		},
+		{
+			desc: "Region overrides global",
+			loc:  glade,
+			want: []string{"look", "forage"},
+		},
+	}
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			evt := &storypb.GameEvent{
+				Story:            str,
+				Location:         cc.loc,
+				Values:           cc.vals,
+				CandidateActions: candidates,
+			}
+			var got []string
+			for _, act := range PossibleActions(evt) {
+				got = append(got, act.GetId())
+			}
+			if diff := cmp.Diff(cc.want, got); diff != "" {
+				t.Errorf("%s: PossibleActions() => %v, want %v: %s", cc.desc, got, cc.want, diff)
+			}
+		})
+	}
+
+	evt := &storypb.GameEvent{Story: str, Location: glade, PlayerAction: act("forage")}
+	if _, err := HandleEvent(evt, NewStaticResolver(nil, nil)); err != nil {
+		t.Errorf("HandleEvent(forage) => %v, want nil", err)
+	}
+	evt.PlayerAction = act("rest")
+	if _, err := HandleEvent(evt, NewStaticResolver(nil, nil)); err == nil {
+		t.Errorf("HandleEvent(rest) => nil, want error from the region's condition")
+	}
+}
+
+func TestCheckRegions(t *testing.T) {
+	str := &storypb.Story{
+		Regions: []*storypb.Region{&storypb.Region{Id: proto.String("forest")}},
+	}
+	good := &storypb.Location{Id: proto.String("glade"), RegionIds: []string{"forest"}}
+	if err := CheckRegions(str, []*storypb.Location{good}); err != nil {
+		t.Errorf("CheckRegions(forest) => %v, want nil", err)
+	}
+	bad := &storypb.Location{Id: proto.String("beach"), RegionIds: []string{"coast"}}
+	if err := CheckRegions(str, []*storypb.Location{bad}); err == nil {
+		t.Errorf("CheckRegions(coast) => nil, want error")
+	}
+	str.Regions = append(str.Regions, &storypb.Region{Id: proto.String("forest")})
+	if err := CheckRegions(str, nil); err == nil {
+		t.Errorf("CheckRegions(duplicate) => nil, want error")
+	}
+}
+
+func TestDisabledChoices(t *testing.T) {
+	pred, err := logic.Parse("all(inv.lockpick > 0, class == 'rogue')")
+	if err != nil {
+		t.Fatalf("Parse() => %v, want nil", err)
+	}
+	pick := &storypb.Action{Id: proto.String("pick")}
+	bash := &storypb.Action{Id: proto.String("bash")}
+	sneak := &storypb.Action{Id: proto.String("sneak")}
+	loc := &storypb.Location{
+		Id: proto.String("door"),
+		PossibleActions: []*storypb.ActionCondition{
+			&storypb.ActionCondition{ActionId: proto.String("pick"), Condition: pred, ShowDisabled: proto.Bool(true)},
+			&storypb.ActionCondition{ActionId: proto.String("bash"), Condition: pred, ShowDisabled: proto.Bool(true), DisabledHint: proto.String("You are too weak.")},
+			&storypb.ActionCondition{ActionId: proto.String("sneak"), Condition: pred},
+		},
+	}
+	evt := &storypb.GameEvent{
+		Location:         loc,
+		Strings:          map[string]string{"class": "rogue"},
+		CandidateActions: []*storypb.Action{pick, bash, sneak},
+	}
+	want := []*Choice{
+		&Choice{Action: pick, Reason: "Requires inv.lockpick > 0."},
+		&Choice{Action: bash, Reason: "You are too weak."},
+	}
+	if diff := cmp.Diff(want, Choices(evt), protocmp.Transform()); diff != "" {
+		t.Errorf("Choices() => diff %s", diff)
+	}
+	if got := PossibleActions(evt); len(got) != 0 {
+		t.Errorf("PossibleActions() => %v, want none", got)
+	}
+	// Authors see the hidden action too.
+	traces := Traces(evt)
+	if len(traces) != 3 {
+		t.Fatalf("Traces() => %d traces, want 3", len(traces))
+	}
+	if got := traces[2]; got.GetActionId() != "sneak" || got.GetPassed() || !strings.Contains(got.GetTrace(), "inv.lockpick > 0") {
+		t.Errorf("Traces() => %s, want failed trace of sneak", prototext.Format(got))
+	}
+	evt.PlayerAction = pick
+	if _, err := HandleEvent(evt, NewStaticResolver(nil, nil)); err == nil {
+		t.Errorf("HandleEvent(disabled action) => nil, want error")
+	}
+}
@@ -0,0 +1,55 @@
+package story
+
+import (
+	"fmt"
+
+	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
+)
+
+// Resolver looks up story content by ID, so that the engine can
+// follow the player into locations the event does not hold.
+type Resolver interface {
+	Location(id string) (*storypb.Location, error)
+	Actions(ids ...string) ([]*storypb.Action, error)
+}
+
+// StaticResolver implements Resolver over content held in memory.
+type StaticResolver struct {
+	locations map[string]*storypb.Location
+	actions   map[string]*storypb.Action
+}
+
+// NewStaticResolver returns a resolver over the given content.
+func NewStaticResolver(locs []*storypb.Location, acts []*storypb.Action) *StaticResolver {
+	sr := &StaticResolver{
+		locations: make(map[string]*storypb.Location, len(locs)),
+		actions:   make(map[string]*storypb.Action, len(acts)),
+	}
+	for _, loc := range locs {
+		sr.locations[loc.GetId()] = loc
+	}
+	for _, act := range acts {
+		sr.actions[act.GetId()] = act
+	}
+	return sr
+}
+
+func (sr *StaticResolver) Location(id string) (*storypb.Location, error) {
+	loc, ok := sr.locations[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown location %q", id)
+	}
+	return loc, nil
+}
+
+func (sr *StaticResolver) Actions(ids ...string) ([]*storypb.Action, error) {
+	ret := make([]*storypb.Action, 0, len(ids))
+	for _, id := range ids {
+		act, ok := sr.actions[id]
+		if !ok {
+			return nil, fmt.Errorf("unknown action %q", id)
+		}
+		ret = append(ret, act)
+	}
+	return ret, nil
+}
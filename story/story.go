@@ -2,8 +2,13 @@
 package story
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"slices"
+	"strings"
 
 	"github.com/kingofmen/cyoa-exploratory/logic"
 	"google.golang.org/protobuf/proto"
@@ -11,27 +16,114 @@ import (
 	storypb "github.com/kingofmen/cyoa-exploratory/story/proto"
 )
 
-// gameState implements logic.Lookup with a GameEvent as its scope.
+// Verbose enables logging of the evaluation trace of every
+// action condition that hides an action.
+var Verbose = false
+
+// gameState implements logic.Lookup with a GameEvent as its scope,
+// and logic.Roller with dice seeded from the event.
 type gameState struct {
-	game *storypb.GameEvent
+	game   *storypb.GameEvent
+	roller *logic.RandRoller
+}
+
+// newGameState returns a lookup on the event whose dice are
+// seeded from it.
+func newGameState(event *storypb.GameEvent) *gameState {
+	return &gameState{
+		game:   event,
+		roller: logic.NewRandRoller(event.GetSeed()),
+	}
+}
+
+// forAction returns a lookup on the same event whose dice are seeded
+// from the event and the action, so that the action's condition rolls
+// the same dice however many other conditions were evaluated first.
+func (g *gameState) forAction(aid string) *gameState {
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, g.game.GetSeed())
+	h.Write([]byte(aid))
+	return &gameState{
+		game:   g.game,
+		roller: logic.NewRandRoller(int64(h.Sum64())),
+	}
+}
+
+func (g *gameState) Roll(sides int64) (int64, error) {
+	if g == nil || g.roller == nil {
+		return 0, fmt.Errorf("game state has no dice")
+	}
+	return g.roller.Roll(sides)
+}
+
+// declared returns the declaration of the variable, checking its
+// type, or nil if the story declares no variables at all.
+func (g *gameState) declared(key string, vt storypb.Variable_Type) (*storypb.Variable, error) {
+	// Stories without declarations treat every unset key as empty.
+	if len(g.game.GetStory().GetVariables()) == 0 {
+		return nil, nil
+	}
+	decl := declaration(g.game.GetStory(), key)
+	if decl == nil {
+		return nil, fmt.Errorf("undeclared variable %q", key)
+	}
+	if decl.GetType() != vt {
+		return nil, fmt.Errorf("variable %q has type %v, used as %v", key, decl.GetType(), varTypes[vt])
+	}
+	return decl, nil
 }
 
 func (g *gameState) GetInt(key string) (int64, error) {
 	if g == nil || g.game == nil {
 		return 0, fmt.Errorf("game state not initialized")
 	}
-	return g.game.Values[key], nil
+	if val, ok := g.game.Values[key]; ok {
+		return val, nil
+	}
+	decl, err := g.declared(key, storypb.Variable_VT_INT)
+	if err != nil {
+		return 0, err
+	}
+	return decl.GetDefaultInt(), nil
 }
 
 func (g *gameState) GetStr(key string) (string, error) {
-	return "", fmt.Errorf("strings are not implemented")
+	if g == nil || g.game == nil {
+		return "", fmt.Errorf("game state not initialized")
+	}
+	if val, ok := g.game.Strings[key]; ok {
+		return val, nil
+	}
+	decl, err := g.declared(key, storypb.Variable_VT_STRING)
+	if err != nil {
+		return "", err
+	}
+	return decl.GetDefaultStr(), nil
 }
 
 func (g *gameState) GetStrArr(key string) ([]string, error) {
-	return nil, fmt.Errorf("strings are not implemented")
+	if g == nil || g.game == nil {
+		return nil, fmt.Errorf("game state not initialized")
+	}
+	if val, ok := g.game.Lists[key]; ok {
+		return val.GetValues(), nil
+	}
+	decl, err := g.declared(key, storypb.Variable_VT_STRING_ARRAY)
+	if err != nil {
+		return nil, err
+	}
+	return decl.GetDefaultStrs(), nil
 }
 
 func (g *gameState) GetScope(key string) logic.Lookup {
+	switch key {
+	case InventoryScope:
+		return &inventory{game: g.game}
+	case CharacterScope:
+		return &character{char: g.game.GetCharacter()}
+	case GameScope:
+		return &clock{game: g.game}
+	}
 	return g
 }
 
@@ -40,103 +132,479 @@ func (g *gameState) ListScopes() []string {
 	return []string{}
 }
 
+// varTypes maps declared variable types to their logic equivalents.
+var varTypes = map[storypb.Variable_Type]logic.VarType{
+	storypb.Variable_VT_INT:          logic.IntVar,
+	storypb.Variable_VT_STRING:       logic.StrVar,
+	storypb.Variable_VT_STRING_ARRAY: logic.StrArrVar,
+}
+
+// declaration returns the story's declaration of the variable, if any.
+func declaration(str *storypb.Story, name string) *storypb.Variable {
+	for _, decl := range str.GetVariables() {
+		if decl.GetName() == name {
+			return decl
+		}
+	}
+	return nil
+}
+
+// checkChoice returns an error if the string variable is declared
+// with choices which do not include the value.
+func checkChoice(str *storypb.Story, name, val string) error {
+	if ch := declaration(str, name).GetChoices(); len(ch) > 0 && !slices.Contains(ch, val) {
+		return fmt.Errorf("%q is not one of the choices %q for %q", val, ch, name)
+	}
+	return nil
+}
+
+// CheckChoices returns an error if the trigger sets a string
+// variable to a literal outside its declared choices. Values from
+// other variables are checked when the trigger runs.
+func CheckChoices(tap *storypb.TriggerAction, str *storypb.Story) error {
+	var errs []error
+	for idx, eff := range tap.GetEffects() {
+		for sidx, st := range eff.GetStringTweaks() {
+			val, ok := strings.CutPrefix(st.GetValue(), "'")
+			if !ok || st.GetOperation() != storypb.StringTweak_ST_SET {
+				continue
+			}
+			if err := checkChoice(str, st.GetKey(), val); err != nil {
+				errs = append(errs, fmt.Errorf("effect %d string tweak %d: %w", idx, sidx, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// bounded returns the value limited to the bounds declared for the
+// integer variable, if any.
+func bounded(str *storypb.Story, name string, val int64) int64 {
+	decl := declaration(str, name)
+	if decl == nil {
+		return val
+	}
+	if decl.Min != nil {
+		val = max(val, decl.GetMin())
+	}
+	if decl.Max != nil {
+		val = min(val, decl.GetMax())
+	}
+	return val
+}
+
+// validName returns true if the name can be used as a key in
+// predicates, rather than being read as a literal or expression.
+func validName(name string) bool {
+	return len(name) > 0 && !strings.ContainsAny(name, ".'[] \t+*/%(),") && !strings.HasPrefix(name, "-")
+}
+
+// Schema returns the variables declared by the story, or an error
+// if the declarations are inconsistent.
+func Schema(str *storypb.Story) (*logic.Schema, error) {
+	schema := logic.NewSchema()
+	seen := make(map[string]bool)
+	for idx, decl := range str.GetVariables() {
+		name := decl.GetName()
+		if !validName(name) {
+			return nil, fmt.Errorf("variable %d has invalid name %q", idx, name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("variable %q declared twice", name)
+		}
+		seen[name] = true
+		vt, ok := varTypes[decl.GetType()]
+		if !ok {
+			return nil, fmt.Errorf("variable %q has unknown type %v", name, decl.GetType())
+		}
+		if decl.Min != nil && decl.Max != nil && decl.GetMin() > decl.GetMax() {
+			return nil, fmt.Errorf("variable %q has minimum %d above maximum %d", name, decl.GetMin(), decl.GetMax())
+		}
+		if len(decl.GetInitialExpr()) > 0 && decl.GetType() != storypb.Variable_VT_INT {
+			return nil, fmt.Errorf("variable %q has type %v but an initial expression", name, vt)
+		}
+		if def := decl.GetDefaultInt(); (decl.Min != nil && def < decl.GetMin()) || (decl.Max != nil && def > decl.GetMax()) {
+			return nil, fmt.Errorf("variable %q has default %d outside its bounds", name, def)
+		}
+		if ch := decl.GetChoices(); len(ch) > 0 {
+			if decl.GetType() != storypb.Variable_VT_STRING {
+				return nil, fmt.Errorf("variable %q has type %v but choices", name, vt)
+			}
+			if !slices.Contains(ch, decl.GetDefaultStr()) {
+				return nil, fmt.Errorf("variable %q has default %q outside its choices", name, decl.GetDefaultStr())
+			}
+		}
+		schema.WithVar(name, vt)
+	}
+	return schema, nil
+}
+
+// CheckTrigger returns an error if the trigger's condition or
+// effects do not match the schema.
+func CheckTrigger(tap *storypb.TriggerAction, schema *logic.Schema) error {
+	errs := []error{logic.Check(tap.GetCondition(), schema)}
+	for idx, eff := range tap.GetEffects() {
+		if err := checkOps(eff.GetOps(), schema); err != nil {
+			errs = append(errs, fmt.Errorf("effect %d: %w", idx, err))
+		}
+		if ex := eff.GetTweakExpr(); len(ex) > 0 {
+			if err := logic.CheckInt(ex, schema); err != nil {
+				errs = append(errs, fmt.Errorf("effect %d: %w", idx, err))
+			}
+		}
+		if key := eff.GetTweakValue(); len(key) > 0 {
+			vt, err := schema.Lookup(key)
+			if err == nil && vt != logic.IntVar && vt != logic.AnyVar {
+				err = fmt.Errorf("%q has type %v, tweaked as integer", key, vt)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("effect %d: %w", idx, err))
+			}
+		}
+		for iidx, it := range eff.GetItemTweaks() {
+			if _, err := schema.Lookup(InventoryScope + "." + it.GetItemId()); err != nil {
+				errs = append(errs, fmt.Errorf("effect %d item tweak %d: %w", idx, iidx, err))
+			}
+		}
+		for sidx, st := range eff.GetStringTweaks() {
+			want := logic.StrArrVar
+			if st.GetOperation() == storypb.StringTweak_ST_SET {
+				want = logic.StrVar
+			}
+			key := st.GetKey()
+			vt, err := schema.Lookup(key)
+			if err == nil && vt != want && vt != logic.AnyVar {
+				err = fmt.Errorf("%q has type %v, tweaked as %v", key, vt, want)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("effect %d string tweak %d: %w", idx, sidx, err))
+			}
+			if err := logic.CheckStr(st.GetValue(), schema); err != nil {
+				errs = append(errs, fmt.Errorf("effect %d string tweak %d: %w", idx, sidx, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NotAllowedError reports that the player chose an action which is
+// not available to them, as opposed to a fault in the story.
+type NotAllowedError struct {
+	Reason error
+}
+
+func (e *NotAllowedError) Error() string {
+	return e.Reason.Error()
+}
+
+func (e *NotAllowedError) Unwrap() error {
+	return e.Reason
+}
+
 // allowed returns an error if the action is not available in the location.
-func allowed(act *storypb.Action, loc *storypb.Location, state logic.Lookup) error {
-	for _, cand := range loc.GetPossibleActions() {
+func allowed(act *storypb.Action, str *storypb.Story, loc *storypb.Location, state *gameState) error {
+	for _, cand := range offers(str, loc) {
 		if cand.GetActionId() != act.GetId() {
 			continue
 		}
-		ok, err := logic.Eval(cand.GetCondition(), state)
+		ok, err := cand.eval(state.forAction(act.GetId()))
 		if err != nil {
 			return fmt.Errorf("could not evaluate condition: %w", err)
 		}
 		if !ok {
-			return fmt.Errorf("condition fails")
+			trace := logic.Explain(cand.GetCondition(), state.forAction(act.GetId()))
+			return &NotAllowedError{Reason: fmt.Errorf("condition fails:\n%s", trace)}
+		}
+		return nil
+	}
+	return &NotAllowedError{Reason: fmt.Errorf("action ID %s not in possible-actions list", act.GetId())}
+}
+
+// tweakString changes the string or string-array variable by the
+// already-evaluated value.
+func tweakString(st *storypb.StringTweak, val string, nState *storypb.GameEvent, state logic.Lookup) error {
+	key := st.GetKey()
+	if st.GetOperation() == storypb.StringTweak_ST_SET {
+		if nState.Strings == nil {
+			nState.Strings = make(map[string]string)
 		}
+		nState.Strings[key] = val
 		return nil
 	}
-	return fmt.Errorf("action ID %s not in possible-actions list", act.GetId())
+	cur, err := state.GetStrArr(key)
+	if err != nil {
+		return err
+	}
+	list := slices.Clone(cur)
+	switch op := st.GetOperation(); op {
+	case storypb.StringTweak_ST_APPEND:
+		list = append(list, val)
+	case storypb.StringTweak_ST_REMOVE:
+		list = slices.DeleteFunc(list, func(s string) bool { return s == val })
+	default:
+		return fmt.Errorf("unknown string operation %v", op)
+	}
+	if nState.Lists == nil {
+		nState.Lists = make(map[string]*storypb.StringList)
+	}
+	nState.Lists[key] = &storypb.StringList{Values: list}
+	return nil
 }
 
 // apply sets the new state of the playthrough according to the effect.
-func apply(eff *storypb.Effect, nState *storypb.GameEvent) {
+// If the effect's amounts or values cannot be evaluated, nothing is
+// changed.
+func apply(eff *storypb.Effect, nState *storypb.GameEvent, state *gameState) error {
+	var vars *storypb.GameEvent
+	if len(eff.GetOps()) > 0 {
+		var err error
+		if vars, err = runOps(eff.GetOps(), state); err != nil {
+			return err
+		}
+	}
+	amount := eff.GetTweakAmount()
+	if ex := eff.GetTweakExpr(); len(ex) > 0 {
+		val, err := logic.EvalInt(ex, state)
+		if err != nil {
+			return fmt.Errorf("could not evaluate amount for %q: %w", eff.GetTweakValue(), err)
+		}
+		amount = val
+	}
+	strs := make([]string, len(eff.GetStringTweaks()))
+	for idx, st := range eff.GetStringTweaks() {
+		val, err := logic.EvalStr(st.GetValue(), state)
+		if err != nil {
+			return fmt.Errorf("could not evaluate value for %q: %w", st.GetKey(), err)
+		}
+		strs[idx] = val
+		if st.GetOperation() == storypb.StringTweak_ST_SET {
+			if _, err = state.GetStr(st.GetKey()); err == nil {
+				err = checkChoice(nState.GetStory(), st.GetKey(), val)
+			}
+		} else {
+			_, err = state.GetStrArr(st.GetKey())
+		}
+		if err != nil {
+			return fmt.Errorf("cannot tweak %q: %w", st.GetKey(), err)
+		}
+	}
+	inv := nState.GetInventory()
+	for _, it := range eff.GetItemTweaks() {
+		var err error
+		if inv, err = tweakInventory(inv, nState.GetItems(), it); err != nil {
+			return err
+		}
+	}
+	if vars != nil {
+		nState.Values, nState.Strings, nState.Lists = vars.GetValues(), vars.GetStrings(), vars.GetLists()
+	}
 	if nl := eff.GetNewLocationId(); len(nl) > 0 {
 		nState.Location = &storypb.Location{
 			Id: proto.String(nl),
 		}
 	}
-	if k, v := eff.GetTweakValue(), eff.GetTweakAmount(); len(k) > 0 && v != 0 {
+	if k, v := eff.GetTweakValue(), amount; len(k) > 0 && v != 0 {
 		if len(nState.Values) == 0 {
 			nState.Values = make(map[string]int64)
 		}
-		nState.Values[k] += v
+		nState.Values[k] = bounded(nState.GetStory(), k, nState.Values[k]+v)
+	}
+	if len(eff.GetItemTweaks()) > 0 {
+		nState.Inventory = inv
+	}
+	for idx, st := range eff.GetStringTweaks() {
+		if err := tweakString(st, strs[idx], nState, state); err != nil {
+			return fmt.Errorf("could not tweak %q: %w", st.GetKey(), err)
+		}
 	}
 	if ns := eff.GetNewState(); ns != storypb.RunState_RS_UNKNOWN {
 		nState.State = ns.Enum()
 	}
 	nState.Effects = append(nState.Effects, eff.GetDescription())
+	return nil
 }
 
-func HandleEvent(event *storypb.GameEvent) (*storypb.GameEvent, error) {
-	nState := proto.Clone(event).(*storypb.GameEvent)
-	act, loc, str := event.GetPlayerAction(), event.GetLocation(), event.GetStory()
-	aid, lid, sid := act.GetId(), loc.GetId(), str.GetId()
-	state := &gameState{game: nState}
-	if err := allowed(act, loc, state); err != nil {
-		return nil, fmt.Errorf("action %s (%s) not available in location %s (%s): %w", aid, act.GetTitle(), lid, loc.GetTitle(), err)
-	}
-
-	for idx, tap := range act.GetTriggers() {
-		trigger, err := logic.Eval(tap.GetCondition(), state)
+// runTriggers applies the effects of every trigger whose condition
+// holds, stopping after the first final one. The programs are those
+// of compileList for the triggers. Errors are logged against where,
+// which describes the source of the triggers.
+func runTriggers(taps []*storypb.TriggerAction, progs []logic.Program, nState *storypb.GameEvent, state *gameState, where string) {
+	for idx, tap := range taps {
+		trigger, err := evalAt(progs, idx, tap.GetCondition(), state)
 		if err != nil {
-			log.Printf("Could not evaluate predicate for trigger %d in action %s (%q) of story %d (%q): %v", idx, aid, act.GetTitle(), sid, str.GetTitle(), err)
+			// TODO: Escalate this in some manner.
+			log.Printf("Could not evaluate predicate for trigger %d in %s: %v", idx, where, err)
 			continue
 		}
 		if !trigger {
 			continue
 		}
-		for _, effect := range tap.GetEffects() {
-			apply(effect, nState)
+		for eidx, effect := range tap.GetEffects() {
+			if err := apply(effect, nState, state); err != nil {
+				log.Printf("Could not apply effect %d of trigger %d in %s: %v", eidx, idx, where, err)
+			}
 		}
 		if tap.GetIsFinal() {
 			break
 		}
 	}
+}
 
-	for idx, tap := range str.GetEvents() {
-		trigger, err := logic.Eval(tap.GetCondition(), state)
-		if err != nil {
-			// TODO: Escalate this in some manner.
-			log.Printf("Could not evaluate predicate for TAP %d in story %d (%q): %v", idx, sid, str.GetTitle(), err)
-			continue
+// kMaxMoves is the most location changes one turn may cause, so
+// that entry triggers which move the player cannot loop forever.
+const kMaxMoves = 20
+
+// travel runs the exit triggers of from and the entry triggers of
+// the new location for as long as the effects keep moving the
+// player. The destination and its candidate actions are loaded from
+// the resolver into the new state. A nil from means the player is
+// arriving without leaving anywhere.
+func travel(from *storypb.Location, nState *storypb.GameEvent, state *gameState, res Resolver) error {
+	sid, title := nState.GetStory().GetId(), nState.GetStory().GetTitle()
+	moves := 0
+	for ; nState.GetLocation().GetId() != from.GetId(); moves++ {
+		if moves >= kMaxMoves {
+			return fmt.Errorf("more than %d moves in one turn, last from %s (%s) to %s", kMaxMoves, from.GetId(), from.GetTitle(), nState.GetLocation().GetId())
 		}
-		if !trigger {
-			continue
+		if from != nil {
+			exits := compileList(listKey{owner: from.GetId(), list: "exit"}, from.GetRevision(), from.GetOnExit())
+			runTriggers(from.GetOnExit(), exits, nState, state, fmt.Sprintf("exit from location %s (%q) of story %d (%q)", from.GetId(), from.GetTitle(), sid, title))
 		}
-		for _, effect := range tap.GetEffects() {
-			apply(effect, nState)
+		lid := nState.GetLocation().GetId()
+		to, err := res.Location(lid)
+		if err != nil {
+			return fmt.Errorf("could not load location %s: %w", lid, err)
 		}
-		if tap.GetIsFinal() {
-			break
+		nState.Location = to
+		entries := compileList(listKey{owner: lid, list: "enter"}, to.GetRevision(), to.GetOnEnter())
+		runTriggers(to.GetOnEnter(), entries, nState, state, fmt.Sprintf("entry to location %s (%q) of story %d (%q)", lid, to.GetTitle(), sid, title))
+		from = to
+	}
+	if moves == 0 {
+		return nil
+	}
+	loc := nState.GetLocation()
+	pacts := ActionConditions(nState.GetStory(), loc)
+	aids := make([]string, 0, len(pacts))
+	for _, pact := range pacts {
+		aids = append(aids, pact.GetActionId())
+	}
+	acts, err := res.Actions(aids...)
+	if err != nil {
+		return fmt.Errorf("could not load candidate actions for location %s (%s): %w", loc.GetId(), loc.GetTitle(), err)
+	}
+	nState.CandidateActions = acts
+	return nil
+}
+
+// initialValues sets every variable the story declares to its
+// starting value.
+func initialValues(nState *storypb.GameEvent, state *gameState) error {
+	for _, decl := range nState.GetStory().GetVariables() {
+		name := decl.GetName()
+		switch decl.GetType() {
+		case storypb.Variable_VT_INT:
+			val := decl.GetDefaultInt()
+			if ex := decl.GetInitialExpr(); len(ex) > 0 {
+				var err error
+				if val, err = logic.EvalInt(ex, state); err != nil {
+					return fmt.Errorf("could not evaluate initial value of %q: %w", name, err)
+				}
+			}
+			if nState.Values == nil {
+				nState.Values = make(map[string]int64)
+			}
+			nState.Values[name] = bounded(nState.GetStory(), name, val)
+		case storypb.Variable_VT_STRING:
+			if nState.Strings == nil {
+				nState.Strings = make(map[string]string)
+			}
+			nState.Strings[name] = decl.GetDefaultStr()
+		case storypb.Variable_VT_STRING_ARRAY:
+			if nState.Lists == nil {
+				nState.Lists = make(map[string]*storypb.StringList)
+			}
+			nState.Lists[name] = &storypb.StringList{Values: slices.Clone(decl.GetDefaultStrs())}
+		}
+	}
+	return nil
+}
+
+// StartGame returns the opening state of a playthrough of the
+// event's story: declared variables take their initial values,
+// the story's on-start triggers run, and then the player enters
+// the start location.
+func StartGame(event *storypb.GameEvent, res Resolver) (*storypb.GameEvent, error) {
+	nState := proto.Clone(event).(*storypb.GameEvent)
+	str := nState.GetStory()
+	state := newGameState(nState)
+	if err := initialValues(nState, state); err != nil {
+		return nil, fmt.Errorf("could not start story %d (%q): %w", str.GetId(), str.GetTitle(), err)
+	}
+	starts := compileList(listKey{story: str.GetId(), list: "start"}, str.GetRevision(), str.GetOnStart())
+	runTriggers(str.GetOnStart(), starts, nState, state, fmt.Sprintf("start of story %d (%q)", str.GetId(), str.GetTitle()))
+	if len(nState.GetLocation().GetId()) > 0 {
+		if err := travel(nil, nState, state, res); err != nil {
+			return nil, fmt.Errorf("could not enter start location of story %d (%q): %w", str.GetId(), str.GetTitle(), err)
 		}
 	}
+	nState.Seed = proto.Int64(state.roller.NextSeed())
+	return nState, nil
+}
+
+// HandleEvent returns the state after the player takes the event's
+// action. If the player moves, the new location and its candidate
+// actions are loaded from the resolver.
+func HandleEvent(event *storypb.GameEvent, res Resolver) (*storypb.GameEvent, error) {
+	nState := proto.Clone(event).(*storypb.GameEvent)
+	act, loc, str := event.GetPlayerAction(), event.GetLocation(), event.GetStory()
+	aid, lid, sid := act.GetId(), loc.GetId(), str.GetId()
+	state := newGameState(nState)
+	if err := allowed(act, str, loc, state); err != nil {
+		return nil, fmt.Errorf("action %s (%s) not available in location %s (%s): %w", aid, act.GetTitle(), lid, loc.GetTitle(), err)
+	}
+	advanceClock(act, nState)
 
+	triggers := compileList(listKey{owner: aid, list: "triggers"}, act.GetRevision(), act.GetTriggers())
+	runTriggers(act.GetTriggers(), triggers, nState, state, fmt.Sprintf("action %s (%q) of story %d (%q)", aid, act.GetTitle(), sid, str.GetTitle()))
+	if err := travel(loc, nState, state, res); err != nil {
+		return nil, fmt.Errorf("action %s (%s) in location %s (%s): %w", aid, act.GetTitle(), lid, loc.GetTitle(), err)
+	}
+	here := nState.GetLocation()
+	events := compileList(listKey{story: sid, list: "events"}, str.GetRevision(), str.GetEvents())
+	runTriggers(str.GetEvents(), events, nState, state, fmt.Sprintf("events of story %d (%q)", sid, str.GetTitle()))
+	if err := travel(here, nState, state, res); err != nil {
+		return nil, fmt.Errorf("story events after action %s (%s): %w", aid, act.GetTitle(), err)
+	}
+
+	nState.Seed = proto.Int64(state.roller.NextSeed())
 	return nState, nil
 }
 
-// PossibleActions returns the actions of the current story location
-// that are possible given the rest of the game state.
-func PossibleActions(event *storypb.GameEvent) []*storypb.Action {
+// Choice is an action shown to the player, who can take it only if
+// it is enabled.
+type Choice struct {
+	Action  *storypb.Action
+	Enabled bool
+	// Reason explains why a disabled action cannot be taken.
+	Reason string
+}
+
+// Choices returns the actions of the current story location, its
+// regions and the story that are possible given the rest of the game
+// state, together with the impossible ones whose conditions ask for
+// them to be shown disabled.
+func Choices(event *storypb.GameEvent) []*Choice {
 	if event.GetState() == storypb.RunState_RS_COMPLETE {
 		return nil
 	}
-	state := &gameState{game: event}
-	pacts := event.GetLocation().GetPossibleActions()
+	state := newGameState(event)
+	pacts := offers(event.GetStory(), event.GetLocation())
 	actMap := make(map[string]*storypb.Action)
 	for _, act := range event.GetCandidateActions() {
 		actMap[act.GetId()] = act
 	}
-	ret := make([]*storypb.Action, 0, len(pacts))
+	ret := make([]*Choice, 0, len(pacts))
 	for idx, pact := range pacts {
 		pid := pact.GetActionId()
 		target, exists := actMap[pid]
@@ -144,15 +612,77 @@ func PossibleActions(event *storypb.GameEvent) []*storypb.Action {
 			log.Printf("Candidate action %q from location %q does not exist in event", pid, event.GetLocation().GetId())
 			continue
 		}
-		good, err := logic.Eval(pact.GetCondition(), state)
+		// Evaluate with the dice HandleEvent will roll; a failing
+		// condition is explained with the same dice, if anyone asks.
+		ok, err := pact.eval(state.forAction(pid))
 		if err != nil {
 			log.Printf("Could not evaluate predicate for possible action %d (%s: %s) in story %q: %v", idx, pid, target.GetTitle(), event.GetStory().GetTitle(), err)
 			continue
 		}
-		if !good {
+		if !ok {
+			if pact.GetShowDisabled() {
+				ret = append(ret, &Choice{Action: target, Reason: disabledReason(pact.ActionCondition, state.forAction(pid))})
+				continue
+			}
+			if Verbose {
+				log.Printf("Possible action %d (%s: %s) in location %q hidden:\n%s", idx, pid, target.GetTitle(), event.GetLocation().GetTitle(), logic.Explain(pact.GetCondition(), state.forAction(pid)))
+			}
 			continue
 		}
-		ret = append(ret, target)
+		ret = append(ret, &Choice{Action: target, Enabled: true})
+	}
+	return ret
+}
+
+// Traces returns the evaluation of the condition of every action
+// offered in the current location, hidden or not, with the dice
+// Choices and HandleEvent roll, so authors can see why actions are
+// missing.
+func Traces(event *storypb.GameEvent) []*storypb.ConditionTrace {
+	state := newGameState(event)
+	actMap := make(map[string]*storypb.Action)
+	for _, act := range event.GetCandidateActions() {
+		actMap[act.GetId()] = act
+	}
+	var ret []*storypb.ConditionTrace
+	for _, pact := range ActionConditions(event.GetStory(), event.GetLocation()) {
+		pid := pact.GetActionId()
+		target, exists := actMap[pid]
+		if !exists {
+			continue
+		}
+		trace := logic.Explain(pact.GetCondition(), state.forAction(pid))
+		ret = append(ret, &storypb.ConditionTrace{
+			ActionId: proto.String(pid),
+			Title:    proto.String(target.GetTitle()),
+			Passed:   proto.Bool(trace.Err == nil && trace.Result),
+			Trace:    proto.String(trace.String()),
+		})
+	}
+	return ret
+}
+
+// disabledReason returns the author's hint for the disabled action,
+// or else the comparisons of its condition which failed.
+func disabledReason(pact *storypb.ActionCondition, state *gameState) string {
+	if hint := pact.GetDisabledHint(); len(hint) > 0 {
+		return hint
+	}
+	fails := logic.Explain(pact.GetCondition(), state).Failures()
+	if len(fails) == 0 {
+		return "Not available."
+	}
+	return "Requires " + strings.Join(fails, "; ") + "."
+}
+
+// PossibleActions returns the enabled actions among the Choices.
+func PossibleActions(event *storypb.GameEvent) []*storypb.Action {
+	choices := Choices(event)
+	ret := make([]*storypb.Action, 0, len(choices))
+	for _, choice := range choices {
+		if choice.Enabled {
+			ret = append(ret, choice.Action)
+		}
 	}
 	return ret
 }
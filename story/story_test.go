@@ -1,12 +1,14 @@
 package story
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
+	"github.com/kingofmen/cyoa-exploratory/logic"
 	"google.golang.org/protobuf/encoding/prototext"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/testing/protocmp"
@@ -40,6 +42,7 @@ func TestHandleAction(t *testing.T) {
 			want: &storypb.GameEvent{
 				Location: loc1,
 				State:    storypb.RunState_RS_UNKNOWN.Enum(),
+				Turn:     proto.Int64(1),
 			},
 		},
 		{
@@ -59,6 +62,8 @@ func TestHandleAction(t *testing.T) {
 			want: &storypb.GameEvent{
 				Location: loc2,
 				State:    storypb.RunState_RS_UNKNOWN.Enum(),
+				Effects:  []string{""},
+				Turn:     proto.Int64(1),
 			},
 		},
 		{
@@ -92,10 +97,13 @@ func TestHandleAction(t *testing.T) {
 				Location: loc2,
 				Values:   map[string]int64{"strength": 10},
 				State:    storypb.RunState_RS_UNKNOWN.Enum(),
+				Effects:  []string{""},
+				Turn:     proto.Int64(1),
 			},
 		},
 	}
-	ignore := protocmp.IgnoreFields(&storypb.GameEvent{}, "player_action")
+	ignore := protocmp.IgnoreFields(&storypb.GameEvent{}, "player_action", "seed")
+	res := NewStaticResolver([]*storypb.Location{loc1, loc2}, nil)
 	for _, cc := range cases {
 		t.Run(cc.desc, func(t *testing.T) {
 			evt := &storypb.GameEvent{
@@ -105,7 +113,7 @@ func TestHandleAction(t *testing.T) {
 				State:        cc.game.GetState().Enum(),
 				Story:        cc.str,
 			}
-			got, err := HandleEvent(evt)
+			got, err := HandleEvent(evt, res)
 			if err != nil {
 				t.Errorf("%s: HandleAction() => %v, want nil", cc.desc, err)
 			}
@@ -144,10 +152,522 @@ func TestHandleActionSad(t *testing.T) {
 				State:        cc.game.GetState().Enum(),
 				Story:        cc.str,
 			}
-			_, err := HandleEvent(evt)
+			_, err := HandleEvent(evt, NewStaticResolver(nil, nil))
 			if got := fmt.Sprintf("%v", err); !strings.Contains(got, cc.want) {
 				t.Errorf("%s: HandleAction() => %v, want %q", cc.desc, err, cc.want)
 			}
+			var nerr *NotAllowedError
+			if !errors.As(err, &nerr) {
+				t.Errorf("%s: HandleAction() => %v, want NotAllowedError", cc.desc, err)
+			}
 		})
 	}
 }
+
+func TestDeclaredVariables(t *testing.T) {
+	str := &storypb.Story{
+		Variables: []*storypb.Variable{
+			&storypb.Variable{Name: proto.String("gold"), DefaultInt: proto.Int64(10)},
+			&storypb.Variable{Name: proto.String("class"), Type: storypb.Variable_VT_STRING.Enum()},
+		},
+	}
+	state := &gameState{game: &storypb.GameEvent{
+		Story:  str,
+		Values: map[string]int64{"silver": 3},
+	}}
+	if got, err := state.GetInt("gold"); err != nil || got != 10 {
+		t.Errorf("GetInt(gold) => %d, %v, want 10, nil", got, err)
+	}
+	if got, err := state.GetInt("silver"); err != nil || got != 3 {
+		t.Errorf("GetInt(silver) => %d, %v, want 3, nil", got, err)
+	}
+	if _, err := state.GetInt("class"); err == nil {
+		t.Errorf("GetInt(class) => nil error, want type mismatch")
+	}
+	if _, err := state.GetInt("glod"); err == nil {
+		t.Errorf("GetInt(glod) => nil error, want undeclared variable")
+	}
+
+	if _, err := Schema(str); err != nil {
+		t.Errorf("Schema() => %v, want nil", err)
+	}
+	bad := []*storypb.Story{
+		&storypb.Story{Variables: []*storypb.Variable{
+			&storypb.Variable{Name: proto.String("gold")},
+			&storypb.Variable{Name: proto.String("gold")},
+		}},
+		&storypb.Story{Variables: []*storypb.Variable{
+			&storypb.Variable{Name: proto.String("ogre.strength")},
+		}},
+		&storypb.Story{Variables: []*storypb.Variable{
+			&storypb.Variable{Name: proto.String("hp"), Min: proto.Int64(1), Max: proto.Int64(10)},
+		}},
+		&storypb.Story{Variables: []*storypb.Variable{
+			&storypb.Variable{Name: proto.String("mood"), Type: storypb.Variable_VT_STRING.Enum(), DefaultStr: proto.String("sleepy"), Choices: []string{"calm", "angry"}},
+		}},
+		&storypb.Story{Variables: []*storypb.Variable{
+			&storypb.Variable{Name: proto.String("gold"), Choices: []string{"1", "2"}},
+		}},
+	}
+	for idx, str := range bad {
+		if _, err := Schema(str); err == nil {
+			t.Errorf("Schema(%d) => nil, want error", idx)
+		}
+	}
+}
+
+func TestCheckChoices(t *testing.T) {
+	str := &storypb.Story{
+		Variables: []*storypb.Variable{
+			&storypb.Variable{Name: proto.String("mood"), Type: storypb.Variable_VT_STRING.Enum(), DefaultStr: proto.String("calm"), Choices: []string{"calm", "angry"}},
+		},
+	}
+	set := func(val string) *storypb.TriggerAction {
+		return &storypb.TriggerAction{Effects: []*storypb.Effect{&storypb.Effect{StringTweaks: []*storypb.StringTweak{
+			&storypb.StringTweak{Key: proto.String("mood"), Operation: storypb.StringTweak_ST_SET.Enum(), Value: proto.String(val)},
+		}}}}
+	}
+	for val, ok := range map[string]bool{"'angry": true, "'sleepy": false, "name": true} {
+		if err := CheckChoices(set(val), str); (err == nil) != ok {
+			t.Errorf("CheckChoices(%s) => %v, want ok %v", val, err, ok)
+		}
+	}
+
+	// Copies are checked when they run.
+	for val, ok := range map[string]bool{"angry": true, "sleepy": false} {
+		nState := &storypb.GameEvent{Story: str, Strings: map[string]string{"feeling": val}}
+		eff := &storypb.Effect{Ops: []*storypb.VariableOp{
+			&storypb.VariableOp{Key: proto.String("mood"), Op: &storypb.VariableOp_CopyFrom{CopyFrom: "feeling"}},
+		}}
+		if err := apply(eff, nState, newGameState(nState)); (err == nil) != ok {
+			t.Errorf("copying %q into mood => %v, want ok %v", val, err, ok)
+		}
+	}
+}
+
+func TestRandomEffects(t *testing.T) {
+	uuid1 := uuid.New().String()
+	act := &storypb.Action{
+		Id: proto.String(uuid1),
+		Triggers: []*storypb.TriggerAction{
+			&storypb.TriggerAction{
+				Condition: &lpb.Predicate{
+					Test: &lpb.Predicate_Comp{
+						Comp: &lpb.Compare{
+							KeyOne:    proto.String("1d100"),
+							KeyTwo:    proto.String("60"),
+							Operation: lpb.Compare_CMP_LTE.Enum(),
+						},
+					},
+				},
+				Effects: []*storypb.Effect{
+					&storypb.Effect{
+						TweakValue: proto.String("gold"),
+						TweakExpr:  proto.String("2d6 + bonus"),
+					},
+				},
+			},
+		},
+	}
+	loc := &storypb.Location{
+		Id:              proto.String(uuid1),
+		PossibleActions: []*storypb.ActionCondition{&storypb.ActionCondition{ActionId: proto.String(uuid1)}},
+	}
+
+	successes := 0
+	for seed := int64(0); seed < 100; seed++ {
+		evt := &storypb.GameEvent{
+			PlayerAction: act,
+			Location:     loc,
+			Values:       map[string]int64{"bonus": 3},
+			Seed:         proto.Int64(seed),
+		}
+		got, err := HandleEvent(evt, NewStaticResolver(nil, nil))
+		if err != nil {
+			t.Fatalf("HandleEvent(seed %d) => %v, want nil", seed, err)
+		}
+		again, err := HandleEvent(evt, NewStaticResolver(nil, nil))
+		if err != nil {
+			t.Fatalf("HandleEvent(seed %d) => %v, want nil", seed, err)
+		}
+		if diff := cmp.Diff(got, again, protocmp.Transform()); diff != "" {
+			t.Errorf("HandleEvent(seed %d) is not repeatable: %s", seed, diff)
+		}
+		if got.GetSeed() == seed {
+			t.Errorf("HandleEvent(seed %d) did not advance the seed", seed)
+		}
+		gold, ok := got.GetValues()["gold"]
+		if !ok {
+			continue
+		}
+		successes++
+		if gold < 5 || gold > 15 {
+			t.Errorf("HandleEvent(seed %d) => gold %d, want 2d6 + 3", seed, gold)
+		}
+	}
+	// A 60% chance over 100 seeds; the bounds are generous.
+	if successes < 35 || successes > 85 {
+		t.Errorf("HandleEvent() succeeded %d times in 100, want about 60", successes)
+	}
+}
+
+func TestDiceConditionsAgree(t *testing.T) {
+	pred, err := logic.Parse("1d6 > 3")
+	if err != nil {
+		t.Fatalf("Parse() => %v, want nil", err)
+	}
+	acts := []*storypb.Action{
+		&storypb.Action{Id: proto.String("climb"), Title: proto.String("Climb")},
+		&storypb.Action{Id: proto.String("swim"), Title: proto.String("Swim")},
+	}
+	// The revision makes the conditions compile.
+	loc := &storypb.Location{Id: proto.String("river"), Revision: proto.String("1")}
+	for _, act := range acts {
+		loc.PossibleActions = append(loc.PossibleActions, &storypb.ActionCondition{
+			ActionId:     proto.String(act.GetId()),
+			Condition:    pred,
+			ShowDisabled: proto.Bool(true),
+		})
+	}
+
+	for seed := int64(0); seed < 50; seed++ {
+		evt := &storypb.GameEvent{
+			Location:         loc,
+			CandidateActions: acts,
+			Seed:             proto.Int64(seed),
+		}
+		choices, traces := Choices(evt), Traces(evt)
+		if len(choices) != len(acts) || len(traces) != len(acts) {
+			t.Fatalf("seed %d: %d choices and %d traces, want %d", seed, len(choices), len(traces), len(acts))
+		}
+		for idx, choice := range choices {
+			if traces[idx].GetPassed() != choice.Enabled {
+				t.Errorf("seed %d: %s traced as passed %v, but shown enabled %v", seed, choice.Action.GetId(), traces[idx].GetPassed(), choice.Enabled)
+			}
+			evt.PlayerAction = choice.Action
+			_, err := HandleEvent(evt, NewStaticResolver(nil, nil))
+			if choice.Enabled != (err == nil) {
+				t.Errorf("seed %d: %s shown enabled %v, but HandleEvent() => %v", seed, choice.Action.GetId(), choice.Enabled, err)
+			}
+			if !choice.Enabled && !strings.HasPrefix(choice.Reason, "Requires") {
+				t.Errorf("seed %d: %s disabled for reason %q", seed, choice.Action.GetId(), choice.Reason)
+			}
+		}
+	}
+}
+
+func TestStringEffects(t *testing.T) {
+	str := &storypb.Story{
+		Variables: []*storypb.Variable{
+			&storypb.Variable{Name: proto.String("class"), Type: storypb.Variable_VT_STRING.Enum()},
+			&storypb.Variable{Name: proto.String("name"), Type: storypb.Variable_VT_STRING.Enum(), DefaultStr: proto.String("Nobody")},
+			&storypb.Variable{Name: proto.String("gear"), Type: storypb.Variable_VT_STRING_ARRAY.Enum(), DefaultStrs: []string{"rope", "torch"}},
+			&storypb.Variable{Name: proto.String("gold"), DefaultInt: proto.Int64(10)},
+			&storypb.Variable{Name: proto.String("mood"), Type: storypb.Variable_VT_STRING.Enum(), DefaultStr: proto.String("calm"), Choices: []string{"calm", "angry"}},
+		},
+	}
+	tweak := func(key string, op storypb.StringTweak_Op, val string) *storypb.StringTweak {
+		return &storypb.StringTweak{Key: proto.String(key), Operation: op.Enum(), Value: proto.String(val)}
+	}
+
+	cases := []struct {
+		desc    string
+		strs    map[string]string
+		lists   map[string]*storypb.StringList
+		tweaks  []*storypb.StringTweak
+		wantErr bool
+		want    *storypb.GameEvent
+	}{
+		{
+			desc:   "Set literal",
+			tweaks: []*storypb.StringTweak{tweak("class", storypb.StringTweak_ST_SET, "'fighter")},
+			want: &storypb.GameEvent{
+				Strings: map[string]string{"class": "fighter"},
+			},
+		},
+		{
+			desc:   "Set from variable",
+			tweaks: []*storypb.StringTweak{tweak("class", storypb.StringTweak_ST_SET, "name")},
+			want: &storypb.GameEvent{
+				Strings: map[string]string{"class": "Nobody"},
+			},
+		},
+		{
+			desc:   "Append to default",
+			tweaks: []*storypb.StringTweak{tweak("gear", storypb.StringTweak_ST_APPEND, "'sword")},
+			want: &storypb.GameEvent{
+				Lists: map[string]*storypb.StringList{"gear": &storypb.StringList{Values: []string{"rope", "torch", "sword"}}},
+			},
+		},
+		{
+			desc:  "Remove and append",
+			lists: map[string]*storypb.StringList{"gear": &storypb.StringList{Values: []string{"rope", "key", "rope"}}},
+			tweaks: []*storypb.StringTweak{
+				tweak("gear", storypb.StringTweak_ST_REMOVE, "'rope"),
+				tweak("gear", storypb.StringTweak_ST_APPEND, "'lamp"),
+			},
+			want: &storypb.GameEvent{
+				Lists: map[string]*storypb.StringList{"gear": &storypb.StringList{Values: []string{"key", "lamp"}}},
+			},
+		},
+		{
+			desc:    "Wrong type",
+			tweaks:  []*storypb.StringTweak{tweak("gold", storypb.StringTweak_ST_SET, "'lots")},
+			wantErr: true,
+			want:    &storypb.GameEvent{},
+		},
+		{
+			desc:   "Set to a choice",
+			tweaks: []*storypb.StringTweak{tweak("mood", storypb.StringTweak_ST_SET, "'angry")},
+			want: &storypb.GameEvent{
+				Strings: map[string]string{"mood": "angry"},
+			},
+		},
+		{
+			desc:    "Set outside choices",
+			tweaks:  []*storypb.StringTweak{tweak("mood", storypb.StringTweak_ST_SET, "'sleepy")},
+			wantErr: true,
+			want:    &storypb.GameEvent{},
+		},
+		{
+			desc:    "Set from variable outside choices",
+			tweaks:  []*storypb.StringTweak{tweak("mood", storypb.StringTweak_ST_SET, "name")},
+			wantErr: true,
+			want:    &storypb.GameEvent{},
+		},
+		{
+			desc: "Failure changes nothing",
+			tweaks: []*storypb.StringTweak{
+				tweak("class", storypb.StringTweak_ST_SET, "'fighter"),
+				tweak("gear", storypb.StringTweak_ST_APPEND, "missing"),
+			},
+			wantErr: true,
+			want:    &storypb.GameEvent{},
+		},
+	}
+
+	ignore := protocmp.IgnoreFields(&storypb.GameEvent{}, "story", "effects")
+	for _, cc := range cases {
+		t.Run(cc.desc, func(t *testing.T) {
+			nState := &storypb.GameEvent{Story: str, Strings: cc.strs, Lists: cc.lists}
+			eff := &storypb.Effect{StringTweaks: cc.tweaks}
+			err := apply(eff, nState, newGameState(nState))
+			if (err != nil) != cc.wantErr {
+				t.Errorf("%s: apply() => %v, want error %v", cc.desc, err, cc.wantErr)
+			}
+			if diff := cmp.Diff(nState, cc.want, protocmp.Transform(), ignore); diff != "" {
+				t.Errorf("%s: apply() => %s, want %s, diff %s", cc.desc, prototext.Format(nState), prototext.Format(cc.want), diff)
+			}
+		})
+	}
+}
+
+func TestStringBranching(t *testing.T) {
+	uuid1 := uuid.New().String()
+	uuid2 := uuid.New().String()
+	pickPocket := &storypb.Action{Id: proto.String(uuid2), Title: proto.String("Pick pocket")}
+	loc := &storypb.Location{
+		Id: proto.String(uuid1),
+		PossibleActions: []*storypb.ActionCondition{
+			&storypb.ActionCondition{
+				ActionId: proto.String(uuid2),
+				Condition: &lpb.Predicate{
+					Test: &lpb.Predicate_Comp{
+						Comp: &lpb.Compare{
+							KeyOne:    proto.String("class"),
+							KeyTwo:    proto.String("['rogue, 'bard]"),
+							Operation: lpb.Compare_CMP_STRIN.Enum(),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for class, want := range map[string]int{"rogue": 1, "fighter": 0, "": 0} {
+		evt := &storypb.GameEvent{
+			Location:         loc,
+			CandidateActions: []*storypb.Action{pickPocket},
+			Strings:          map[string]string{"class": class},
+		}
+		if got := PossibleActions(evt); len(got) != want {
+			t.Errorf("PossibleActions(class %q) => %d actions, want %d", class, len(got), want)
+		}
+	}
+}
+
+func TestStartGame(t *testing.T) {
+	str := &storypb.Story{
+		Variables: []*storypb.Variable{
+			&storypb.Variable{Name: proto.String("gold"), DefaultInt: proto.Int64(10)},
+			&storypb.Variable{Name: proto.String("health"), InitialExpr: proto.String("3d6 + char.toughness"), Max: proto.Int64(18)},
+			&storypb.Variable{Name: proto.String("class"), Type: storypb.Variable_VT_STRING.Enum(), DefaultStr: proto.String("fighter")},
+			&storypb.Variable{Name: proto.String("tags"), Type: storypb.Variable_VT_STRING_ARRAY.Enum(), DefaultStrs: []string{"new"}},
+		},
+		OnStart: []*storypb.TriggerAction{
+			&storypb.TriggerAction{
+				Condition: &lpb.Predicate{
+					Test: &lpb.Predicate_Comp{
+						Comp: &lpb.Compare{
+							KeyOne:    proto.String("class"),
+							KeyTwo:    proto.String("'fighter"),
+							Operation: lpb.Compare_CMP_STREQ.Enum(),
+						},
+					},
+				},
+				Effects: []*storypb.Effect{
+					&storypb.Effect{
+						Description: proto.String("You wake with a sword in hand."),
+						TweakValue:  proto.String("gold"),
+						TweakAmount: proto.Int64(-5),
+						ItemTweaks: []*storypb.ItemTweak{
+							&storypb.ItemTweak{ItemId: proto.String("sword")},
+						},
+					},
+				},
+			},
+		},
+	}
+	evt := &storypb.GameEvent{
+		Story:     str,
+		Items:     []*storypb.Item{&storypb.Item{Id: proto.String("sword")}},
+		Character: &storypb.Character{Values: map[string]int64{"toughness": 4}},
+	}
+
+	for seed := int64(0); seed < 50; seed++ {
+		evt.Seed = proto.Int64(seed)
+		got, err := StartGame(evt, NewStaticResolver(nil, nil))
+		if err != nil {
+			t.Fatalf("StartGame(seed %d) => %v, want nil", seed, err)
+		}
+		again, err := StartGame(evt, NewStaticResolver(nil, nil))
+		if err != nil {
+			t.Fatalf("StartGame(seed %d) => %v, want nil", seed, err)
+		}
+		if diff := cmp.Diff(got, again, protocmp.Transform()); diff != "" {
+			t.Errorf("StartGame(seed %d) is not repeatable: %s", seed, diff)
+		}
+		if health := got.GetValues()["health"]; health < 7 || health > 18 {
+			t.Errorf("StartGame(seed %d) => health %d, want 3d6 + 4 clamped to 18", seed, health)
+		}
+		want := &storypb.GameEvent{
+			Values:    map[string]int64{"gold": 5, "health": got.GetValues()["health"]},
+			Strings:   map[string]string{"class": "fighter"},
+			Lists:     map[string]*storypb.StringList{"tags": &storypb.StringList{Values: []string{"new"}}},
+			Inventory: []*storypb.Item{&storypb.Item{Id: proto.String("sword"), Quantity: proto.Int64(1)}},
+			Effects:   []string{"You wake with a sword in hand."},
+		}
+		if diff := cmp.Diff(want, got, protocmp.Transform(), protocmp.IgnoreFields(&storypb.GameEvent{}, "story", "items", "character", "seed")); diff != "" {
+			t.Errorf("StartGame(seed %d) => %s, want %s, diff %s", seed, prototext.Format(got), prototext.Format(want), diff)
+		}
+	}
+
+	bad := proto.Clone(str).(*storypb.Story)
+	bad.Variables[1].InitialExpr = proto.String("3d6 + missing")
+	if got, err := StartGame(&storypb.GameEvent{Story: bad}, NewStaticResolver(nil, nil)); err == nil {
+		t.Errorf("StartGame(%q) => %s, want error", bad.Variables[1].GetInitialExpr(), prototext.Format(got))
+	}
+}
+
+func TestTravel(t *testing.T) {
+	move := func(lid, desc string) *storypb.TriggerAction {
+		eff := &storypb.Effect{Description: proto.String(desc)}
+		if len(lid) > 0 {
+			eff.NewLocationId = proto.String(lid)
+		}
+		return &storypb.TriggerAction{Effects: []*storypb.Effect{eff}}
+	}
+	jump := &storypb.Action{
+		Id:       proto.String("jump"),
+		Triggers: []*storypb.TriggerAction{move("trapdoor", "You jump.")},
+	}
+	hall := &storypb.Location{
+		Id:              proto.String("hall"),
+		PossibleActions: []*storypb.ActionCondition{&storypb.ActionCondition{ActionId: proto.String("jump")}},
+		OnEnter:         []*storypb.TriggerAction{move("", "A grand hall.")},
+		OnExit:          []*storypb.TriggerAction{move("", "You leave the hall.")},
+	}
+	trapdoor := &storypb.Location{
+		Id: proto.String("trapdoor"),
+		OnEnter: []*storypb.TriggerAction{
+			&storypb.TriggerAction{
+				Effects: []*storypb.Effect{
+					&storypb.Effect{
+						Description:   proto.String("You fall."),
+						TweakValue:    proto.String("health"),
+						TweakAmount:   proto.Int64(-1),
+						NewLocationId: proto.String("cellar"),
+					},
+				},
+			},
+		},
+	}
+	cellar := &storypb.Location{
+		Id:      proto.String("cellar"),
+		OnEnter: []*storypb.TriggerAction{move("", "It is dark.")},
+	}
+	// Two rooms that send the player back and forth forever.
+	ping := &storypb.Location{Id: proto.String("ping"), OnEnter: []*storypb.TriggerAction{move("pong", "")}}
+	pong := &storypb.Location{Id: proto.String("pong"), OnEnter: []*storypb.TriggerAction{move("ping", "")}}
+	res := NewStaticResolver([]*storypb.Location{hall, trapdoor, cellar, ping, pong}, []*storypb.Action{jump})
+
+	t.Run("Chained moves", func(t *testing.T) {
+		got, err := HandleEvent(&storypb.GameEvent{
+			PlayerAction: jump,
+			Location:     hall,
+			Values:       map[string]int64{"health": 3},
+		}, res)
+		if err != nil {
+			t.Fatalf("HandleEvent() => %v, want nil", err)
+		}
+		if diff := cmp.Diff(cellar, got.GetLocation(), protocmp.Transform()); diff != "" {
+			t.Errorf("HandleEvent() => location %s, want cellar: %s", prototext.Format(got.GetLocation()), diff)
+		}
+		if h := got.GetValues()["health"]; h != 2 {
+			t.Errorf("HandleEvent() => health %d, want 2", h)
+		}
+		want := []string{"You jump.", "You leave the hall.", "You fall.", "It is dark."}
+		if diff := cmp.Diff(want, got.GetEffects()); diff != "" {
+			t.Errorf("HandleEvent() => effects %q, want %q: %s", got.GetEffects(), want, diff)
+		}
+	})
+
+	t.Run("Unknown destination", func(t *testing.T) {
+		lost := &storypb.Action{
+			Id:       proto.String("jump"),
+			Triggers: []*storypb.TriggerAction{move("nowhere", "")},
+		}
+		if got, err := HandleEvent(&storypb.GameEvent{PlayerAction: lost, Location: hall}, res); err == nil {
+			t.Errorf("HandleEvent() => %s, want error", prototext.Format(got.GetLocation()))
+		}
+	})
+
+	t.Run("Loop", func(t *testing.T) {
+		loop := &storypb.Action{
+			Id:       proto.String("jump"),
+			Triggers: []*storypb.TriggerAction{move("ping", "")},
+		}
+		if got, err := HandleEvent(&storypb.GameEvent{PlayerAction: loop, Location: hall}, res); err == nil {
+			t.Errorf("HandleEvent() => %s, want error", prototext.Format(got.GetLocation()))
+		}
+	})
+
+	t.Run("Start", func(t *testing.T) {
+		got, err := StartGame(&storypb.GameEvent{
+			Story:    &storypb.Story{StartLocationId: proto.String("hall")},
+			Location: &storypb.Location{Id: proto.String("hall")},
+		}, res)
+		if err != nil {
+			t.Fatalf("StartGame() => %v, want nil", err)
+		}
+		if diff := cmp.Diff(hall, got.GetLocation(), protocmp.Transform()); diff != "" {
+			t.Errorf("StartGame() => location %s, want hall: %s", prototext.Format(got.GetLocation()), diff)
+		}
+		if want := []string{"A grand hall."}; !cmp.Equal(want, got.GetEffects()) {
+			t.Errorf("StartGame() => effects %q, want %q", got.GetEffects(), want)
+		}
+		if diff := cmp.Diff([]*storypb.Action{jump}, got.GetCandidateActions(), protocmp.Transform()); diff != "" {
+			t.Errorf("StartGame() => candidate actions %v, want jump: %s", got.GetCandidateActions(), diff)
+		}
+	})
+}